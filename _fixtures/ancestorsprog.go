@@ -0,0 +1,18 @@
+package main
+
+import "runtime"
+
+func leaf(done chan struct{}) {
+	runtime.Breakpoint()
+	close(done)
+}
+
+func middle(done chan struct{}) {
+	go leaf(done)
+}
+
+func main() {
+	done := make(chan struct{})
+	go middle(done)
+	<-done
+}
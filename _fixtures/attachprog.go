@@ -0,0 +1,27 @@
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+// Each worker keeps a thread of its own.
+func worker() {
+	runtime.LockOSThread()
+	for {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func tick(i int) int {
+	time.Sleep(10 * time.Millisecond)
+	return i + 1
+}
+
+func main() {
+	for i := 0; i < 4; i++ {
+		go worker()
+	}
+	for i := 0; ; i = tick(i) {
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func main() {
+	i, hit := 0, false
+	for {
+		hit = i%10 == 9
+		if hit {
+			fmt.Println(i)
+		}
+		i++
+	}
+}
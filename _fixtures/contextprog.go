@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+func main() {
+	background := context.Background()
+	active, cancelActive := context.WithCancel(background)
+	cancelled, cancel := context.WithCancel(background)
+	cancel()
+	expired, cancelExpired := context.WithTimeout(background, time.Nanosecond)
+	<-expired.Done()
+	values := context.WithValue(cancelled, "key", "value")
+	closedDone, openDone := cancelled.Done(), active.Done()
+	var nilDone chan struct{}
+	runtime.Breakpoint()
+	fmt.Println(background, active.Err(), cancelled.Err(), expired.Err(), values.Err())
+	fmt.Println(closedDone, openDone, nilDone)
+	cancelActive()
+	cancelExpired()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func deferred(i int) {
+	fmt.Println("deferred", i)
+}
+
+func manyDefers() {
+	// Defers in a loop are always registered with the runtime.
+	for i := 0; i < 3; i++ {
+		defer deferred(i)
+	}
+	runtime.Breakpoint()
+}
+
+func panicking() {
+	defer func() {
+		runtime.Breakpoint()
+		fmt.Println("recovered", recover())
+	}()
+	panic("boom")
+}
+
+func main() {
+	runtime.Breakpoint()
+	manyDefers()
+	panicking()
+}
@@ -0,0 +1,13 @@
+package main
+
+import "os"
+
+func main() {
+	if os.Getenv("DLV_TEST_ENV") != "launched" {
+		os.Exit(1)
+	}
+	wd, err := os.Getwd()
+	if err != nil || wd != os.Getenv("DLV_TEST_WD") {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func main() {
+	if err := syscall.Exec(os.Args[1], os.Args[1:], os.Environ()); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		fmt.Println("child")
+		return
+	}
+	out, err := exec.Command(os.Args[0], "child").CombinedOutput()
+	fmt.Println(string(out), err)
+}
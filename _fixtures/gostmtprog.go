@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+var wg sync.WaitGroup
+
+func producer() {
+	fmt.Println("producer")
+	wg.Done()
+}
+
+func consumer() {
+	fmt.Println("consumer")
+	wg.Done()
+}
+
+func start() {
+	go consumer()
+}
+
+func main() {
+	wg.Add(3)
+	go producer()
+	start()
+	go func() {
+		fmt.Println("closure")
+		wg.Done()
+	}()
+	wg.Wait()
+}
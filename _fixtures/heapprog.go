@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+var (
+	small *[100]byte
+	large *[100000]byte
+)
+
+func main() {
+	small = new([100]byte)
+	large = new([100000]byte)
+	runtime.Breakpoint()
+	fmt.Println(small[0], large[0])
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func double(a int) int {
+	return a * 2
+}
+
+func main() {
+	a := double(len(os.Args))
+	b := double(a + 1)
+	fmt.Println(a, b)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+type inner struct {
+	A, B int
+}
+
+type outer struct {
+	In inner
+	C  int
+}
+
+type deep struct {
+	O outer
+}
+
+var (
+	long   = strings.Repeat("x", 100)
+	many   = make([]int, 100)
+	nested = deep{O: outer{In: inner{A: 1, B: 2}, C: 3}}
+)
+
+func main() {
+	runtime.Breakpoint()
+	fmt.Println(len(long), len(many), nested)
+}
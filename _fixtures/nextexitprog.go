@@ -0,0 +1,9 @@
+package main
+
+import "os"
+
+func main() {
+	println("exiting")
+	os.Exit(0)
+	println("unreachable")
+}
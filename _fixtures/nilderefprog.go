@@ -0,0 +1,13 @@
+package main
+
+import "runtime"
+
+type T struct{ X int }
+
+var p *T
+
+func main() {
+	defer func() { recover() }()
+	runtime.Breakpoint()
+	println(p.X)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+func main() {
+	var once sync.Once
+	ponce := &once
+	runtime.Breakpoint()
+	once.Do(func() { fmt.Println("init") })
+	runtime.Breakpoint()
+	fmt.Println(ponce)
+}
@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+type point struct{ X, Y int }
+
+//go:noinline
+func sum(a, b int) int {
+	return a*3 + b
+}
+
+//go:noinline
+func dist(p, q *point) int {
+	return q.X - p.X + q.Y - p.Y
+}
+
+func main() {
+	pts := []point{{1, 2}, {4, 6}}
+	fmt.Println(sum(1, 2), dist(&pts[0], &pts[1]))
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func main() {
+	for i := 0; ; i++ {
+		if i == 3 {
+			fmt.Println("MARKER")
+		} else {
+			fmt.Println("line", i)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
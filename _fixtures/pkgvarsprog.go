@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type config struct {
+	Items []int
+	Name  string
+}
+
+var items = []int{1, 2, 3, 4}
+
+var cfg = &config{Items: []int{5, 6}, Name: "cfg"}
+
+var (
+	value    interface{} = cfg
+	nilvalue interface{}
+)
+
+func main() {
+	runtime.GC()
+	fmt.Println(items, cfg, value, nilvalue)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+var n = 42
+
+var (
+	rv    = reflect.ValueOf(n)
+	rvptr = reflect.ValueOf(&n)
+	zero  reflect.Value
+)
+
+func main() {
+	runtime.Breakpoint()
+	fmt.Println(rv, rvptr, zero)
+}
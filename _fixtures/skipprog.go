@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+func shout(s string) string {
+	return strings.ToUpper(s) + "!"
+}
+
+func main() {
+	runtime.Breakpoint()
+	s := strings.Repeat("a", 3)
+	s = shout(s)
+	fmt.Println(s)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+func worker(wg *sync.WaitGroup) {
+	fmt.Println("worker")
+	wg.Done()
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	runtime.Breakpoint()
+	go worker(&wg)
+	wg.Wait()
+}
@@ -0,0 +1,17 @@
+package main
+
+import "runtime"
+
+func recurse(n int) int {
+	var buf [64]byte
+	buf[0] = byte(n)
+	if n == 0 {
+		runtime.Breakpoint()
+		return int(buf[0])
+	}
+	return recurse(n-1) + int(buf[0])
+}
+
+func main() {
+	recurse(1000)
+}
@@ -0,0 +1,20 @@
+package main
+
+func square(x int) int {
+	y := x * x
+	return y
+}
+
+func main() {
+	a := 2
+	b := square(a)
+	s := make([]int, b)
+	println(len(s))
+	println(grow(b))
+}
+
+func grow(n int) int {
+	var buf [16384]byte
+	buf[n] = byte(n)
+	return int(buf[n])
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type Weekday int
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+)
+
+func (d Weekday) String() string {
+	switch d {
+	case Sunday:
+		return "Sunday"
+	case Monday:
+		return "Monday"
+	case Tuesday:
+		return "Tuesday"
+	}
+	return fmt.Sprintf("Weekday(%d)", int(d))
+}
+
+type astruct struct {
+	A int
+}
+
+type inner struct {
+	X int
+	S string
+}
+
+type node struct {
+	Val  int
+	Next *node
+}
+
+type outer struct {
+	A   int
+	In  inner
+	Arr [2]int
+	Sl  []int
+}
+
+type address struct {
+	Host string
+	Port int
+}
+
+type server struct {
+	Name string
+	Addr address
+}
+
+type config struct {
+	Servers []server
+}
+
+type greeter interface {
+	Greet() string
+}
+
+type english struct{}
+
+func (e *english) Greet() string {
+	return "hello"
+}
+
+type host struct {
+	greeter
+	Name string
+}
+
+type result struct {
+	err error
+}
+
+type myError struct{}
+
+func (e *myError) Error() string {
+	return "my error"
+}
+
+func helloworld() {
+	fmt.Println("Hello, World!")
+}
+
+func main() {
+	d1 := Monday
+	d2 := Weekday(10)
+	ifaces := []interface{}{1, "x", astruct{2}, &astruct{3}, nil}
+	var stringer fmt.Stringer = d1
+	o1 := outer{1, inner{2, "a"}, [2]int{1, 2}, []int{1, 2, 3}}
+	o2 := outer{1, inner{3, "a"}, [2]int{1, 5}, []int{1, 2}}
+	n := node{Val: 1}
+	n2 := node{Val: 2, Next: &node{Val: 3}}
+	cfg := config{[]server{{"a", address{"h1", 80}}, {"b", address{"h2", 8080}}, {"c", address{"h3", 443}}}}
+	fn1 := helloworld
+	var fn2 func()
+	h := host{&english{}, "h"}
+	m := make(map[int]int)
+	for i := 0; i < 100; i++ {
+		m[i] = i
+	}
+	var nilmap map[int]int
+	buf := [8]int64{}
+	start, end := &buf[1], &buf[6]
+	ps := &d1
+	spare := []int{1, 2, 3, 4, 5}[:2]
+	var nilerr *myError
+	r1 := result{}
+	r2 := result{nilerr}
+	runtime.Breakpoint()
+	fmt.Println(d1, d2, ifaces, stringer, o1, o2, n, n2, cfg, fn1 == nil, fn2 == nil, h.Greet(), len(m), nilmap, *start, *end, *ps, spare, r1.err == nil, r2.err == nil)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+type holder struct {
+	A int
+	P *int
+	B int
+}
+
+var (
+	x, y = 1, 2
+	bad  = (*int)(unsafe.Pointer(uintptr(16))) // Not mapped.
+	h    = holder{A: 1, P: bad, B: 2}
+	ptrs = []*int{&x, bad, &y}
+)
+
+func main() {
+	runtime.Breakpoint()
+	fmt.Println(h, ptrs)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+var counter int
+
+func main() {
+	ch := make(chan int)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ch <- 1
+	}()
+	runtime.Breakpoint()
+	counter += <-ch
+}
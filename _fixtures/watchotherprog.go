@@ -0,0 +1,17 @@
+package main
+
+import "runtime"
+
+var counter int
+
+func main() {
+	start, ch := make(chan bool), make(chan int)
+	go func() {
+		<-start
+		counter = 5
+		ch <- 1
+	}()
+	runtime.Breakpoint()
+	start <- true
+	counter += <-ch
+}
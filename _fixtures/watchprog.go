@@ -0,0 +1,12 @@
+package main
+
+import "runtime"
+
+var counter int
+
+func main() {
+	runtime.Breakpoint()
+	for i := 0; i < 3; i++ {
+		counter++
+	}
+}
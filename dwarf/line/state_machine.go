@@ -106,6 +106,32 @@ func (dbl *DebugLines) AllPCsForFileLine(f string, l int) (pcs []uint64) {
 	return
 }
 
+// Returns every PC the given file/line was compiled to, in every line
+// table referencing the file. Unlike AllPCsForFileLine the whole table
+// is scanned, so copies of the line inlined into other functions, even
+// ones belonging to other packages, are included.
+func (dbl *DebugLines) AllPCsForFileLineInlined(f string, l int) []uint64 {
+	var pcs []uint64
+	seen := make(map[uint64]bool)
+	for _, lineInfo := range *dbl {
+		if _, ok := lineInfo.Lookup[f]; !ok {
+			continue
+		}
+		var (
+			sm  = newStateMachine(lineInfo)
+			buf = bytes.NewBuffer(lineInfo.Instructions)
+		)
+		for b, err := buf.ReadByte(); err == nil; b, err = buf.ReadByte() {
+			findAndExecOpcode(sm, buf, b)
+			if sm.line == l && sm.file == f && !seen[sm.address] {
+				seen[sm.address] = true
+				pcs = append(pcs, sm.address)
+			}
+		}
+	}
+	return pcs
+}
+
 func (dbl *DebugLines) AllPCsBetween(begin, end uint64, filename string) []uint64 {
 	lineInfo := dbl.GetLineInfo(filename)
 	var (
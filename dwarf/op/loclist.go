@@ -0,0 +1,47 @@
+package op
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LocationListEntry returns the location expression that applies at pc
+// in the location list found at off in the contents of the .debug_loc
+// section. Addresses in the list are relative to base, the base address
+// of the compile unit, unless the list selects another one. Returns nil
+// if no entry covers pc, the value is not available there.
+func LocationListEntry(debugLoc []byte, off int64, base, pc uint64) ([]byte, error) {
+	const ptrSize = 8
+	if off < 0 || off >= int64(len(debugLoc)) {
+		return nil, fmt.Errorf("invalid location list offset %#x", off)
+	}
+	buf := debugLoc[off:]
+	for {
+		if len(buf) < 2*ptrSize {
+			return nil, fmt.Errorf("truncated location list at %#x", off)
+		}
+		begin := binary.LittleEndian.Uint64(buf)
+		end := binary.LittleEndian.Uint64(buf[ptrSize:])
+		buf = buf[2*ptrSize:]
+		switch {
+		case begin == 0 && end == 0:
+			return nil, nil
+		case begin == ^uint64(0):
+			// Base address selection entry.
+			base = end
+			continue
+		}
+		if len(buf) < 2 {
+			return nil, fmt.Errorf("truncated location list at %#x", off)
+		}
+		n := int(binary.LittleEndian.Uint16(buf))
+		buf = buf[2:]
+		if len(buf) < n {
+			return nil, fmt.Errorf("truncated location list at %#x", off)
+		}
+		if base+begin <= pc && pc < base+end {
+			return buf[:n], nil
+		}
+		buf = buf[n:]
+	}
+}
@@ -15,9 +15,43 @@ const (
 	DW_OP_plus           = 0x22
 	DW_OP_consts         = 0x11
 	DW_OP_plus_uconsts   = 0x23
+	DW_OP_reg0           = 0x50
+	DW_OP_reg31          = 0x6f
+	DW_OP_breg0          = 0x70
+	DW_OP_breg31         = 0x8f
+	DW_OP_regx           = 0x90
+	DW_OP_fbreg          = 0x91
+	DW_OP_bregx          = 0x92
+	DW_OP_piece          = 0x93
 )
 
-type stackfn func(*bytes.Buffer, []int64, int64) ([]int64, error)
+// DwarfRegisters returns the value of the register with the given
+// DWARF register number.
+type DwarfRegisters func(regnum uint64) (uint64, error)
+
+// Location is where a location expression places a value: in memory
+// at Addr or, if InRegister is set, in the register number Register.
+type Location struct {
+	Addr       int64
+	InRegister bool
+	Register   uint64
+}
+
+// ErrOptimizedOut is returned for an empty location expression, which
+// describes a value that is not available, i.e. it was optimized out.
+var ErrOptimizedOut = errors.New("optimized out")
+
+// Returned for composite locations, describing a value split in pieces
+// stored in different places.
+var errPieces = errors.New("values split in pieces (DW_OP_piece) are not supported")
+
+// State of the evaluation of a location expression.
+type context struct {
+	cfa  int64
+	regs DwarfRegisters
+}
+
+type stackfn func(*bytes.Buffer, []int64, *context) ([]int64, error)
 
 var oplut = map[byte]stackfn{
 	DW_OP_call_frame_cfa: callframecfa,
@@ -25,43 +59,125 @@ var oplut = map[byte]stackfn{
 	DW_OP_consts:         consts,
 	DW_OP_addr:           addr,
 	DW_OP_plus_uconsts:   plusuconsts,
+	DW_OP_fbreg:          fbreg,
+	DW_OP_bregx:          bregx,
+}
+
+func init() {
+	for op := DW_OP_breg0; op <= DW_OP_breg31; op++ {
+		oplut[byte(op)] = breg(uint64(op - DW_OP_breg0))
+	}
 }
 
 func ExecuteStackProgram(cfa int64, instructions []byte) (int64, error) {
+	loc, err := EvalLocation(cfa, nil, instructions)
+	if err != nil {
+		return 0, err
+	}
+	if loc.InRegister {
+		return 0, fmt.Errorf("value is stored in register %d", loc.Register)
+	}
+	return loc.Addr, nil
+}
+
+// EvalLocation evaluates the location expression instructions. The
+// frame base is assumed to be the CFA, as it is for Go functions. regs
+// is needed by expressions relative to a register, it can be nil if
+// register values are not available.
+func EvalLocation(cfa int64, regs DwarfRegisters, instructions []byte) (Location, error) {
+	if len(instructions) == 0 {
+		return Location{}, ErrOptimizedOut
+	}
+	// A register location names the register holding the value and
+	// is the whole expression.
+	switch opcode := instructions[0]; {
+	case opcode >= DW_OP_reg0 && opcode <= DW_OP_reg31:
+		if len(instructions) > 1 {
+			return Location{}, errPieces
+		}
+		return Location{InRegister: true, Register: uint64(opcode - DW_OP_reg0)}, nil
+	case opcode == DW_OP_regx:
+		buf := bytes.NewBuffer(instructions[1:])
+		regnum, _ := util.DecodeULEB128(buf)
+		if buf.Len() > 0 {
+			return Location{}, errPieces
+		}
+		return Location{InRegister: true, Register: regnum}, nil
+	}
+
+	ctx := &context{cfa: cfa, regs: regs}
 	stack := make([]int64, 0, 3)
 	buf := bytes.NewBuffer(instructions)
 
 	for opcode, err := buf.ReadByte(); err == nil; opcode, err = buf.ReadByte() {
+		if opcode == DW_OP_piece {
+			return Location{}, errPieces
+		}
 		fn, ok := oplut[opcode]
 		if !ok {
-			return 0, fmt.Errorf("invalid instruction %#v", opcode)
+			return Location{}, fmt.Errorf("invalid instruction %#v", opcode)
 		}
 
-		stack, err = fn(buf, stack, cfa)
+		stack, err = fn(buf, stack, ctx)
 		if err != nil {
-			return 0, err
+			return Location{}, err
 		}
 	}
 
 	if len(stack) == 0 {
-		return 0, errors.New("empty OP stack")
+		return Location{}, errors.New("empty OP stack")
 	}
 
-	return stack[len(stack)-1], nil
+	return Location{Addr: stack[len(stack)-1]}, nil
 }
 
-func callframecfa(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
-	if cfa == 0 {
+func callframecfa(buf *bytes.Buffer, stack []int64, ctx *context) ([]int64, error) {
+	if ctx.cfa == 0 {
 		return stack, fmt.Errorf("Could not retrieve CFA for current PC")
 	}
-	return append(stack, int64(cfa)), nil
+	return append(stack, int64(ctx.cfa)), nil
+}
+
+func fbreg(buf *bytes.Buffer, stack []int64, ctx *context) ([]int64, error) {
+	stack, err := callframecfa(buf, stack, ctx)
+	if err != nil {
+		return stack, err
+	}
+	num, _ := util.DecodeSLEB128(buf)
+	stack[len(stack)-1] += num
+	return stack, nil
+}
+
+// Returns the implementation of DW_OP_breg<regnum>.
+func breg(regnum uint64) stackfn {
+	return func(buf *bytes.Buffer, stack []int64, ctx *context) ([]int64, error) {
+		return bregOffset(buf, stack, ctx, regnum)
+	}
+}
+
+func bregx(buf *bytes.Buffer, stack []int64, ctx *context) ([]int64, error) {
+	regnum, _ := util.DecodeULEB128(buf)
+	return bregOffset(buf, stack, ctx, regnum)
+}
+
+// Pushes the value of register regnum plus the offset that follows.
+func bregOffset(buf *bytes.Buffer, stack []int64, ctx *context, regnum uint64) ([]int64, error) {
+	num, _ := util.DecodeSLEB128(buf)
+	if ctx.regs == nil {
+		return stack, fmt.Errorf("value of register %d not available", regnum)
+	}
+	val, err := ctx.regs(regnum)
+	if err != nil {
+		return stack, err
+	}
+	return append(stack, int64(val)+num), nil
 }
 
-func addr(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
+func addr(buf *bytes.Buffer, stack []int64, ctx *context) ([]int64, error) {
 	return append(stack, int64(binary.LittleEndian.Uint64(buf.Next(8)))), nil
 }
 
-func plus(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
+func plus(buf *bytes.Buffer, stack []int64, ctx *context) ([]int64, error) {
 	var (
 		slen   = len(stack)
 		digits = stack[slen-2 : slen]
@@ -71,14 +187,14 @@ func plus(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
 	return append(st, digits[0]+digits[1]), nil
 }
 
-func plusuconsts(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
+func plusuconsts(buf *bytes.Buffer, stack []int64, ctx *context) ([]int64, error) {
 	slen := len(stack)
 	num, _ := util.DecodeULEB128(buf)
 	stack[slen-1] = stack[slen-1] + int64(num)
 	return stack, nil
 }
 
-func consts(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
+func consts(buf *bytes.Buffer, stack []int64, ctx *context) ([]int64, error) {
 	num, _ := util.DecodeSLEB128(buf)
 	return append(stack, num), nil
 }
@@ -1,6 +1,10 @@
 package op
 
-import "testing"
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
 
 func TestExecuteStackProgram(t *testing.T) {
 	var (
@@ -16,3 +20,75 @@ func TestExecuteStackProgram(t *testing.T) {
 		t.Fatalf("actual %d != expected %d", actual, expected)
 	}
 }
+
+func TestEvalLocation(t *testing.T) {
+	regs := func(regnum uint64) (uint64, error) {
+		return 0x1000 + regnum, nil
+	}
+	testcases := []struct {
+		instructions []byte
+		loc          Location
+	}{
+		{[]byte{DW_OP_call_frame_cfa}, Location{Addr: 0x2000}},
+		{[]byte{DW_OP_fbreg, 0x78}, Location{Addr: 0x2000 - 8}},           // fbreg -8
+		{[]byte{DW_OP_breg0 + 7, 0x10}, Location{Addr: 0x1007 + 16}},      // rsp + 16
+		{[]byte{DW_OP_bregx, 0x10, 0x7f}, Location{Addr: 0x1010 - 1}},     // rip - 1
+		{[]byte{DW_OP_reg0 + 3}, Location{InRegister: true, Register: 3}}, // rbx
+		{[]byte{DW_OP_regx, 0x11}, Location{InRegister: true, Register: 17}},
+	}
+	for _, tc := range testcases {
+		loc, err := EvalLocation(0x2000, regs, tc.instructions)
+		if err != nil {
+			t.Fatalf("%x: %s", tc.instructions, err)
+		}
+		if loc != tc.loc {
+			t.Fatalf("%x: wrong location %#v (expected %#v)", tc.instructions, loc, tc.loc)
+		}
+	}
+
+	if _, err := EvalLocation(0x2000, regs, nil); err != ErrOptimizedOut {
+		t.Fatalf("empty location: expected ErrOptimizedOut, got %v", err)
+	}
+	if _, err := EvalLocation(0x2000, nil, []byte{DW_OP_breg0, 0}); err == nil {
+		t.Fatal("register relative location evaluated without registers")
+	}
+}
+
+func TestLocationListEntry(t *testing.T) {
+	entry := func(begin, end uint64, expr ...byte) []byte {
+		b := make([]byte, 18, 18+len(expr))
+		binary.LittleEndian.PutUint64(b, begin)
+		binary.LittleEndian.PutUint64(b[8:], end)
+		binary.LittleEndian.PutUint16(b[16:], uint16(len(expr)))
+		return append(b, expr...)
+	}
+	var debugLoc []byte
+	debugLoc = append(debugLoc, entry(0x10, 0x20, DW_OP_reg0)...)
+	debugLoc = append(debugLoc, entry(^uint64(0), 0x5000)[:16]...) // base address selection
+	debugLoc = append(debugLoc, entry(0x4, 0x8, DW_OP_call_frame_cfa)...)
+	debugLoc = append(debugLoc, make([]byte, 16)...) // end of list
+
+	testcases := []struct {
+		pc   uint64
+		expr []byte
+	}{
+		{0x1010, []byte{DW_OP_reg0}},
+		{0x101f, []byte{DW_OP_reg0}},
+		{0x1020, nil},
+		{0x5004, []byte{DW_OP_call_frame_cfa}},
+		{0x5008, nil},
+	}
+	for _, tc := range testcases {
+		expr, err := LocationListEntry(debugLoc, 0, 0x1000, tc.pc)
+		if err != nil {
+			t.Fatalf("%#x: %s", tc.pc, err)
+		}
+		if !bytes.Equal(expr, tc.expr) {
+			t.Fatalf("%#x: wrong expression %x (expected %x)", tc.pc, expr, tc.expr)
+		}
+	}
+
+	if _, err := EvalLocation(0, nil, []byte{DW_OP_reg0, DW_OP_piece, 8, DW_OP_reg0 + 3, DW_OP_piece, 8}); err != errPieces {
+		t.Fatalf("composite location: expected errPieces, got %v", err)
+	}
+}
@@ -313,6 +313,28 @@ func (reader *Reader) NextPackageVariable() (*dwarf.Entry, error) {
 	return nil, nil
 }
 
+// NextPackageConstant moves the reader to the next debug entry that describes a package constant.
+// Any TagConstant entry that is not inside a sub program entry is considered a package constant.
+func (reader *Reader) NextPackageConstant() (*dwarf.Entry, error) {
+	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.Tag == dwarf.TagConstant {
+			return entry, nil
+		}
+
+		// Ignore everything inside sub programs
+		if entry.Tag == dwarf.TagSubprogram {
+			reader.SkipChildren()
+		}
+	}
+
+	// No more items
+	return nil, nil
+}
+
 func (reader *Reader) NextCompileUnit() (*dwarf.Entry, error) {
 	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
 		if err != nil {
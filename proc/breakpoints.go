@@ -1,6 +1,9 @@
 package proc
 
-import "fmt"
+import (
+	"debug/dwarf"
+	"fmt"
+)
 
 // Represents a single breakpoint. Stores information on the break
 // point including the byte of data that originally was stored at that
@@ -15,18 +18,69 @@ type Breakpoint struct {
 	OriginalData []byte // If software breakpoint, the data we replace with breakpoint instruction.
 	ID           int    // Monotonically increasing ID.
 	Temp         bool   // Whether this is a temp breakpoint (for next'ing).
+	Internal     bool   // Temp breakpoint set by the stepping code, removed by clearInternalBreakpoints.
+	HitCount     uint64 // Number of times a thread stopped at this breakpoint.
+	fnOffset     uint64 // Distance of Addr from the entry of the function.
+
+	// Name of a boolean variable, as accepted by EvalVariable. If set,
+	// Continue only stops at the breakpoint when it is true.
+	Cond string
+	cond *CompiledExpr // Cond, compiled the first time it is checked.
 
 	// Breakpoint information
 	Tracepoint bool     // Tracepoint flag
 	Stacktrace int      // Number of stack frames to retrieve
 	Goroutine  bool     // Retrieve goroutine information
 	Variables  []string // Variables to evaluate
+	Spawn      bool     // Retrieve the function started by the go statement
 }
 
 func (bp *Breakpoint) String() string {
 	return fmt.Sprintf("Breakpoint %d at %#v %s:%d", bp.ID, bp.Addr, bp.File, bp.Line)
 }
 
+type breakpointsByID []*Breakpoint
+
+func (bps breakpointsByID) Len() int      { return len(bps) }
+func (bps breakpointsByID) Swap(i, j int) { bps[i], bps[j] = bps[j], bps[i] }
+func (bps breakpointsByID) Less(i, j int) bool {
+	// Temporary breakpoints have their own ID sequence.
+	if bps[i].Temp != bps[j].Temp {
+		return !bps[i].Temp
+	}
+	if bps[i].ID != bps[j].ID {
+		return bps[i].ID < bps[j].ID
+	}
+	return bps[i].Addr < bps[j].Addr
+}
+
+// Reports whether the thread, stopped at the breakpoint, should stay
+// stopped: Cond is empty or true.
+func (bp *Breakpoint) checkCondition(thread *Thread) (bool, error) {
+	if bp.Cond == "" {
+		return true, nil
+	}
+	scope, err := thread.Scope()
+	if err != nil {
+		return true, err
+	}
+	if bp.cond == nil || bp.cond.Name != bp.Cond {
+		ce, err := scope.Compile(bp.Cond)
+		if err != nil {
+			return true, err
+		}
+		if _, ok := resolveTypedefs(ce.typ).(*dwarf.BoolType); !ok {
+			return true, fmt.Errorf("condition %s of type %s is not a boolean", bp.Cond, ce.typ)
+		}
+		bp.cond = ce
+	}
+	v, err := bp.cond.Eval(scope, LoadConfig{})
+	if err != nil {
+		return true, err
+	}
+	return v.Value == "true", nil
+}
+
 // Clear this breakpoint appropriately depending on whether it is a
 // hardware or software breakpoint.
 func (bp *Breakpoint) Clear(thread *Thread) (*Breakpoint, error) {
@@ -36,36 +90,84 @@ func (bp *Breakpoint) Clear(thread *Thread) (*Breakpoint, error) {
 	return bp, nil
 }
 
+// LineBreakpoint is a logical breakpoint on a source line. A single
+// line may be compiled to several discontiguous PC ranges (i.e. the
+// condition and the increment of a for loop), each one of them gets
+// its own physical breakpoint, all sharing the same ID.
+type LineBreakpoint struct {
+	ID          int
+	File        string
+	Line        int
+	Breakpoints []*Breakpoint
+}
+
+// Addrs returns the addresses of all the physical breakpoints.
+func (lbp *LineBreakpoint) Addrs() []uint64 {
+	addrs := make([]uint64, len(lbp.Breakpoints))
+	for i := range lbp.Breakpoints {
+		addrs[i] = lbp.Breakpoints[i].Addr
+	}
+	return addrs
+}
+
+// HitCount returns the number of times any of the physical
+// breakpoints was hit.
+func (lbp *LineBreakpoint) HitCount() uint64 {
+	var n uint64
+	for _, bp := range lbp.Breakpoints {
+		n += bp.HitCount
+	}
+	return n
+}
+
+func (lbp *LineBreakpoint) String() string {
+	return fmt.Sprintf("Breakpoint %d at %s:%d (%d addresses)", lbp.ID, lbp.File, lbp.Line, len(lbp.Breakpoints))
+}
+
 // Returned when trying to set a breakpoint at
 // an address that already has a breakpoint set for it.
+// Breakpoint is the existing breakpoint.
 type BreakpointExistsError struct {
-	file string
-	line int
-	addr uint64
+	Breakpoint *Breakpoint
 }
 
 func (bpe BreakpointExistsError) Error() string {
-	return fmt.Sprintf("Breakpoint exists at %s:%d at %x", bpe.file, bpe.line, bpe.addr)
+	return fmt.Sprintf("Breakpoint exists at %s:%d at %x", bpe.Breakpoint.File, bpe.Breakpoint.Line, bpe.Breakpoint.Addr)
 }
 
 // InvalidAddressError represents the result of
-// attempting to set a breakpoint at an invalid address.
+// attempting to set a breakpoint at an invalid address,
+// one that does not belong to any function.
 type InvalidAddressError struct {
-	address uint64
+	Address uint64
 }
 
 func (iae InvalidAddressError) Error() string {
-	return fmt.Sprintf("Invalid address %#v\n", iae.address)
+	return fmt.Sprintf("Invalid address %#v\n", iae.Address)
 }
 
 func (dbp *Process) setBreakpoint(tid int, addr uint64, temp bool) (*Breakpoint, error) {
+	counter := &dbp.breakpointIDCounter
+	if temp {
+		counter = &dbp.tempBreakpointIDCounter
+	}
+	bp, err := dbp.setBreakpointWithID(tid, addr, temp, *counter+1)
+	if err != nil {
+		return nil, err
+	}
+	*counter = bp.ID
+	return bp, nil
+}
+
+// Sets a breakpoint with the given ID, leaving the ID counters alone.
+func (dbp *Process) setBreakpointWithID(tid int, addr uint64, temp bool, id int) (*Breakpoint, error) {
 	if bp, ok := dbp.FindBreakpoint(addr); ok {
-		return nil, BreakpointExistsError{bp.File, bp.Line, bp.Addr}
+		return nil, BreakpointExistsError{Breakpoint: bp}
 	}
 
 	f, l, fn := dbp.goSymTable.PCToLine(uint64(addr))
 	if fn == nil {
-		return nil, InvalidAddressError{address: addr}
+		return nil, InvalidAddressError{Address: addr}
 	}
 
 	newBreakpoint := &Breakpoint{
@@ -73,15 +175,9 @@ func (dbp *Process) setBreakpoint(tid int, addr uint64, temp bool) (*Breakpoint,
 		File:         f,
 		Line:         l,
 		Addr:         addr,
+		ID:           id,
 		Temp:         temp,
-	}
-
-	if temp {
-		dbp.tempBreakpointIDCounter++
-		newBreakpoint.ID = dbp.tempBreakpointIDCounter
-	} else {
-		dbp.breakpointIDCounter++
-		newBreakpoint.ID = dbp.breakpointIDCounter
+		fnOffset:     addr - fn.Entry,
 	}
 
 	thread := dbp.Threads[tid]
@@ -111,3 +207,106 @@ type NoBreakpointError struct {
 func (nbp NoBreakpointError) Error() string {
 	return fmt.Sprintf("no breakpoint at %#v", nbp.addr)
 }
+
+// WatchKind selects the memory accesses that trigger a Watchpoint.
+// The hardware can not tell reads from writes, a WatchRead access is
+// one that left the memory unchanged: instructions that both read and
+// write it, like an increment, count as writes.
+type WatchKind int
+
+const (
+	WatchWrite     WatchKind = iota // Stop after the memory is written.
+	WatchRead                       // Stop after the memory is read, not written.
+	WatchReadWrite                  // Stop after the memory is read or written.
+)
+
+func (k WatchKind) String() string {
+	switch k {
+	case WatchWrite:
+		return "write"
+	case WatchRead:
+		return "read"
+	case WatchReadWrite:
+		return "read/write"
+	}
+	return fmt.Sprintf("WatchKind(%d)", int(k))
+}
+
+// Watchpoint is a hardware watchpoint, it stops the thread that accessed
+// the watched memory right after the accessing instruction. It uses one
+// of the x86 debug registers DR0-DR3, which are programmed on every
+// thread of the process.
+type Watchpoint struct {
+	Addr     uint64    // Address of the watched memory.
+	Size     int       // Size of the watched memory: 1, 2, 4 or 8 bytes.
+	Kind     WatchKind // Accesses that trigger the watchpoint.
+	ID       int       // Shares the sequence of Breakpoint IDs.
+	HitCount uint64    // Number of times a thread stopped at this watchpoint.
+
+	reg  int    // Debug register holding Addr.
+	data []byte // Memory after the last stop, used to tell reads from writes.
+}
+
+func (wp *Watchpoint) String() string {
+	return fmt.Sprintf("Watchpoint %d (%s) at %#x, %d bytes", wp.ID, wp.Kind, wp.Addr, wp.Size)
+}
+
+// Bits of DR7 enabling the watchpoint in its debug register: the local
+// enable bit, the access condition and the length.
+func (wp *Watchpoint) dr7() uint64 {
+	rw := uint64(0x1) // Break on data writes.
+	if wp.Kind != WatchWrite {
+		// There is no condition for reads only, writes are filtered out
+		// by handleWatchpointOnThread.
+		rw = 0x3
+	}
+	var length uint64
+	switch wp.Size {
+	case 2:
+		length = 0x1
+	case 4:
+		length = 0x3
+	case 8:
+		length = 0x2
+	}
+	return 1<<uint(wp.reg*2) | (rw|length<<2)<<uint(16+wp.reg*4)
+}
+
+// InvalidWatchpointError is returned by SetWatchpoint when the
+// watched memory can not be covered by a debug register.
+type InvalidWatchpointError struct {
+	Addr uint64
+	Size int
+}
+
+func (e InvalidWatchpointError) Error() string {
+	return fmt.Sprintf("can not watch %d bytes at %#x, the size must be 1, 2, 4 or 8 and the address aligned to it", e.Size, e.Addr)
+}
+
+// WatchpointExistsError is returned when trying to set a watchpoint
+// at an address that already has one.
+type WatchpointExistsError struct {
+	Watchpoint *Watchpoint
+}
+
+func (e WatchpointExistsError) Error() string {
+	return fmt.Sprintf("Watchpoint exists at %#x", e.Watchpoint.Addr)
+}
+
+// NoFreeDebugRegisterError is returned by SetWatchpoint when all the
+// debug registers are used by other watchpoints.
+type NoFreeDebugRegisterError struct{}
+
+func (e NoFreeDebugRegisterError) Error() string {
+	return "no free debug register, clear a watchpoint first"
+}
+
+// NoWatchpointError is returned when trying to clear a watchpoint that
+// does not exist.
+type NoWatchpointError struct {
+	addr uint64
+}
+
+func (e NoWatchpointError) Error() string {
+	return fmt.Sprintf("no watchpoint at %#v", e.addr)
+}
@@ -0,0 +1,238 @@
+package proc
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"strings"
+
+	"github.com/derekparker/delve/dwarf/op"
+)
+
+// CompiledExpr is a variable name, optionally followed by field selectors
+// and constant indexes, resolved once against the debug information by
+// EvalScope.Compile. Eval only reads memory, the DWARF lookups needed to
+// locate the variable and its fields are not repeated, which makes it
+// cheap to evaluate the same expression every time a frequently hit
+// breakpoint is reached.
+type CompiledExpr struct {
+	Name string
+
+	fnEntry      uint64 // Entry of the function declaring the local variable, 0 for package variables.
+	instructions []byte // Location of the local variable, relative to the CFA.
+	addr         uintptr
+	steps        []selectorStep
+	typ          dwarf.Type
+}
+
+// A field selector or array index, resolved to the offset of the field
+// or element. Slice elements are located when the expression is
+// evaluated, reading the slice header.
+type selectorStep struct {
+	deref  bool // Dereference a pointer before selecting the field.
+	offset int64
+	name   string
+
+	slice  bool // Select element index of a slice, its elements are stride bytes long.
+	index  int64
+	stride int64
+}
+
+// Compile resolves name, as accepted by EvalVariable, for repeated
+// evaluation. Local variables are resolved in the function of the scope,
+// the expression can only be evaluated in the scopes of that function.
+// Names resolving to functions or to methods promoted from embedded
+// interfaces are not supported.
+func (scope *EvalScope) Compile(name string) (*CompiledExpr, error) {
+	parts := strings.Split(name, ".")
+	ce := &CompiledExpr{Name: name}
+	vname, index := splitIndexes(parts[0])
+	members := withIndexes(index, parts[1:])
+	if err := scope.compileLocal(ce, vname); err != nil {
+		origErr := err
+		v, m, err := scope.packageVariable(parts)
+		if err != nil {
+			return nil, origErr
+		}
+		if v.fnEntry != 0 {
+			return nil, fmt.Errorf("can not compile function %s", v.Name)
+		}
+		ce.addr, ce.typ, members, vname = v.Addr, v.dwarfType, m, v.Name
+	}
+
+	for _, member := range members {
+		field, index := splitIndexes(member)
+		if field != "" {
+			if err := ce.compileField(vname, field); err != nil {
+				return nil, err
+			}
+			vname += "." + field
+		}
+		if index == "" {
+			continue
+		}
+		indexes, err := parseIndexes(index)
+		if err != nil {
+			return nil, err
+		}
+		for _, idx := range indexes {
+			if err := ce.compileIndex(vname, idx); err != nil {
+				return nil, err
+			}
+			vname += fmt.Sprintf("[%d]", idx)
+		}
+	}
+	return ce, nil
+}
+
+// Adds the selection of field of the struct vname, or of the struct
+// it points to.
+func (ce *CompiledExpr) compileField(vname, member string) error {
+	step := selectorStep{name: vname}
+	typ := resolveTypedefs(ce.typ)
+	if ptr, ok := typ.(*dwarf.PtrType); ok {
+		step.deref = true
+		typ = resolveTypedefs(ptr.Type)
+	}
+	t, ok := typ.(*dwarf.StructType)
+	if !ok {
+		return fmt.Errorf("%s type %s is not a struct", vname, typ)
+	}
+	var field *dwarf.StructField
+	for _, f := range t.Field {
+		if f.Name == member {
+			field = f
+			break
+		}
+	}
+	if field == nil {
+		return fmt.Errorf("%s has no member %s", vname, member)
+	}
+	step.offset = field.ByteOffset
+	ce.steps = append(ce.steps, step)
+	ce.typ = field.Type
+	return nil
+}
+
+// Adds the selection of element idx of the array or slice vname.
+func (ce *CompiledExpr) compileIndex(vname string, idx int64) error {
+	step := selectorStep{name: vname, index: idx}
+	switch t := resolveTypedefs(ce.typ).(type) {
+	case *dwarf.ArrayType:
+		if idx < 0 || idx >= t.Count {
+			return fmt.Errorf("index %d out of range for %s of length %d", idx, vname, t.Count)
+		}
+		step.offset = idx * (t.ByteSize / t.Count)
+		ce.typ = t.Type
+	case *dwarf.StructType:
+		if !strings.HasPrefix(t.StructName, "[]") {
+			return fmt.Errorf("%s type %s is not an array or slice", vname, ce.typ)
+		}
+		var elem dwarf.Type
+		for _, f := range t.Field {
+			if f.Name == "array" {
+				if ptr, ok := f.Type.(*dwarf.PtrType); ok {
+					elem = ptr.Type
+				}
+			}
+		}
+		if elem == nil {
+			return fmt.Errorf("invalid slice type %s", t)
+		}
+		if idx < 0 {
+			return fmt.Errorf("index %d out of range for %s", idx, vname)
+		}
+		step.slice = true
+		step.stride = elem.Size()
+		ce.typ = elem
+	default:
+		return fmt.Errorf("%s type %s is not an array or slice", vname, ce.typ)
+	}
+	ce.steps = append(ce.steps, step)
+	return nil
+}
+
+// Resolves varName as a variable of the function of the scope.
+func (scope *EvalScope) compileLocal(ce *CompiledExpr, varName string) error {
+	reader := scope.DwarfReader()
+
+	fn, err := reader.SeekToFunction(scope.PC)
+	if err != nil {
+		return err
+	}
+
+	for entry, err := reader.NextScopeVariable(); entry != nil; entry, err = reader.NextScopeVariable() {
+		if err != nil {
+			return err
+		}
+		if n, ok := entry.Val(dwarf.AttrName).(string); !ok || n != varName {
+			continue
+		}
+		offset, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			return fmt.Errorf("type assertion failed")
+		}
+		ce.typ, err = scope.Type(offset)
+		if err != nil {
+			return err
+		}
+		ce.instructions, ok = entry.Val(dwarf.AttrLocation).([]byte)
+		if !ok {
+			return fmt.Errorf("type assertion failed")
+		}
+		ce.fnEntry, _ = fn.Val(dwarf.AttrLowpc).(uint64)
+		return nil
+	}
+	return fmt.Errorf("could not find symbol value for %s", varName)
+}
+
+// Eval reads the current value of the compiled expression in scope,
+// according to cfg.
+func (ce *CompiledExpr) Eval(scope *EvalScope, cfg LoadConfig) (*Variable, error) {
+	addr := ce.addr
+	if ce.instructions != nil {
+		fn := scope.Thread.dbp.goSymTable.PCToFunc(scope.PC)
+		if fn == nil || fn.Entry != ce.fnEntry {
+			return nil, fmt.Errorf("%s was compiled for a different function", ce.Name)
+		}
+		a, err := op.ExecuteStackProgram(scope.CFA, ce.instructions)
+		if err != nil {
+			return nil, err
+		}
+		addr = uintptr(a)
+	}
+	for _, step := range ce.steps {
+		if step.deref {
+			ptrval, err := scope.Thread.readUintRaw(addr, int64(scope.PtrSize()))
+			if err != nil {
+				return nil, err
+			}
+			addr = uintptr(ptrval)
+		}
+		if addr == 0 {
+			return nil, fmt.Errorf("%s is nil", step.name)
+		}
+		if step.slice {
+			ptrSize := int64(scope.PtrSize())
+			base, err := scope.Thread.readUintRaw(addr, ptrSize)
+			if err != nil {
+				return nil, err
+			}
+			n, err := scope.Thread.readIntRaw(addr+uintptr(ptrSize), ptrSize)
+			if err != nil {
+				return nil, err
+			}
+			if step.index >= n {
+				return nil, fmt.Errorf("index %d out of range for %s of length %d", step.index, step.name, n)
+			}
+			addr = uintptr(int64(base) + step.index*step.stride)
+			continue
+		}
+		addr = uintptr(int64(addr) + step.offset)
+	}
+	v, err := newVariable(ce.Name, addr, ce.typ, scope.Thread)
+	if err != nil {
+		return nil, err
+	}
+	err = v.loadValueWithConfig(true, cfg)
+	return v, err
+}
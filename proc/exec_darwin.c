@@ -4,6 +4,7 @@ extern char** environ;
 
 int
 fork_exec(char *argv0, char **argv, int size,
+		char **envp, char *wd, int *stdio,
 		mach_port_name_t *task,
 		mach_port_t *port_set,
 		mach_port_t *exception_port,
@@ -53,8 +54,22 @@ fork_exec(char *argv0, char **argv, int size,
 	pret = ptrace(PT_SIGEXC, 0, 0, 0);
 	if (pret != 0 && errno != 0) return -errno;
 
-	// Create the child process.
-	execve(argv0, argv, environ);
+	// Redirect the standard streams that were provided.
+	for (int i = 0; i < 3; i++) {
+		if (stdio[i] >= 0 && dup2(stdio[i], i) < 0) {
+			exit(1);
+		}
+	}
+
+	// Change into the requested working directory, if any.
+	if (wd != NULL && chdir(wd) < 0) {
+		exit(1);
+	}
+
+	// Create the child process, inheriting our environment
+	// unless one was provided.
+	if (envp == NULL) envp = environ;
+	execve(argv0, argv, envp);
 
 	// We should never reach here, but if we did something went wrong.
 	exit(1);
@@ -0,0 +1,371 @@
+package proc
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"strings"
+)
+
+// MemoryMap is a region of the address space of the process.
+type MemoryMap struct {
+	Start uint64 // First address of the region.
+	End   uint64 // First address past the end of the region.
+	Perms string // Permissions, in the format of /proc/<pid>/maps (i.e. "r-xp").
+	// Path of the file backing the region, or a pseudo path such as
+	// [heap] or [stack]. Empty for anonymous mappings.
+	Path string
+}
+
+// MemoryMaps returns the regions mapped in the address space of the
+// process, in address order.
+func (dbp *Process) MemoryMaps() ([]MemoryMap, error) {
+	return dbp.memoryMaps()
+}
+
+// ClassifyAddress describes what addr points to: the stack of a
+// goroutine ("goroutine 1 stack"), the code of the program ("text"),
+// the Go heap ("heap") on runtimes exposing its bounds, or otherwise
+// the mapping containing it: its backing file, its pseudo path without
+// brackets ("stack" for the stack of the main thread, "heap" for the
+// C heap) or "anonymous mapping", which is where newer runtimes
+// allocate the Go heap. Goroutine stacks are not recognized if the
+// goroutines can not be read.
+func (dbp *Process) ClassifyAddress(addr uint64) (string, error) {
+	if gs, err := dbp.GoroutinesInfo(); err == nil {
+		for _, g := range gs {
+			if addr >= g.StackLo && addr < g.StackHi {
+				return fmt.Sprintf("goroutine %d stack", g.Id), nil
+			}
+		}
+	}
+	if dbp.goSymTable.PCToFunc(addr) != nil {
+		return "text", nil
+	}
+	if lo, hi, err := dbp.heapArena(); err == nil && addr >= lo && addr < hi {
+		return "heap", nil
+	}
+
+	maps, err := dbp.MemoryMaps()
+	if err != nil {
+		return "", err
+	}
+	for _, m := range maps {
+		if addr < m.Start || addr >= m.End {
+			continue
+		}
+		switch {
+		case m.Path == "":
+			return "anonymous mapping", nil
+		case strings.HasPrefix(m.Path, "[") && strings.HasSuffix(m.Path, "]"):
+			return m.Path[1 : len(m.Path)-1], nil
+		default:
+			return m.Path, nil
+		}
+	}
+	return "", fmt.Errorf("address %#x is not mapped", addr)
+}
+
+// Returns the bounds of the arena used for the Go heap, read from
+// runtime.mheap_, in the runtimes that reserve a single one.
+func (dbp *Process) heapArena() (lo, hi uint64, err error) {
+	scope := &EvalScope{Thread: dbp.CurrentThread}
+	mheap, err := scope.packageVarAddr("runtime.mheap_")
+	if err != nil {
+		return 0, 0, err
+	}
+	start, err := mheap.structMember("arena_start")
+	if err != nil {
+		return 0, 0, err
+	}
+	used, err := mheap.structMember("arena_used")
+	if err != nil {
+		return 0, 0, err
+	}
+	if lo, err = dbp.CurrentThread.readUintRaw(start.Addr, int64(dbp.arch.PtrSize())); err != nil {
+		return 0, 0, err
+	}
+	if hi, err = dbp.CurrentThread.readUintRaw(used.Addr, int64(dbp.arch.PtrSize())); err != nil {
+		return 0, 0, err
+	}
+	return lo, hi, nil
+}
+
+// HeapObject describes the heap allocation containing an address, as
+// recorded by the span (runtime.mspan) it was allocated from.
+type HeapObject struct {
+	Base      uint64 // Address of the start of the object.
+	SizeClass int    // Size class of the span, 0 for objects larger than the largest class.
+	ElemSize  uint64 // Size of the objects allocated from the span.
+	SpanStart uint64 // First address of the span.
+	SpanPages uint64 // Number of pages of the span.
+	// Whether the span holds objects without pointers, which the
+	// garbage collector does not scan, only known since Go 1.9, and
+	// whether the object was marked by the last garbage collection,
+	// only known since Go 1.8, which has per span mark bitmaps.
+	NoScan bool
+	Marked bool
+}
+
+// Size of the pages runtime.mheap_ manages spans in.
+const heapPageSize = 8192
+
+// HeapObjectInfo decodes the span metadata of the Go heap for addr,
+// returning the object containing it. Go 1.4 and 1.5 index spans by
+// page from the start of a single arena (mheap_.spans), later versions
+// keep an index per arena (mheap_.arenas).
+func (dbp *Process) HeapObjectInfo(addr uint64) (*HeapObject, error) {
+	scope := &EvalScope{Thread: dbp.CurrentThread}
+	mheap, err := scope.packageVarAddr("runtime.mheap_")
+	if err != nil {
+		return nil, err
+	}
+	var span *Variable
+	if _, err := mheap.structMember("arenas"); err == nil {
+		span, err = dbp.arenaSpan(mheap, addr)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		span, err = dbp.pageSpan(mheap, addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if span.Addr == 0 {
+		return nil, fmt.Errorf("address %#x is not in the Go heap", addr)
+	}
+	ver, _, err := dbp.getGoInformation()
+	if err != nil {
+		return nil, err
+	}
+	return span.heapObject(addr, ver)
+}
+
+// Returns the span for addr in runtimes with a single arena, where
+// mheap_.spans has an entry for every page of the arena.
+func (dbp *Process) pageSpan(mheap *Variable, addr uint64) (*Variable, error) {
+	lo, hi, err := dbp.heapArena()
+	if err != nil {
+		return nil, err
+	}
+	if addr < lo || addr >= hi {
+		return nil, fmt.Errorf("address %#x is not in the Go heap", addr)
+	}
+	spans, err := mheap.structMember("spans")
+	if err != nil {
+		return nil, err
+	}
+	// spans is a **mspan pointing to the array of entries.
+	return spans.spanEntry(addr/heapPageSize - lo/heapPageSize)
+}
+
+// Returns the span for addr in runtimes that map the heap in arenas,
+// each one with its own index of spans by page.
+func (dbp *Process) arenaSpan(mheap *Variable, addr uint64) (*Variable, error) {
+	arenas, err := mheap.structMember("arenas")
+	if err != nil {
+		return nil, err
+	}
+	// arenas is a [1 << arenaL1Bits]*[1 << arenaL2Bits]*heapArena.
+	l1, ok := arenas.resolveTypedefs().dwarfType.(*dwarf.ArrayType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for mheap_.arenas", arenas.dwarfType)
+	}
+	l2ptr, ok := resolveTypedefs(l1.Type).(*dwarf.PtrType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for mheap_.arenas", arenas.dwarfType)
+	}
+	l2, ok := resolveTypedefs(l2ptr.Type).(*dwarf.ArrayType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for mheap_.arenas", arenas.dwarfType)
+	}
+	arenaPtr, ok := resolveTypedefs(l2.Type).(*dwarf.PtrType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for mheap_.arenas", arenas.dwarfType)
+	}
+	arena, ok := resolveTypedefs(arenaPtr.Type).(*dwarf.StructType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for mheap_.arenas", arenas.dwarfType)
+	}
+	var spansField *dwarf.StructField
+	for _, field := range arena.Field {
+		if field.Name == "spans" {
+			spansField = field
+		}
+	}
+	if spansField == nil {
+		return nil, fmt.Errorf("runtime.heapArena has no member spans")
+	}
+	spansArr, ok := resolveTypedefs(spansField.Type).(*dwarf.ArrayType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for heapArena.spans", spansField.Type)
+	}
+	arenaBytes := uint64(spansArr.Count) * heapPageSize
+
+	// Since Go 1.13 arenas are indexed from -1<<47 on amd64, to
+	// cover the negative half of the address space.
+	var baseOffset uint64
+	ver, _, err := dbp.getGoInformation()
+	if err != nil {
+		return nil, err
+	}
+	if ver.AfterOrEqual(GoVersion{1, 13, -1, 0, 0}) {
+		baseOffset = 1 << 47
+	}
+	ri := (addr + baseOffset) / arenaBytes
+	l2len := uint64(l2.Count)
+	if ri/l2len >= uint64(l1.Count) {
+		return nil, fmt.Errorf("address %#x is not in the Go heap", addr)
+	}
+
+	ptrSize := uint64(dbp.arch.PtrSize())
+	l2addr, err := dbp.CurrentThread.readUintRaw(uintptr(uint64(arenas.Addr)+(ri/l2len)*ptrSize), int64(ptrSize))
+	if err != nil {
+		return nil, err
+	}
+	if l2addr == 0 {
+		return nil, fmt.Errorf("address %#x is not in the Go heap", addr)
+	}
+	arenaAddr, err := dbp.CurrentThread.readUintRaw(uintptr(l2addr+(ri%l2len)*ptrSize), int64(ptrSize))
+	if err != nil {
+		return nil, err
+	}
+	if arenaAddr == 0 {
+		return nil, fmt.Errorf("address %#x is not in the Go heap", addr)
+	}
+	spans, err := newVariable("", uintptr(int64(arenaAddr)+spansField.ByteOffset), spansField.Type, dbp.CurrentThread)
+	if err != nil {
+		return nil, err
+	}
+	return spans.spanEntry((addr / heapPageSize) % uint64(spansArr.Count))
+}
+
+// Returns the *mspan at index i of v, either an array of them or a
+// pointer to one.
+func (v *Variable) spanEntry(i uint64) (*Variable, error) {
+	ptrSize := uint64(v.thread.dbp.arch.PtrSize())
+	base := uint64(v.Addr)
+	var elemType dwarf.Type
+	switch t := v.resolveTypedefs().dwarfType.(type) {
+	case *dwarf.ArrayType:
+		elemType = t.Type
+	case *dwarf.PtrType:
+		var err error
+		if base, err = v.readUintRaw(int64(ptrSize)); err != nil {
+			return nil, err
+		}
+		elemType = t.Type
+	default:
+		return nil, fmt.Errorf("unexpected type %s for the spans index", v.dwarfType)
+	}
+	spanPtr, ok := resolveTypedefs(elemType).(*dwarf.PtrType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for the spans index", v.dwarfType)
+	}
+	spanAddr, err := v.thread.readUintRaw(uintptr(base+i*ptrSize), int64(ptrSize))
+	if err != nil {
+		return nil, err
+	}
+	return newVariable("span", uintptr(spanAddr), spanPtr.Type, v.thread)
+}
+
+// Layout of runtime.mspan, which depends on the version of the runtime.
+type mspanLayout struct {
+	startAddr bool   // The span starts at startAddr (Go 1.7), rather than at page start.
+	inUse     uint64 // Value of state for spans of allocated objects: 1 since Go 1.10, 0 before.
+	spanclass bool   // Size class and noscan bit packed in spanclass (Go 1.9), rather than sizeclass.
+	markBits  bool   // Per span mark bitmap in gcmarkBits (Go 1.8).
+}
+
+func mspanLayoutFor(ver GoVersion) mspanLayout {
+	after := func(minor int) bool {
+		return ver.IsDevel() || ver.AfterOrEqual(GoVersion{1, minor, -1, 0, 0})
+	}
+	l := mspanLayout{
+		startAddr: after(7),
+		markBits:  after(8),
+		spanclass: after(9),
+	}
+	if after(10) {
+		l.inUse = 1
+	}
+	return l
+}
+
+// Decodes the runtime.mspan v for an address it contains, the fields of
+// the span are read as laid out by the runtime version ver.
+func (v *Variable) heapObject(addr uint64, ver GoVersion) (*HeapObject, error) {
+	readField := func(name string, size int64) (uint64, error) {
+		field, err := v.structMember(name)
+		if err != nil {
+			return 0, err
+		}
+		return v.thread.readUintRaw(field.Addr, size)
+	}
+	ptrSize := int64(v.thread.dbp.arch.PtrSize())
+	layout := mspanLayoutFor(ver)
+
+	var (
+		obj HeapObject
+		err error
+	)
+	if layout.startAddr {
+		if obj.SpanStart, err = readField("startAddr", ptrSize); err != nil {
+			return nil, err
+		}
+	} else {
+		page, err := readField("start", ptrSize)
+		if err != nil {
+			return nil, err
+		}
+		obj.SpanStart = page * heapPageSize
+	}
+	// The state is a single byte, possibly boxed in a struct.
+	state, err := readField("state", 1)
+	if err != nil {
+		return nil, err
+	}
+	if state != layout.inUse {
+		return nil, fmt.Errorf("address %#x is not in an allocated span", addr)
+	}
+	if layout.spanclass {
+		spanclass, err := readField("spanclass", 1)
+		if err != nil {
+			return nil, err
+		}
+		obj.SizeClass = int(spanclass >> 1)
+		obj.NoScan = spanclass&1 != 0
+	} else {
+		sizeclass, err := readField("sizeclass", 1)
+		if err != nil {
+			return nil, err
+		}
+		obj.SizeClass = int(sizeclass)
+	}
+	if obj.SpanPages, err = readField("npages", ptrSize); err != nil {
+		return nil, err
+	}
+	if obj.ElemSize, err = readField("elemsize", ptrSize); err != nil {
+		return nil, err
+	}
+	if addr < obj.SpanStart || addr >= obj.SpanStart+obj.SpanPages*heapPageSize || obj.ElemSize == 0 {
+		return nil, fmt.Errorf("address %#x is not in an allocated span", addr)
+	}
+	index := (addr - obj.SpanStart) / obj.ElemSize
+	obj.Base = obj.SpanStart + index*obj.ElemSize
+
+	if layout.markBits {
+		markBits, err := readField("gcmarkBits", ptrSize)
+		if err != nil {
+			return nil, err
+		}
+		if markBits != 0 {
+			b, err := v.thread.readUintRaw(uintptr(markBits+index/8), 1)
+			if err != nil {
+				return nil, err
+			}
+			obj.Marked = b&(1<<(index%8)) != 0
+		}
+	}
+	return &obj, nil
+}
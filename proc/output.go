@@ -0,0 +1,82 @@
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// OutputMatchError is returned by Continue when the process
+// was stopped because a watched output stream printed a line
+// matching the watcher's pattern. If the process stopped at a
+// breakpoint at the same time, or the line was printed during another
+// operation such as Next or Step, that operation completes and the
+// next call resuming the process, Continue or any other, returns the
+// error without resuming it.
+type OutputMatchError struct {
+	Line string
+}
+
+func (e OutputMatchError) Error() string {
+	return fmt.Sprintf("process stopped after printing %q", e.Line)
+}
+
+// outputWatchers tracks the streams being watched by WatchOutput
+// and the matching line that has not been reported yet.
+type outputWatchers struct {
+	mu       sync.Mutex
+	readers  []io.Closer
+	match    string
+	hasMatch bool
+}
+
+// WatchOutput reads lines from r, usually the read end of a pipe
+// whose write end was passed as LaunchConfig.Stdout or Stderr, and
+// copies them to w if it is not nil. When a line matches pattern the
+// process is asked to stop and Continue returns an OutputMatchError,
+// see its description.
+// The watcher exits when r does, which is when the process exits or
+// is killed, as r is closed at that point.
+func (dbp *Process) WatchOutput(r io.ReadCloser, w io.Writer, pattern *regexp.Regexp) {
+	dbp.output.mu.Lock()
+	dbp.output.readers = append(dbp.output.readers, r)
+	dbp.output.mu.Unlock()
+
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if w != nil {
+				fmt.Fprintln(w, line)
+			}
+			if !pattern.MatchString(line) {
+				continue
+			}
+			dbp.output.mu.Lock()
+			dbp.output.match, dbp.output.hasMatch = line, true
+			dbp.output.mu.Unlock()
+			dbp.RequestManualStop()
+		}
+	}()
+}
+
+// Returns the last matching line printed since the previous call, if any.
+func (dbp *Process) takeOutputMatch() (string, bool) {
+	dbp.output.mu.Lock()
+	defer dbp.output.mu.Unlock()
+	line, ok := dbp.output.match, dbp.output.hasMatch
+	dbp.output.match, dbp.output.hasMatch = "", false
+	return line, ok
+}
+
+// Closes every watched stream, terminating the watcher goroutines.
+func (dbp *Process) stopOutputWatchers() {
+	dbp.output.mu.Lock()
+	defer dbp.output.mu.Unlock()
+	for _, r := range dbp.output.readers {
+		r.Close()
+	}
+	dbp.output.readers = nil
+}
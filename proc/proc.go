@@ -1,6 +1,7 @@
 package proc
 
 import (
+	"bytes"
 	"debug/dwarf"
 	"debug/gosym"
 	"encoding/binary"
@@ -8,8 +9,11 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	sys "golang.org/x/sys/unix"
 
@@ -29,18 +33,41 @@ type Process struct {
 	// Maps instruction address to Breakpoint struct.
 	Breakpoints map[uint64]*Breakpoint
 
+	// Hardware watchpoints, mapped by the address of the watched memory.
+	Watchpoints map[uint64]*Watchpoint
+
 	// List of threads mapped as such: pid -> *Thread
 	Threads map[int]*Thread
 
 	// Active thread
 	CurrentThread *Thread
 
+	// Breakpoints removed by the last Detach, they can be set again with
+	// RestoreBreakpoints after attaching to the process again.
+	DetachedBreakpoints []*Breakpoint
+
+	// How long to wait for the process to stop when continuing, halting
+	// or stepping it before giving up with a WaitTimeoutError. Zero
+	// means waiting forever.
+	WaitTimeout time.Duration
+
+	// Import path prefixes of the packages StepUserCode and NextUserCode
+	// do not stop in, i.e. "runtime" or "github.com/user/project/vendor/".
+	SkipPackages []string
+
+	// Whether StepInto steps into the functions of the runtime, instead
+	// of over them.
+	StepIntoRuntime bool
+
 	// Goroutine that will be used by default to set breakpoint, eval variables, etc...
 	// Normally SelectedGoroutine is CurrentThread.GetG, it will not be only if SwitchGoroutine is called with a goroutine that isn't attached to a thread
 	SelectedGoroutine *G
 
+	launch                  *launchInfo // Nil if the process was attached to.
 	allGCache               []*G
+	linkOffsets             map[string]int64 // Offset of the link field of runtime._defer and runtime._panic.
 	dwarf                   *dwarf.Data
+	debugLoc                []byte // Location lists of the variables of optimized functions.
 	goSymTable              *gosym.Table
 	frameEntries            frame.FrameDescriptionEntries
 	lineInfo                line.DebugLines
@@ -52,23 +79,72 @@ type Process struct {
 	tempBreakpointIDCounter int
 	halt                    bool
 	exited                  bool
+	followFork              bool
+	forked                  *ProcessForkError // Fork reported by trapWait, returned by Continue.
 	ptraceChan              chan func()
 	ptraceDoneChan          chan interface{}
+	output                  outputWatchers
+	runState                runState
+}
+
+// How the process was launched, Restart launches it again the same way.
+type launchInfo struct {
+	cmd    []string
+	config *LaunchConfig
+	path   string      // Path of the executable.
+	exe    os.FileInfo // Executable at launch time, nil if it could not be read.
+}
+
+// Tracks the execution control operation (Continue, Next, Step) in
+// progress, if any, for Running and WaitStopped.
+type runState struct {
+	mu      sync.Mutex
+	running bool
+	stopped chan struct{} // Closed when the operation returns.
 }
 
 func New(pid int) *Process {
-	dbp := &Process{
+	dbp := newProcess(pid, make(chan func()), make(chan interface{}))
+	go dbp.handlePtraceFuncs()
+	return dbp
+}
+
+// Returns a Process sending its ptrace requests to the given channels,
+// which must be served by the thread tracing it.
+func newProcess(pid int, ptraceChan chan func(), ptraceDoneChan chan interface{}) *Process {
+	return &Process{
 		Pid:            pid,
 		Threads:        make(map[int]*Thread),
 		Breakpoints:    make(map[uint64]*Breakpoint),
+		Watchpoints:    make(map[uint64]*Watchpoint),
 		firstStart:     true,
 		os:             new(OSProcessDetails),
 		ast:            source.New(),
-		ptraceChan:     make(chan func()),
-		ptraceDoneChan: make(chan interface{}),
+		ptraceChan:     ptraceChan,
+		ptraceDoneChan: ptraceDoneChan,
 	}
-	go dbp.handlePtraceFuncs()
-	return dbp
+}
+
+// LaunchConfig holds the optional settings applied to the
+// child process before it is exec'd.
+type LaunchConfig struct {
+	// Env is the environment of the new process, in the "key=value"
+	// form. If nil the debugger's own environment is inherited.
+	Env []string
+	// WorkingDir is the working directory of the new process.
+	// If empty the debugger's working directory is inherited.
+	WorkingDir string
+	// Stdin, Stdout and Stderr are the standard streams of the new
+	// process. If nil, stdin is inherited on Darwin and read from the
+	// null device on Linux, while stdout and stderr are the debugger's own.
+	Stdin, Stdout, Stderr *os.File
+}
+
+// Create and begin debugging a new process. First entry in
+// `cmd` is the program to run, and then rest are the arguments
+// to be supplied to that process.
+func Launch(cmd []string) (*Process, error) {
+	return LaunchWithConfig(cmd, nil)
 }
 
 // ProcessExitedError indicates that the process has exited and contains both
@@ -82,6 +158,50 @@ func (pe ProcessExitedError) Error() string {
 	return fmt.Sprintf("Process %d has exited with status %d", pe.Pid, pe.Status)
 }
 
+// ProcessExecError is returned by Continue when the process replaced its
+// image calling exec. The process is stopped at the entry point of the
+// new executable, whose symbols are loaded. Breakpoints set in the old
+// image are removed and listed in Breakpoints, they can be set again
+// with RestoreBreakpoints.
+type ProcessExecError struct {
+	Pid         int
+	Path        string
+	Breakpoints []*Breakpoint
+}
+
+func (pe ProcessExecError) Error() string {
+	return fmt.Sprintf("Process %d has executed %s", pe.Pid, pe.Path)
+}
+
+// ProcessForkError is returned by Continue, if SetFollowFork was used to
+// enable it, when the process created a new one calling fork or vfork.
+// Child is a handle for the new process, stopped at its start and traced
+// through the same thread as its parent: to keep debugging only one of
+// them the other must be detached. After fork the child has a copy of
+// the breakpoints of the parent, which Detach removes, after vfork the
+// child shares the memory of its parent until it calls exec or exits so
+// it has no breakpoints of its own.
+type ProcessForkError struct {
+	Pid   int
+	Child *Process
+	Vfork bool
+}
+
+func (pe ProcessForkError) Error() string {
+	return fmt.Sprintf("Process %d has forked child %d", pe.Pid, pe.Child.Pid)
+}
+
+// WaitTimeoutError is returned when the process did not stop within
+// Process.WaitTimeout. Threads that did not stop are left running and
+// can be stopped with Halt.
+type WaitTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e WaitTimeoutError) Error() string {
+	return fmt.Sprintf("process did not stop within %s", e.Timeout)
+}
+
 // Detach from the process being debugged, optionally killing it.
 func (dbp *Process) Detach(kill bool) (err error) {
 	if dbp.Running() {
@@ -90,18 +210,28 @@ func (dbp *Process) Detach(kill bool) (err error) {
 		}
 	}
 	if !kill {
-		// Clean up any breakpoints we've set.
+		// Clean up any breakpoints we've set, remembering the
+		// user's ones so they can be restored after attaching again.
+		dbp.DetachedBreakpoints = nil
 		for _, bp := range dbp.Breakpoints {
 			if bp != nil {
 				_, err := dbp.ClearBreakpoint(bp.Addr)
 				if err != nil {
 					return err
 				}
+				if !bp.Temp {
+					dbp.DetachedBreakpoints = append(dbp.DetachedBreakpoints, bp)
+				}
+			}
+		}
+		for _, wp := range dbp.Watchpoints {
+			if _, err := dbp.ClearWatchpoint(uintptr(wp.Addr)); err != nil {
+				return err
 			}
 		}
 	}
 	dbp.execPtraceFunc(func() {
-		err = PtraceDetach(dbp.Pid, 0)
+		err = dbp.detach()
 		if err != nil {
 			return
 		}
@@ -112,6 +242,75 @@ func (dbp *Process) Detach(kill bool) (err error) {
 	return
 }
 
+// Restart kills the process, unless it has already exited, and launches
+// its executable again with the same arguments and LaunchConfig. The
+// breakpoints, except for temporary ones, are set in the new process
+// keeping their ID, their settings and, unless resetHitCounts is true,
+// their HitCount. They are set at the same address if the executable
+// did not change since it was launched, otherwise at the same file and
+// line. Returns the new process, also when one of the breakpoints can
+// not be set.
+func (dbp *Process) Restart(resetHitCounts bool) (*Process, error) {
+	if dbp.launch == nil {
+		return nil, fmt.Errorf("can not restart a process the debugger did not launch")
+	}
+	f, err := os.Open(dbp.launch.path)
+	if err != nil {
+		return nil, fmt.Errorf("could not restart: %s", err)
+	}
+	exe, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not restart: %s", err)
+	}
+	same := dbp.launch.exe != nil && os.SameFile(exe, dbp.launch.exe) &&
+		exe.Size() == dbp.launch.exe.Size() && exe.ModTime().Equal(dbp.launch.exe.ModTime())
+
+	if !dbp.exited && dbp.Running() {
+		if err := dbp.Halt(); err != nil {
+			return nil, err
+		}
+		if err := dbp.WaitStopped(0); err != nil {
+			return nil, err
+		}
+	}
+	if err := dbp.Kill(); err != nil {
+		return nil, err
+	}
+
+	p, err := LaunchWithConfig(dbp.launch.cmd, dbp.launch.config)
+	if err != nil {
+		return nil, err
+	}
+	for _, old := range dbp.ListBreakpoints(false) {
+		addr := old.Addr
+		if !same {
+			if addr, err = p.FindFileLocation(old.File, old.Line); err != nil {
+				return p, err
+			}
+		}
+		bp, err := p.setBreakpointFrom(old, addr, old.ID)
+		if err != nil {
+			if bpe, exists := err.(BreakpointExistsError); exists && bpe.Breakpoint.ID == old.ID {
+				// Another physical breakpoint of the same line.
+				continue
+			}
+			return p, err
+		}
+		if !resetHitCounts {
+			bp.HitCount = old.HitCount
+		}
+	}
+	p.breakpointIDCounter = dbp.breakpointIDCounter
+	return p, nil
+}
+
+// Remembers how the process was launched for Restart.
+func (dbp *Process) setLaunchInfo(cmd []string, config *LaunchConfig, path string) {
+	dbp.launch = &launchInfo{cmd: cmd, config: config, path: path}
+	dbp.launch.exe, _ = os.Stat(path)
+}
+
 // Returns whether or not Delve thinks the debugged
 // process has exited.
 func (dbp *Process) Exited() bool {
@@ -119,8 +318,15 @@ func (dbp *Process) Exited() bool {
 }
 
 // Returns whether or not Delve thinks the debugged
-// process is currently executing.
+// process is currently executing: from the start of Continue, Next or
+// Step until they return, or while threads are left running after a
+// WaitTimeoutError. It is safe to call while the process is running.
 func (dbp *Process) Running() bool {
+	dbp.runState.mu.Lock()
+	defer dbp.runState.mu.Unlock()
+	if dbp.runState.running {
+		return true
+	}
 	for _, th := range dbp.Threads {
 		if th.running {
 			return true
@@ -129,6 +335,28 @@ func (dbp *Process) Running() bool {
 	return false
 }
 
+// WaitStopped blocks until the Continue, Next or Step in progress, if
+// any, returns with the process stopped, or until timeout elapses, in
+// which case it returns a WaitTimeoutError. Zero means waiting forever.
+func (dbp *Process) WaitStopped(timeout time.Duration) error {
+	dbp.runState.mu.Lock()
+	running, stopped := dbp.runState.running, dbp.runState.stopped
+	dbp.runState.mu.Unlock()
+	if !running {
+		return nil
+	}
+	if timeout <= 0 {
+		<-stopped
+		return nil
+	}
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(timeout):
+		return WaitTimeoutError{Timeout: timeout}
+	}
+}
+
 // Finds the executable and then uses it
 // to parse the following information:
 // * Dwarf .debug_frame section
@@ -141,6 +369,7 @@ func (dbp *Process) LoadInformation(path string) error {
 	if err != nil {
 		return err
 	}
+	dbp.linkOffsets = nil
 
 	wg.Add(3)
 	go dbp.parseDebugFrame(exe, &wg)
@@ -197,6 +426,109 @@ func (dbp *Process) FindFunctionLocation(funcName string, firstLine bool, lineOf
 	return fn.Entry, nil
 }
 
+// SetBreakpointByLocation sets a breakpoint at loc, which is one of:
+//
+//	file:line   a line of a source file, the file can be given as a
+//	            path relative to any directory, i.e. "main.go:17"
+//	function    the first line after the prologue of a function, given
+//	            by its full name or by a suffix of it, i.e. "main.main"
+//	*address    an address, i.e. "*0x401000"
+func (dbp *Process) SetBreakpointByLocation(loc string) (*Breakpoint, error) {
+	addr, err := dbp.findLocation(loc)
+	if err != nil {
+		return nil, err
+	}
+	return dbp.SetBreakpoint(addr)
+}
+
+// Resolves loc, in one of the formats accepted by SetBreakpointByLocation,
+// to an address.
+func (dbp *Process) findLocation(loc string) (uint64, error) {
+	if strings.HasPrefix(loc, "*") {
+		addr, err := strconv.ParseUint(loc[1:], 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid address %q", loc[1:])
+		}
+		return addr, nil
+	}
+
+	if i := strings.LastIndex(loc, ":"); i >= 0 {
+		line, err := strconv.Atoi(loc[i+1:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid line number %q", loc[i+1:])
+		}
+		file, err := dbp.findSourceFile(loc[:i])
+		if err != nil {
+			return 0, err
+		}
+		addr, _, err := dbp.goSymTable.LineToPC(file, line)
+		if err != nil {
+			return 0, fmt.Errorf("could not find %s:%d", file, line)
+		}
+		return addr, nil
+	}
+
+	name := loc
+	if dbp.goSymTable.LookupFunc(loc) == nil {
+		var matches []string
+		for _, fn := range dbp.goSymTable.Funcs {
+			if strings.HasSuffix(fn.Name, "."+loc) || strings.HasSuffix(fn.Name, "/"+loc) {
+				matches = append(matches, fn.Name)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return 0, fmt.Errorf("could not find function %s", loc)
+		case 1:
+			name = matches[0]
+		default:
+			return 0, fmt.Errorf("%s is ambiguous: %s", loc, strings.Join(matches, ", "))
+		}
+	}
+	return dbp.FindFunctionLocation(name, true, 0)
+}
+
+// Returns the path of the source file of the program ending with file.
+func (dbp *Process) findSourceFile(file string) (string, error) {
+	if _, ok := dbp.goSymTable.Files[file]; ok {
+		return file, nil
+	}
+	var matches []string
+	for path := range dbp.goSymTable.Files {
+		if strings.HasSuffix(path, "/"+file) {
+			matches = append(matches, path)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("could not find file %s", file)
+	case 1:
+		return matches[0], nil
+	default:
+		sort.Strings(matches)
+		return "", fmt.Errorf("%s is ambiguous: %s", file, strings.Join(matches, ", "))
+	}
+}
+
+// SetBreakpointAtLineOffset sets a breakpoint on the line n lines after
+// the one the current thread is stopped at, which must belong to the
+// same function.
+func (dbp *Process) SetBreakpointAtLineOffset(n int) (*Breakpoint, error) {
+	loc, err := dbp.CurrentThread.Location()
+	if err != nil {
+		return nil, err
+	}
+	if loc.Fn == nil {
+		return nil, fmt.Errorf("could not find function for %#x", loc.PC)
+	}
+	line := loc.Line + n
+	addr, _, err := dbp.goSymTable.LineToPC(loc.File, line)
+	if err != nil || addr < loc.Fn.Entry || addr >= loc.Fn.End {
+		return nil, fmt.Errorf("%s:%d is not a line of %s", loc.File, line, loc.Fn.Name)
+	}
+	return dbp.SetBreakpoint(addr)
+}
+
 // Sends out a request that the debugged process halt
 // execution. Sends SIGSTOP to all threads.
 func (dbp *Process) RequestManualStop() error {
@@ -211,11 +543,167 @@ func (dbp *Process) SetBreakpoint(addr uint64) (*Breakpoint, error) {
 	return dbp.setBreakpoint(dbp.CurrentThread.Id, addr, false)
 }
 
-// Sets a temp breakpoint, for the 'next' command.
+// Sets again breakpoints removed by Detach, usually the DetachedBreakpoints
+// of the Process used before attaching again. Breakpoints are resolved as
+// breakpointAddr does and keep their tracepoint settings. They keep their
+// ID too unless a breakpoint of dbp already has it, then they get a new
+// one, shared by the breakpoints that had the same ID. Returns the
+// breakpoints that were set, DetachedBreakpoints of dbp is cleared once
+// they all are.
+func (dbp *Process) RestoreBreakpoints(bps []*Breakpoint) ([]*Breakpoint, error) {
+	restored := make([]*Breakpoint, 0, len(bps))
+	ids := make(map[int]int)
+	for _, old := range bps {
+		addr, err := dbp.breakpointAddr(old)
+		if err != nil {
+			return restored, err
+		}
+		id, ok := ids[old.ID]
+		if !ok {
+			id = old.ID
+			if dbp.breakpointIDInUse(id) {
+				id = dbp.breakpointIDCounter + 1
+			}
+		}
+		bp, err := dbp.setBreakpointFrom(old, addr, id)
+		if err != nil {
+			return restored, err
+		}
+		ids[old.ID] = id
+		restored = append(restored, bp)
+	}
+	dbp.DetachedBreakpoints = nil
+	return restored, nil
+}
+
+// Returns the address of old, a breakpoint of another process, in dbp:
+// its own address if that is still in the same function and line, as it
+// is when the executable did not change, otherwise the same offset from
+// the entry of its function if that is still on the same line, i.e. for
+// a breakpoint set past the prologue, and the first address of the line
+// as a last resort.
+func (dbp *Process) breakpointAddr(old *Breakpoint) (uint64, error) {
+	if f, l, fn := dbp.goSymTable.PCToLine(old.Addr); fn != nil && fn.Name == old.FunctionName && f == old.File && l == old.Line {
+		return old.Addr, nil
+	}
+	if fn := dbp.goSymTable.LookupFunc(old.FunctionName); fn != nil && fn.Entry+old.fnOffset < fn.End {
+		addr := fn.Entry + old.fnOffset
+		if f, l, _ := dbp.goSymTable.PCToLine(addr); f == old.File && l == old.Line {
+			return addr, nil
+		}
+	}
+	return dbp.FindFileLocation(old.File, old.Line)
+}
+
+// Reports whether a breakpoint of dbp, other than a temp one, has the ID.
+func (dbp *Process) breakpointIDInUse(id int) bool {
+	for _, bp := range dbp.Breakpoints {
+		if !bp.Temp && bp.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Sets a breakpoint at addr with the given ID and the tracepoint settings
+// of old, a breakpoint of another process.
+func (dbp *Process) setBreakpointFrom(old *Breakpoint, addr uint64, id int) (*Breakpoint, error) {
+	bp, err := dbp.setBreakpointWithID(dbp.CurrentThread.Id, addr, false, id)
+	if err != nil {
+		return nil, err
+	}
+	if id > dbp.breakpointIDCounter {
+		dbp.breakpointIDCounter = id
+	}
+	bp.Tracepoint = old.Tracepoint
+	bp.Stacktrace = old.Stacktrace
+	bp.Goroutine = old.Goroutine
+	bp.Variables = old.Variables
+	bp.Spawn = old.Spawn
+	bp.Cond = old.Cond
+	return bp, nil
+}
+
+// Sets a temp breakpoint: it is only listed by ListBreakpoints(true)
+// and has its own ID sequence. Next and the other stepping functions
+// leave it in place, it is up to the caller to clear it.
 func (dbp *Process) SetTempBreakpoint(addr uint64) (*Breakpoint, error) {
 	return dbp.setBreakpoint(dbp.CurrentThread.Id, addr, true)
 }
 
+// Sets a temp breakpoint for the stepping code, cleared by
+// clearInternalBreakpoints when the step ends.
+func (dbp *Process) setInternalBreakpoint(addr uint64) (*Breakpoint, error) {
+	bp, err := dbp.setBreakpoint(dbp.CurrentThread.Id, addr, true)
+	if err == nil {
+		bp.Internal = true
+	}
+	return bp, err
+}
+
+// FuncPC is an address a source line was compiled to and the function
+// containing it, which for an inlined copy of the line is the function
+// it was inlined into.
+type FuncPC struct {
+	Fn *gosym.Func
+	PC uint64
+}
+
+// LineToPCs returns every address the given file:line was compiled
+// to, including the addresses of the copies of the line inlined into
+// other functions.
+func (dbp *Process) LineToPCs(fileName string, lineno int) ([]FuncPC, error) {
+	if dbp.lineInfo.GetLineInfo(fileName) == nil {
+		return nil, fmt.Errorf("could not find file %s", fileName)
+	}
+	pcs := dbp.lineInfo.AllPCsForFileLineInlined(fileName, lineno)
+	if len(pcs) == 0 {
+		return nil, fmt.Errorf("could not find %s:%d", fileName, lineno)
+	}
+	fpcs := make([]FuncPC, len(pcs))
+	for i, pc := range pcs {
+		fpcs[i] = FuncPC{Fn: dbp.goSymTable.PCToFunc(pc), PC: pc}
+	}
+	return fpcs, nil
+}
+
+// Sets a breakpoint at every address the given file:line was compiled to.
+// The physical breakpoints share a single ID and are reported
+// together as one LineBreakpoint.
+func (dbp *Process) SetLineBreakpoint(fileName string, lineno int) (*LineBreakpoint, error) {
+	if dbp.lineInfo.GetLineInfo(fileName) == nil {
+		return nil, fmt.Errorf("could not find file %s", fileName)
+	}
+	pcs := dbp.lineInfo.AllPCsForFileLine(fileName, lineno)
+	if len(pcs) == 0 {
+		return nil, fmt.Errorf("could not find %s:%d", fileName, lineno)
+	}
+
+	// The ID is only taken once every physical breakpoint is set, a
+	// failure leaves the counter untouched.
+	lbp := &LineBreakpoint{ID: dbp.breakpointIDCounter + 1, File: fileName, Line: lineno}
+	for _, pc := range pcs {
+		bp, err := dbp.setBreakpointWithID(dbp.CurrentThread.Id, pc, false, lbp.ID)
+		if err != nil {
+			dbp.ClearLineBreakpoint(lbp)
+			return nil, err
+		}
+		lbp.Breakpoints = append(lbp.Breakpoints, bp)
+	}
+	dbp.breakpointIDCounter = lbp.ID
+	return lbp, nil
+}
+
+// Clears all the physical breakpoints of a line breakpoint.
+func (dbp *Process) ClearLineBreakpoint(lbp *LineBreakpoint) error {
+	for _, bp := range lbp.Breakpoints {
+		if _, err := dbp.ClearBreakpoint(bp.Addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Clears a breakpoint.
 func (dbp *Process) ClearBreakpoint(addr uint64) (*Breakpoint, error) {
 	bp, ok := dbp.FindBreakpoint(addr)
@@ -232,6 +720,83 @@ func (dbp *Process) ClearBreakpoint(addr uint64) (*Breakpoint, error) {
 	return bp, nil
 }
 
+// SetWatchpoint sets a hardware watchpoint on the size bytes of memory
+// at addr, Continue stops right after a thread accesses them as
+// selected by kind. Size must be 1, 2, 4 or 8 and addr aligned to it.
+// At most 4 watchpoints, one per debug register, can be set at a time.
+func (dbp *Process) SetWatchpoint(addr uintptr, size int, kind WatchKind) (*Watchpoint, error) {
+	if wp, ok := dbp.Watchpoints[uint64(addr)]; ok {
+		return nil, WatchpointExistsError{Watchpoint: wp}
+	}
+	switch size {
+	case 1, 2, 4, 8:
+	default:
+		return nil, InvalidWatchpointError{Addr: uint64(addr), Size: size}
+	}
+	if addr%uintptr(size) != 0 {
+		return nil, InvalidWatchpointError{Addr: uint64(addr), Size: size}
+	}
+	reg := -1
+	for i, used := range dbp.arch.HardwareBreakpointUsage() {
+		if !used {
+			reg = i
+			break
+		}
+	}
+	if reg < 0 {
+		return nil, NoFreeDebugRegisterError{}
+	}
+	data, err := dbp.CurrentThread.readMemory(addr, size)
+	if err != nil {
+		return nil, err
+	}
+	wp := &Watchpoint{Addr: uint64(addr), Size: size, Kind: kind, reg: reg, data: data}
+	dbp.Watchpoints[wp.Addr] = wp
+	if err := dbp.setWatchpoints(dbp.Watchpoints); err != nil {
+		delete(dbp.Watchpoints, wp.Addr)
+		dbp.setWatchpoints(dbp.Watchpoints)
+		return nil, err
+	}
+	dbp.arch.SetHardwareBreakpointUsage(reg, true)
+	dbp.breakpointIDCounter++
+	wp.ID = dbp.breakpointIDCounter
+	return wp, nil
+}
+
+// ClearWatchpoint clears the watchpoint set on the memory at addr.
+func (dbp *Process) ClearWatchpoint(addr uintptr) (*Watchpoint, error) {
+	wp, ok := dbp.Watchpoints[uint64(addr)]
+	if !ok {
+		return nil, NoWatchpointError{addr: uint64(addr)}
+	}
+	// Disable the watchpoint in the debug registers before forgetting
+	// it, so that a failure leaves it both set and known.
+	wps := make(map[uint64]*Watchpoint, len(dbp.Watchpoints))
+	for a, w := range dbp.Watchpoints {
+		if a != wp.Addr {
+			wps[a] = w
+		}
+	}
+	if err := dbp.setWatchpoints(wps); err != nil {
+		dbp.setWatchpoints(dbp.Watchpoints)
+		return nil, err
+	}
+	delete(dbp.Watchpoints, wp.Addr)
+	dbp.arch.SetHardwareBreakpointUsage(wp.reg, false)
+	return wp, nil
+}
+
+// Programs the debug registers of all threads with the given watchpoints.
+// Threads that exited in the meantime are skipped.
+func (dbp *Process) setWatchpoints(wps map[uint64]*Watchpoint) error {
+	for _, th := range dbp.Threads {
+		if err := th.setWatchpoints(wps); err != nil && err != sys.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
+
 // Returns the status of the current main thread context.
 func (dbp *Process) Status() *sys.WaitStatus {
 	return dbp.CurrentThread.Status
@@ -244,21 +809,7 @@ func (dbp *Process) Next() error {
 
 func (dbp *Process) next() (err error) {
 	defer func() {
-		// Always halt process at end of this function.
-		herr := dbp.Halt()
-		// Make sure we clean up the temp breakpoints.
-		cerr := dbp.clearTempBreakpoints()
-		// If we already had an error, return it.
-		if err != nil {
-			return
-		}
-		if herr != nil {
-			err = herr
-			return
-		}
-		if cerr != nil {
-			err = cerr
-		}
+		err = dbp.haltAndClearInternalBreakpoints(err)
 	}()
 
 	// Set breakpoints for any goroutine that is currently
@@ -326,61 +877,334 @@ func (dbp *Process) next() (err error) {
 	}
 }
 
-func (dbp *Process) setChanRecvBreakpoints() (int, error) {
-	var count int
-	allg, err := dbp.GoroutinesInfo()
+// StepOut resumes the process until the function of the current
+// goroutine returns, stopping in its caller at the return address.
+// Fails with NoReturnAddr if the function is at the top of the stack.
+// As for Next, the process also stops if the goroutine hits a
+// breakpoint before returning.
+func (dbp *Process) StepOut() error {
+	return dbp.run(dbp.stepOut)
+}
+
+func (dbp *Process) stepOut() (err error) {
+	ret, err := dbp.CurrentThread.ReturnAddress()
 	if err != nil {
-		return 0, err
+		return err
 	}
-	for _, g := range allg {
-		if g.ChanRecvBlocked() {
-			ret, err := g.chanRecvReturnAddr(dbp)
-			if err != nil {
-				if _, ok := err.(NullAddrError); ok {
-					continue
-				}
-				return 0, err
-			}
-			if _, err = dbp.SetTempBreakpoint(ret); err != nil {
-				return 0, err
-			}
-			count++
-		}
+	g, err := dbp.CurrentThread.GetG()
+	if err != nil {
+		return err
 	}
-	return count, nil
-}
+	regs, err := dbp.CurrentThread.Registers()
+	if err != nil {
+		return err
+	}
+	sp := regs.SP()
 
-// Resume process.
-func (dbp *Process) Continue() error {
-	for _, thread := range dbp.Threads {
-		err := thread.Continue()
-		if err != nil {
-			return fmt.Errorf("could not continue thread %d %s", thread.Id, err)
+	defer func() {
+		err = dbp.haltAndClearInternalBreakpoints(err)
+	}()
+	if _, err = dbp.setInternalBreakpoint(ret); err != nil {
+		if _, exists := err.(BreakpointExistsError); !exists {
+			return
 		}
 	}
-	return dbp.run(func() error {
-		thread, err := dbp.trapWait(-1)
-		if err != nil {
-			return err
-		}
-		if err := dbp.Halt(); err != nil {
-			return err
+
+	for _, th := range dbp.Threads {
+		if err = th.Continue(); err != nil {
+			return
 		}
-		dbp.SwitchThread(thread.Id)
-		loc, err := thread.Location()
+	}
+
+	for {
+		_, err := dbp.trapWait(-1)
 		if err != nil {
 			return err
 		}
-		// Check to see if we hit a runtime.breakpoint
-		if loc.Fn != nil && loc.Fn.Name == "runtime.breakpoint" {
-			// Step twice to get back to user code
-			for i := 0; i < 2; i++ {
-				if err = thread.Step(); err != nil {
-					return err
-				}
+		for _, th := range dbp.Threads {
+			if !th.Stopped() {
+				continue
+			}
+			tg, err := th.GetG()
+			if err != nil {
+				return err
+			}
+			if tg.Id == g.Id {
+				pc, err := th.PC()
+				if err != nil {
+					return err
+				}
+				regs, err := th.Registers()
+				if err != nil {
+					return err
+				}
+				// A recursive call of the function returning to the same
+				// address runs on a deeper frame, keep going.
+				if pc != ret || regs.SP() > sp {
+					return dbp.SwitchThread(th.Id)
+				}
+			}
+			if err = th.Continue(); err != nil {
+				return err
 			}
 		}
-		return nil
+	}
+}
+
+// StepInto steps the selected goroutine to the next source line like
+// Next, but if the current line calls a function it stops in the callee,
+// at the first line after its prologue. Calls to functions of the
+// runtime are stepped over unless StepIntoRuntime is set.
+func (dbp *Process) StepInto() error {
+	return dbp.run(func() error {
+		_, err := dbp.stepLine(func(fn *gosym.Func) bool {
+			return !dbp.StepIntoRuntime && isRuntimeFunc(fn)
+		})
+		return err
+	})
+}
+
+// Single steps the selected goroutine until it reaches a new source line
+// and returns its location. Calls to the functions for which skip
+// returns true are stepped over, other callees are stepped into up to
+// the first line after their prologue. Prologues are never single
+// stepped: they can call runtime.morestack, which does not return to
+// its caller but restarts the function on the new stack.
+func (dbp *Process) stepLine(skip func(*gosym.Func) bool) (*Location, error) {
+	g := dbp.SelectedGoroutine
+	if g == nil {
+		var err error
+		if g, err = dbp.CurrentThread.GetG(); err != nil {
+			return nil, err
+		}
+	}
+	if g.thread == nil {
+		return nil, fmt.Errorf("goroutine %d is not running on a thread", g.Id)
+	}
+	thread := g.thread
+	start, err := thread.Location()
+	if err != nil {
+		return nil, err
+	}
+	if start.Fn != nil {
+		addr, err := dbp.FindFunctionLocation(start.Fn.Name, true, 0)
+		if err == nil && start.PC < addr {
+			if thread, err = dbp.continueGoroutineTo(g, addr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for {
+		loc, err := thread.Location()
+		if err != nil {
+			return nil, err
+		}
+		if bp := thread.CurrentBreakpoint; bp != nil && !bp.Temp {
+			return loc, nil
+		}
+		if loc.Fn != nil && loc.PC == loc.Fn.Entry {
+			if skip(loc.Fn) {
+				if err := dbp.stepOut(); err != nil {
+					return nil, err
+				}
+				thread = dbp.CurrentThread
+				continue
+			}
+			addr, err := dbp.FindFunctionLocation(loc.Fn.Name, true, 0)
+			if err != nil {
+				return nil, err
+			}
+			if addr != loc.PC {
+				if thread, err = dbp.continueGoroutineTo(g, addr); err != nil {
+					return nil, err
+				}
+			}
+			return thread.Location()
+		}
+		if loc.Fn != start.Fn || loc.File != start.File || loc.Line != start.Line {
+			return loc, nil
+		}
+		if err := thread.Step(); err != nil {
+			return nil, err
+		}
+		if thread, err = dbp.followGoroutine(g, thread); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Returns the thread goroutine g is running on after thread, which was
+// running it, was single stepped. If the step parked g the process is
+// resumed until g runs again, a step switching the thread to its system
+// stack keeps g on the thread.
+func (dbp *Process) followGoroutine(g *G, thread *Thread) (*Thread, error) {
+	if tg, err := thread.GetG(); err == nil && tg.Id == g.Id {
+		return thread, nil
+	}
+	ng, err := parseG(thread, g.addr, false)
+	if err != nil {
+		return nil, err
+	}
+	if ng.Id != g.Id {
+		return nil, GoroutineExitingError{goid: g.Id}
+	}
+	// Ignore the bit set while the garbage collector scans the stack.
+	switch ng.Status &^ 0x1000 {
+	case Grunning, Gsyscall, Gcopystack:
+		return thread, nil
+	case Gdead:
+		return nil, GoroutineExitingError{goid: g.Id}
+	}
+	return dbp.continueGoroutineTo(ng, ng.PC)
+}
+
+// Resumes the process until goroutine g reaches addr, through a
+// temporary breakpoint, or stops at any other breakpoint, and returns
+// the thread it stopped on. Threads stopping while running other
+// goroutines are resumed, as in next.
+func (dbp *Process) continueGoroutineTo(g *G, addr uint64) (thread *Thread, err error) {
+	defer func() {
+		err = dbp.haltAndClearInternalBreakpoints(err)
+	}()
+	if _, err = dbp.setInternalBreakpoint(addr); err != nil {
+		if _, exists := err.(BreakpointExistsError); !exists {
+			return
+		}
+	}
+
+	for _, th := range dbp.Threads {
+		if err = th.Continue(); err != nil {
+			return
+		}
+	}
+
+	for {
+		if _, err = dbp.trapWait(-1); err != nil {
+			return
+		}
+		for _, th := range dbp.Threads {
+			if !th.Stopped() {
+				continue
+			}
+			tg, err := th.GetG()
+			if err != nil {
+				return nil, err
+			}
+			if tg.Id == g.Id {
+				return th, dbp.SwitchThread(th.Id)
+			}
+			if err = th.Continue(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Reports whether fn belongs to the runtime or one of its internal
+// packages.
+func isRuntimeFunc(fn *gosym.Func) bool {
+	pkg := fn.PackageName()
+	return pkg == "runtime" || strings.HasPrefix(pkg, "runtime/internal/") || strings.HasPrefix(pkg, "internal/runtime/")
+}
+
+// Halts the process and clears the internal breakpoints at the end of
+// Next or StepOut, returns err or, if it is nil, the first error doing so.
+func (dbp *Process) haltAndClearInternalBreakpoints(err error) error {
+	// Always halt process at end of this function.
+	herr := dbp.Halt()
+	// Make sure we clean up the internal breakpoints.
+	cerr := dbp.clearInternalBreakpoints()
+	// If we already had an error, return it.
+	if err != nil {
+		return err
+	}
+	if herr != nil {
+		return herr
+	}
+	return cerr
+}
+
+func (dbp *Process) setChanRecvBreakpoints() (int, error) {
+	var count int
+	allg, err := dbp.GoroutinesInfo()
+	if err != nil {
+		return 0, err
+	}
+	for _, g := range allg {
+		if g.ChanRecvBlocked() {
+			ret, err := g.chanRecvReturnAddr(dbp)
+			if err != nil {
+				if _, ok := err.(NullAddrError); ok {
+					continue
+				}
+				return 0, err
+			}
+			if _, err = dbp.setInternalBreakpoint(ret); err != nil {
+				return 0, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Resume process.
+func (dbp *Process) Continue() error {
+	return dbp.run(func() error {
+		for {
+			for _, thread := range dbp.Threads {
+				err := thread.Continue()
+				if err != nil && (err == sys.ESRCH || !thread.exists()) {
+					// The thread was killed by a thread resumed before it calling
+					// exec, the event is reported by trapWait.
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("could not continue thread %d %s", thread.Id, err)
+				}
+			}
+			thread, err := dbp.trapWait(-1)
+			if err != nil {
+				return err
+			}
+			if err := dbp.Halt(); err != nil {
+				return err
+			}
+			dbp.SwitchThread(thread.Id)
+			if forked := dbp.forked; forked != nil {
+				dbp.forked = nil
+				return *forked
+			}
+			loc, err := thread.Location()
+			if err != nil {
+				return err
+			}
+			// Check to see if we hit a runtime.breakpoint
+			if loc.Fn != nil && loc.Fn.Name == "runtime.breakpoint" {
+				// Step twice to get back to user code
+				for i := 0; i < 2; i++ {
+					if err = thread.Step(); err != nil {
+						return err
+					}
+				}
+			}
+			if bp := thread.CurrentBreakpoint; bp != nil && !bp.Temp {
+				stop, err := bp.checkCondition(thread)
+				if err == nil && !stop {
+					// Only the hits stopping the process are counted.
+					bp.HitCount--
+					thread.CurrentBreakpoint = nil
+					continue
+				}
+				// The breakpoint is reported first, the next Continue
+				// returns the output match if there is one.
+				return err
+			}
+			if line, ok := dbp.takeOutputMatch(); ok {
+				return OutputMatchError{Line: line}
+			}
+			return nil
+		}
 	})
 }
 
@@ -401,6 +1225,237 @@ func (dbp *Process) Step() (err error) {
 	return dbp.run(fn)
 }
 
+// StepUserCode steps the selected goroutine to the next source line
+// outside of the packages in SkipPackages. Calls to functions of those
+// packages are stepped over, calls to other functions are stepped into
+// as in StepInto.
+func (dbp *Process) StepUserCode() error {
+	return dbp.run(func() error {
+		loc, err := dbp.stepLine(dbp.skipped)
+		if err != nil {
+			return err
+		}
+		if dbp.skipped(loc.Fn) {
+			_, err = dbp.returnToUserCode()
+		}
+		return err
+	})
+}
+
+// NextUserCode steps over function calls like Next but, if the
+// current goroutine returns to a function of a package in SkipPackages,
+// keeps going until it returns to a function outside of them.
+func (dbp *Process) NextUserCode() error {
+	return dbp.run(func() error {
+		if err := dbp.next(); err != nil {
+			return err
+		}
+		loc, err := dbp.CurrentThread.Location()
+		if err != nil {
+			return err
+		}
+		if dbp.skipped(loc.Fn) {
+			_, err = dbp.returnToUserCode()
+		}
+		return err
+	})
+}
+
+// Steps over the lines of the current goroutine until it leaves the
+// packages in SkipPackages, returns its location.
+func (dbp *Process) returnToUserCode() (*Location, error) {
+	for {
+		dbp.allGCache = nil
+		if err := dbp.next(); err != nil {
+			return nil, err
+		}
+		loc, err := dbp.CurrentThread.Location()
+		if err != nil {
+			return nil, err
+		}
+		if !dbp.skipped(loc.Fn) {
+			return loc, nil
+		}
+	}
+}
+
+// Reports whether fn belongs to one of the packages in SkipPackages.
+func (dbp *Process) skipped(fn *gosym.Func) bool {
+	if fn == nil {
+		return false
+	}
+	pkg := fn.PackageName()
+	for _, prefix := range dbp.SkipPackages {
+		if strings.HasPrefix(pkg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunUntil resumes the process until a thread reaches file:line, through
+// a temporary breakpoint which is removed when the process stops, even
+// if it stopped elsewhere or exited. A breakpoint already set at that
+// address is used as it is and left in place.
+func (dbp *Process) RunUntil(file string, line int) error {
+	addr, _, err := dbp.goSymTable.LineToPC(file, line)
+	if err != nil {
+		return err
+	}
+	if _, err := dbp.setInternalBreakpoint(addr); err != nil {
+		if _, exists := err.(BreakpointExistsError); !exists {
+			return err
+		}
+		return dbp.Continue()
+	}
+	err = dbp.Continue()
+	if dbp.exited {
+		delete(dbp.Breakpoints, addr)
+	} else if _, cerr := dbp.ClearBreakpoint(addr); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Resumes the process until the selected goroutine executes a go
+// statement, stopping at the entry of runtime.newproc, before the new
+// goroutine is created. Returns the function the new goroutine will
+// run. If the process stops anywhere else, for example at a user
+// breakpoint, the returned function is nil.
+func (dbp *Process) StepToNextGoStatement() (*gosym.Func, error) {
+	g, err := dbp.CurrentThread.GetG()
+	if err != nil {
+		return nil, err
+	}
+	newproc := dbp.goSymTable.LookupFunc("runtime.newproc")
+	if newproc == nil {
+		return nil, fmt.Errorf("could not find function runtime.newproc")
+	}
+	bp, err := dbp.setInternalBreakpoint(newproc.Entry)
+	if err != nil {
+		if _, exists := err.(BreakpointExistsError); !exists {
+			return nil, err
+		}
+		bp = dbp.Breakpoints[newproc.Entry]
+	} else {
+		defer dbp.ClearBreakpoint(bp.Addr)
+	}
+
+	for {
+		if err := dbp.Continue(); err != nil {
+			return nil, err
+		}
+		if dbp.CurrentThread.CurrentBreakpoint != bp {
+			return nil, nil
+		}
+		tg, err := dbp.CurrentThread.GetG()
+		if err != nil {
+			return nil, err
+		}
+		if tg.Id == g.Id {
+			return dbp.newprocTarget(true)
+		}
+	}
+}
+
+// Returns the function passed to runtime.newproc by the current thread,
+// which must be stopped either at the entry of newproc or, if atEntry is
+// false, at an instruction calling it.
+func (dbp *Process) newprocTarget(atEntry bool) (*gosym.Func, error) {
+	regs, err := dbp.CurrentThread.Registers()
+	if err != nil {
+		return nil, err
+	}
+	ver, _, err := dbp.getGoInformation()
+	if err != nil {
+		return nil, err
+	}
+	ptrSize := uint64(dbp.arch.PtrSize())
+	var fnval uint64
+	if ver.AfterOrEqual(GoVersion{1, 17, -1, 0, 0}) {
+		// newproc(fn *funcval), passed in AX by the register ABI.
+		fnval, err = regs.DwarfRegister(0)
+	} else {
+		// newproc(siz int32, fn *funcval), passed on the stack. Skip
+		// the (padded) siz argument and, at the entry, the return address.
+		argp := regs.SP() + ptrSize
+		if atEntry {
+			argp += ptrSize
+		}
+		fnval, err = dbp.CurrentThread.readUintRaw(uintptr(argp), int64(ptrSize))
+	}
+	if err != nil {
+		return nil, err
+	}
+	pc, err := dbp.CurrentThread.readUintRaw(uintptr(fnval), int64(ptrSize))
+	if err != nil {
+		return nil, err
+	}
+	fn := dbp.goSymTable.PCToFunc(pc)
+	if fn == nil {
+		return nil, fmt.Errorf("could not find function for %#x", pc)
+	}
+	return fn, nil
+}
+
+// SetBreakpointOnAllGoroutineCreators sets a tracepoint on every go
+// statement of the functions returned by Functions(true), that is on
+// every instruction of user code calling runtime.newproc. The returned
+// breakpoints have Spawn set, when one of them is hit SpawnedFunction
+// returns the function the new goroutine will run.
+//
+// Instructions are not decoded: call instructions are found by looking
+// for the CALL rel32 opcode followed by the displacement of newproc,
+// which is unlikely to appear by chance. Go statements already holding
+// a breakpoint are skipped.
+func (dbp *Process) SetBreakpointOnAllGoroutineCreators() ([]*Breakpoint, error) {
+	newproc := dbp.goSymTable.LookupFunc("runtime.newproc")
+	if newproc == nil {
+		return nil, fmt.Errorf("could not find function runtime.newproc")
+	}
+	const callLen = 5 // CALL rel32
+	var bps []*Breakpoint
+	for _, fn := range dbp.Functions(true) {
+		code, err := dbp.CurrentThread.readInstructions(fn.Entry, int(fn.End-fn.Entry))
+		if err != nil {
+			return bps, err
+		}
+		for i := 0; i+callLen <= len(code); i++ {
+			if code[i] != 0xe8 {
+				continue
+			}
+			pc := fn.Entry + uint64(i)
+			rel := int32(binary.LittleEndian.Uint32(code[i+1:]))
+			if pc+callLen+uint64(int64(rel)) != newproc.Entry {
+				continue
+			}
+			if _, exists := dbp.Breakpoints[pc]; exists {
+				continue
+			}
+			bp, err := dbp.SetBreakpoint(pc)
+			if err != nil {
+				return bps, err
+			}
+			bp.Tracepoint = true
+			bp.Spawn = true
+			bps = append(bps, bp)
+			i += callLen - 1
+		}
+	}
+	return bps, nil
+}
+
+// SpawnedFunction returns the function the goroutine created by the go
+// statement the current thread is stopped at will run. The current
+// breakpoint must be one set by SetBreakpointOnAllGoroutineCreators.
+func (dbp *Process) SpawnedFunction() (*gosym.Func, error) {
+	bp := dbp.CurrentThread.CurrentBreakpoint
+	if bp == nil || !bp.Spawn {
+		return nil, fmt.Errorf("thread %d is not stopped at a go statement", dbp.CurrentThread.Id)
+	}
+	return dbp.newprocTarget(false)
+}
+
 // Change from current thread to the thread specified by `tid`.
 func (dbp *Process) SwitchThread(tid int) error {
 	if th, ok := dbp.Threads[tid]; ok {
@@ -430,6 +1485,8 @@ func (dbp *Process) SwitchGoroutine(gid int) error {
 
 // Returns an array of G structures representing the information
 // Delve cares about from the internal runtime G structure.
+// The list is read once per stop: later calls return the same slice
+// until the process is resumed, or RefreshGoroutinesInfo is called.
 func (dbp *Process) GoroutinesInfo() ([]*G, error) {
 	if dbp.allGCache != nil {
 		return dbp.allGCache, nil
@@ -438,7 +1495,6 @@ func (dbp *Process) GoroutinesInfo() ([]*G, error) {
 	var (
 		threadg = map[int]*Thread{}
 		allg    []*G
-		rdr     = dbp.DwarfReader()
 	)
 
 	for i := range dbp.Threads {
@@ -451,26 +1507,13 @@ func (dbp *Process) GoroutinesInfo() ([]*G, error) {
 		}
 	}
 
-	addr, err := rdr.AddrFor("runtime.allglen")
+	entries, err := dbp.allgEntries()
 	if err != nil {
 		return nil, err
 	}
-	allglenBytes, err := dbp.CurrentThread.readMemory(uintptr(addr), 8)
-	if err != nil {
-		return nil, err
-	}
-	allglen := binary.LittleEndian.Uint64(allglenBytes)
 
-	rdr.Seek(0)
-	allgentryaddr, err := rdr.AddrFor("runtime.allg")
-	if err != nil {
-		return nil, err
-	}
-	faddr, err := dbp.CurrentThread.readMemory(uintptr(allgentryaddr), dbp.arch.PtrSize())
-	allgptr := binary.LittleEndian.Uint64(faddr)
-
-	for i := uint64(0); i < allglen; i++ {
-		g, err := parseG(dbp.CurrentThread, allgptr+(i*uint64(dbp.arch.PtrSize())), true)
+	for _, entry := range entries {
+		g, err := parseG(dbp.CurrentThread, entry, true)
 		if err != nil {
 			return nil, err
 		}
@@ -493,6 +1536,114 @@ func (dbp *Process) GoroutinesInfo() ([]*G, error) {
 	return allg, nil
 }
 
+// Returns the addresses of the entries of runtime.allg, each one
+// holding a pointer to a G.
+func (dbp *Process) allgEntries() ([]uint64, error) {
+	rdr := dbp.DwarfReader()
+	addr, err := rdr.AddrFor("runtime.allglen")
+	if err != nil {
+		return nil, err
+	}
+	allglenBytes, err := dbp.CurrentThread.readMemory(uintptr(addr), 8)
+	if err != nil {
+		return nil, err
+	}
+	allglen := binary.LittleEndian.Uint64(allglenBytes)
+
+	rdr.Seek(0)
+	allgentryaddr, err := rdr.AddrFor("runtime.allg")
+	if err != nil {
+		return nil, err
+	}
+	faddr, err := dbp.CurrentThread.readMemory(uintptr(allgentryaddr), dbp.arch.PtrSize())
+	if err != nil {
+		return nil, err
+	}
+	allgptr := binary.LittleEndian.Uint64(faddr)
+
+	entries := make([]uint64, allglen)
+	for i := range entries {
+		entries[i] = allgptr + uint64(i*dbp.arch.PtrSize())
+	}
+	return entries, nil
+}
+
+// GoroutinesInfoFiltered returns the goroutines of GoroutinesInfo for
+// which pred returns true, i.e. GoroutineStatus(Grunning) or
+// (*G).ChanSendBlocked.
+func (dbp *Process) GoroutinesInfoFiltered(pred func(*G) bool) ([]*G, error) {
+	allg, err := dbp.GoroutinesInfo()
+	if err != nil {
+		return nil, err
+	}
+	var gs []*G
+	for _, g := range allg {
+		if pred(g) {
+			gs = append(gs, g)
+		}
+	}
+	return gs, nil
+}
+
+// GoroutineStatus returns a filter for GoroutinesInfoFiltered selecting
+// the goroutines with one of the given statuses, i.e. Grunnable.
+func GoroutineStatus(statuses ...uint64) func(*G) bool {
+	return func(g *G) bool {
+		for _, status := range statuses {
+			if g.Status == status {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RefreshGoroutinesInfo is like GoroutinesInfo but reads the list of
+// goroutines again, for callers that changed the memory of the process.
+func (dbp *Process) RefreshGoroutinesInfo() ([]*G, error) {
+	dbp.allGCache = nil
+	return dbp.GoroutinesInfo()
+}
+
+// Processors returns the Ps of the runtime scheduler, read from
+// runtime.allp. In older runtimes allp is an array sized for the
+// largest possible GOMAXPROCS, its unused slots are skipped.
+func (dbp *Process) Processors() ([]*P, error) {
+	scope := &EvalScope{Thread: dbp.CurrentThread}
+	allp, err := scope.packageVarAddr("runtime.allp")
+	if err != nil {
+		return nil, err
+	}
+	if allp.fieldType == nil {
+		return nil, fmt.Errorf("unexpected type %s for runtime.allp", allp.dwarfType)
+	}
+
+	var ps []*P
+	for i := int64(0); i < allp.Len; i++ {
+		pptr, err := newVariable("", uintptr(int64(allp.base)+(i*allp.stride)), allp.fieldType, dbp.CurrentThread)
+		if err != nil {
+			return nil, err
+		}
+		paddr, err := dbp.CurrentThread.readUintRaw(pptr.Addr, int64(dbp.arch.PtrSize()))
+		if err != nil {
+			return nil, err
+		}
+		if paddr == 0 {
+			continue
+		}
+		pv, err := pptr.maybeDereference()
+		if err != nil {
+			return nil, err
+		}
+		p, err := pv.parseP()
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
 // Stop all threads.
 func (dbp *Process) Halt() (err error) {
 	for _, th := range dbp.Threads {
@@ -519,6 +1670,12 @@ func (dbp *Process) CurrentBreakpoint() *Breakpoint {
 	return dbp.CurrentThread.CurrentBreakpoint
 }
 
+// CurrentWatchpoint returns the watchpoint the current thread stopped
+// at, if any.
+func (dbp *Process) CurrentWatchpoint() *Watchpoint {
+	return dbp.CurrentThread.CurrentWatchpoint
+}
+
 // Returns a reader for the dwarf data
 func (dbp *Process) DwarfReader() *reader.Reader {
 	return reader.New(dbp.dwarf)
@@ -534,11 +1691,74 @@ func (dbp *Process) Funcs() []gosym.Func {
 	return dbp.goSymTable.Funcs
 }
 
+// Function describes a function of the debugged program.
+type Function struct {
+	Name  string
+	Entry uint64
+	End   uint64
+	// File is the source file defining the function, it is empty
+	// if the symbol table does not contain line information for it.
+	File string
+}
+
+// Functions returns every function of the debugged program in order
+// of entry PC, as Funcs does. If excludeStd is true functions of the
+// runtime and of the standard library, the ones defined in the source
+// tree of the GOROOT the program was built with, are left out.
+func (dbp *Process) Functions(excludeStd bool) []Function {
+	var stdSrc string
+	if excludeStd {
+		stdSrc = dbp.stdSourceDir()
+	}
+	fns := dbp.Funcs()
+	funcs := make([]Function, 0, len(fns))
+	for i := range fns {
+		file, _, _ := dbp.goSymTable.PCToLine(fns[i].Entry)
+		if stdSrc != "" && strings.HasPrefix(file, stdSrc) {
+			continue
+		}
+		funcs = append(funcs, Function{Name: fns[i].Name, Entry: fns[i].Entry, End: fns[i].End, File: file})
+	}
+	return funcs
+}
+
+// Returns the directory containing the source of the standard library
+// the program was built with, i.e. "/usr/local/go/src/", found from the
+// file of runtime.main. Empty if it is not known.
+func (dbp *Process) stdSourceDir() string {
+	fn := dbp.goSymTable.LookupFunc("runtime.main")
+	if fn == nil {
+		return ""
+	}
+	file, _, _ := dbp.goSymTable.PCToLine(fn.Entry)
+	i := strings.LastIndex(file, "/runtime/")
+	if i < 0 {
+		return ""
+	}
+	return file[:i+1]
+}
+
 // Converts an instruction address to a file/line/function.
 func (dbp *Process) PCToLine(pc uint64) (string, int, *gosym.Func) {
 	return dbp.goSymTable.PCToLine(pc)
 }
 
+// ListBreakpoints returns the breakpoints set in the process ordered
+// by ID, physical breakpoints sharing an ID are ordered by address.
+// Temporary breakpoints, used internally by Next, are only returned,
+// after all the others, if includeTemp is true.
+func (dbp *Process) ListBreakpoints(includeTemp bool) []*Breakpoint {
+	bps := make([]*Breakpoint, 0, len(dbp.Breakpoints))
+	for _, bp := range dbp.Breakpoints {
+		if bp.Temp && !includeTemp {
+			continue
+		}
+		bps = append(bps, bp)
+	}
+	sort.Sort(breakpointsByID(bps))
+	return bps
+}
+
 // Finds the breakpoint for the given ID.
 func (dbp *Process) FindBreakpointByID(id int) (*Breakpoint, bool) {
 	for _, bp := range dbp.Breakpoints {
@@ -582,10 +1802,18 @@ func initializeDebugProcess(dbp *Process, path string, attach bool) (*Process, e
 	}
 
 	dbp.Process = proc
-	err = dbp.LoadInformation(path)
-	if err != nil {
+	if err := dbp.loadImage(path); err != nil {
 		return nil, err
 	}
+	return dbp, nil
+}
+
+// Loads the symbols of the executable at path, or of the one the
+// process is running if path is empty, and the threads of the process.
+func (dbp *Process) loadImage(path string) error {
+	if err := dbp.LoadInformation(path); err != nil {
+		return err
+	}
 
 	switch runtime.GOARCH {
 	case "amd64":
@@ -593,12 +1821,12 @@ func initializeDebugProcess(dbp *Process, path string, attach bool) (*Process, e
 	}
 
 	if err := dbp.updateThreadList(); err != nil {
-		return nil, err
+		return err
 	}
 
 	ver, isextld, err := dbp.getGoInformation()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	dbp.arch.SetGStructOffset(ver, isextld)
@@ -607,20 +1835,28 @@ func initializeDebugProcess(dbp *Process, path string, attach bool) (*Process, e
 	// but without calling updateThreadList we can not examine memory to determine
 	// the offset of g struct inside TLS
 	dbp.SelectedGoroutine, _ = dbp.CurrentThread.GetG()
-
-	return dbp, nil
+	return nil
 }
 
-func (dbp *Process) clearTempBreakpoints() error {
+// Removes the internal breakpoints set while stepping, the ones set
+// with SetTempBreakpoint are left alone. Once the process has exited
+// there is no memory left to restore so they are only forgotten.
+// Clearing carries on past failures, the first error is returned.
+func (dbp *Process) clearInternalBreakpoints() error {
+	var err error
 	for _, bp := range dbp.Breakpoints {
-		if !bp.Temp {
+		if !bp.Internal {
 			continue
 		}
-		if _, err := dbp.ClearBreakpoint(bp.Addr); err != nil {
-			return err
+		if dbp.exited {
+			delete(dbp.Breakpoints, bp.Addr)
+			continue
+		}
+		if _, cerr := dbp.ClearBreakpoint(bp.Addr); cerr != nil && err == nil {
+			err = cerr
 		}
 	}
-	return nil
+	return err
 }
 
 func (dbp *Process) handleBreakpointOnThread(id int) (*Thread, error) {
@@ -632,9 +1868,36 @@ func (dbp *Process) handleBreakpointOnThread(id int) (*Thread, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(dbp.Watchpoints) > 0 {
+		hit, stop, err := dbp.handleWatchpointOnThread(thread)
+		if err != nil {
+			return nil, err
+		}
+		if hit && !thread.trapFlag {
+			if !stop {
+				// Tells trapWait to resume the thread.
+				return nil, nil
+			}
+			return thread, nil
+		}
+	}
+	if thread.trapFlag {
+		// The thread stopped after a single instruction, the one at pc,
+		// breakpoint or not, has not been executed yet.
+		if err := thread.restoreLiftedBreakpoint(); err != nil {
+			return nil, err
+		}
+		thread.CurrentBreakpoint = nil
+		if bp, ok := dbp.Breakpoints[pc]; ok {
+			thread.CurrentBreakpoint = bp
+			bp.HitCount++
+		}
+		return thread, nil
+	}
 	// Check to see if we have hit a breakpoint.
 	if bp, ok := dbp.FindBreakpoint(pc); ok {
 		thread.CurrentBreakpoint = bp
+		bp.HitCount++
 		if err = thread.SetPC(bp.Addr); err != nil {
 			return nil, err
 		}
@@ -655,15 +1918,56 @@ func (dbp *Process) handleBreakpointOnThread(id int) (*Thread, error) {
 	return nil, NoBreakpointError{addr: pc}
 }
 
+// Checks whether the thread stopped because of a watchpoint, setting
+// CurrentWatchpoint if it should stop there. A write of memory watched
+// for reads only is a hit the thread should not stop at.
+func (dbp *Process) handleWatchpointOnThread(thread *Thread) (hit, stop bool, err error) {
+	wp, err := thread.watchpointHit()
+	if err != nil || wp == nil {
+		return false, false, err
+	}
+	data, err := thread.readMemory(uintptr(wp.Addr), wp.Size)
+	if err != nil {
+		return true, false, err
+	}
+	written := !bytes.Equal(data, wp.data)
+	wp.data = data
+	if wp.Kind == WatchRead && written {
+		return true, false, nil
+	}
+	thread.CurrentWatchpoint = wp
+	wp.HitCount++
+	return true, true, nil
+}
+
 func (dbp *Process) run(fn func() error) error {
 	dbp.allGCache = nil
 	if dbp.exited {
 		return fmt.Errorf("process has already exited")
 	}
+	if line, ok := dbp.takeOutputMatch(); ok {
+		// The line was printed while the process was stopping, i.e. at
+		// a breakpoint or at the end of a step, report it before
+		// resuming.
+		return OutputMatchError{Line: line}
+	}
 	for _, th := range dbp.Threads {
 		th.CurrentBreakpoint = nil
+		th.CurrentWatchpoint = nil
 	}
+	dbp.runState.mu.Lock()
+	dbp.runState.running, dbp.runState.stopped = true, make(chan struct{})
+	dbp.runState.mu.Unlock()
+	defer func() {
+		dbp.runState.mu.Lock()
+		dbp.runState.running = false
+		close(dbp.runState.stopped)
+		dbp.runState.mu.Unlock()
+	}()
 	if err := fn(); err != nil {
+		if _, exited := err.(ProcessExitedError); exited {
+			dbp.stopOutputWatchers()
+		}
 		return err
 	}
 	return nil
@@ -687,7 +1991,7 @@ func (dbp *Process) execPtraceFunc(fn func()) {
 }
 
 func (dbp *Process) getGoInformation() (ver GoVersion, isextld bool, err error) {
-	vv, err := dbp.EvalPackageVariable("runtime.buildVersion")
+	vv, err := dbp.EvalPackageVariable("runtime.buildVersion", DefaultLoadConfig)
 	if err != nil {
 		err = fmt.Errorf("Could not determine version number: %v\n", err)
 		return
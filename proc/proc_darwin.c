@@ -110,7 +110,7 @@ thread_count(task_t task) {
 }
 
 mach_port_t
-mach_port_wait(mach_port_t port_set) {
+mach_port_wait(mach_port_t port_set, int timeout) {
 	kern_return_t kret;
 	thread_act_t thread;
 	NDR_record_t *ndr;
@@ -121,10 +121,12 @@ mach_port_wait(mach_port_t port_set) {
 		char data[256];
 	} msg;
 
-	// Wait for mach msg.
-	kret = mach_msg(&msg.hdr, MACH_RCV_MSG|MACH_RCV_INTERRUPT,
-			0, sizeof(msg.data), port_set, 0, MACH_PORT_NULL);
-	if (kret == MACH_RCV_INTERRUPTED) return kret;
+	// Wait for mach msg, giving up after timeout milliseconds if positive.
+	mach_msg_option_t opts = MACH_RCV_MSG|MACH_RCV_INTERRUPT;
+	if (timeout > 0) opts |= MACH_RCV_TIMEOUT;
+	kret = mach_msg(&msg.hdr, opts,
+			0, sizeof(msg.data), port_set, timeout, MACH_PORT_NULL);
+	if (kret == MACH_RCV_INTERRUPTED || kret == MACH_RCV_TIMED_OUT) return kret;
 	if (kret != MACH_MSG_SUCCESS) return 0;
 
 	mach_msg_body_t *bod = (mach_msg_body_t*)(&msg.hdr + 1);
@@ -142,7 +144,7 @@ mach_port_wait(mach_port_t port_set) {
 			if (data[2] == EXC_SOFT_SIGNAL) {
 				if (data[3] != SIGTRAP) {
 					if (thread_resume(thread) != KERN_SUCCESS) return 0;
-					return mach_port_wait(port_set);
+					return mach_port_wait(port_set, timeout);
 				}
 			}
 			return thread;
@@ -174,3 +176,19 @@ kern_return_t
 raise_exception(mach_port_t task, mach_port_t thread, mach_port_t exception_port, exception_type_t exception) {
 	return exception_raise(exception_port, thread, task, exception, 0, 0);
 }
+
+kern_return_t
+next_region(task_t task, int pid, mach_vm_address_t *addr, mach_vm_size_t *size, int *prot, char *path, int pathlen) {
+	kern_return_t kret;
+	vm_region_basic_info_data_64_t info;
+	mach_msg_type_number_t count = VM_REGION_BASIC_INFO_COUNT_64;
+	mach_port_t object;
+
+	kret = mach_vm_region(task, addr, size, VM_REGION_BASIC_INFO_64, (vm_region_info_t)&info, &count, &object);
+	if (kret != KERN_SUCCESS) return kret;
+	*prot = info.protection;
+
+	path[0] = '\0';
+	proc_regionfilename(pid, *addr, path, pathlen);
+	return KERN_SUCCESS;
+}
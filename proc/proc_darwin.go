@@ -13,6 +13,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sync"
+	"time"
 	"unsafe"
 
 	"github.com/derekparker/delve/dwarf/frame"
@@ -31,11 +32,15 @@ type OSProcessDetails struct {
 	portSet C.mach_port_t
 }
 
-// Create and begin debugging a new process. Uses a
-// custom fork/exec process in order to take advantage of
+// Create and begin debugging a new process, applying the
+// settings from `config`, which may be nil.
+// Uses a custom fork/exec process in order to take advantage of
 // PT_SIGEXC on Darwin which will turn Unix signals into
 // Mach exceptions.
-func Launch(cmd []string) (*Process, error) {
+func LaunchWithConfig(cmd []string, config *LaunchConfig) (*Process, error) {
+	if config == nil {
+		config = &LaunchConfig{}
+	}
 	argv0Go, err := filepath.Abs(cmd[0])
 	if err != nil {
 		return nil, err
@@ -58,10 +63,36 @@ func Launch(cmd []string) (*Process, error) {
 	// argv array must be null terminated.
 	argvSlice = append(argvSlice, nil)
 
+	// A nil envp tells fork_exec to inherit our environment.
+	var envp **C.char
+	envSlice := make([]*C.char, 0, len(config.Env)+1)
+	if config.Env != nil {
+		for _, kv := range config.Env {
+			envSlice = append(envSlice, C.CString(kv))
+		}
+		envSlice = append(envSlice, nil)
+		envp = &envSlice[0]
+	}
+
+	var wd *C.char
+	if config.WorkingDir != "" {
+		wd = C.CString(config.WorkingDir)
+		defer C.free(unsafe.Pointer(wd))
+	}
+
+	// A negative descriptor tells fork_exec to inherit ours.
+	stdio := [3]C.int{-1, -1, -1}
+	for i, f := range []*os.File{config.Stdin, config.Stdout, config.Stderr} {
+		if f != nil {
+			stdio[i] = C.int(f.Fd())
+		}
+	}
+
 	dbp := New(0)
 	var pid int
 	dbp.execPtraceFunc(func() {
 		ret := C.fork_exec(argv0, &argvSlice[0], C.int(len(argvSlice)),
+			envp, wd, &stdio[0],
 			&dbp.os.task, &dbp.os.portSet, &dbp.os.exceptionPort,
 			&dbp.os.notificationPort)
 		pid = int(ret)
@@ -73,11 +104,15 @@ func Launch(cmd []string) (*Process, error) {
 	for i := range argvSlice {
 		C.free(unsafe.Pointer(argvSlice[i]))
 	}
+	for i := range envSlice {
+		C.free(unsafe.Pointer(envSlice[i]))
+	}
 
 	dbp, err = initializeDebugProcess(dbp, argv0Go, false)
 	if err != nil {
 		return nil, err
 	}
+	dbp.setLaunchInfo(cmd, config, argv0Go)
 	err = dbp.Continue()
 	return dbp, err
 }
@@ -111,15 +146,26 @@ func (dbp *Process) Kill() (err error) {
 		}
 	}
 	for {
-		port := C.mach_port_wait(dbp.os.portSet)
+		port := C.mach_port_wait(dbp.os.portSet, 0)
 		if port == dbp.os.notificationPort {
 			break
 		}
 	}
 	dbp.exited = true
+	dbp.stopOutputWatchers()
 	return
 }
 
+// Detaches from the process, which lets it run again.
+func (dbp *Process) detach() error {
+	return PtraceDetach(dbp.Pid, 0)
+}
+
+// SetFollowFork is not supported on darwin.
+func (dbp *Process) SetFollowFork(enable bool) error {
+	return errors.New("following forks is not supported on darwin")
+}
+
 func (dbp *Process) requestManualStop() (err error) {
 	var (
 		task          = C.mach_port_t(dbp.os.task)
@@ -263,12 +309,55 @@ func (dbp *Process) findExecutable(path string) (*macho.File, error) {
 		return nil, err
 	}
 	dbp.dwarf = data
+	dbp.debugLoc = nil
+	if sec := exe.Section("__debug_loc"); sec != nil {
+		if dbp.debugLoc, err = sec.Data(); err != nil {
+			return nil, err
+		}
+	}
 	return exe, nil
 }
 
+func (dbp *Process) memoryMaps() ([]MemoryMap, error) {
+	var (
+		maps []MemoryMap
+		addr C.mach_vm_address_t
+		size C.mach_vm_size_t
+		prot C.int
+		path [C.PATH_MAX]C.char
+	)
+	for {
+		kret := C.next_region(C.task_t(dbp.os.task), C.int(dbp.Pid), &addr, &size, &prot, &path[0], C.PATH_MAX)
+		if kret == C.KERN_INVALID_ADDRESS {
+			// No regions past addr.
+			return maps, nil
+		}
+		if kret != C.KERN_SUCCESS {
+			return nil, fmt.Errorf("could not read memory regions: %s", C.GoString(C.mach_error_string(C.mach_error_t(kret))))
+		}
+		perms := []byte("---p")
+		if prot&C.VM_PROT_READ != 0 {
+			perms[0] = 'r'
+		}
+		if prot&C.VM_PROT_WRITE != 0 {
+			perms[1] = 'w'
+		}
+		if prot&C.VM_PROT_EXECUTE != 0 {
+			perms[2] = 'x'
+		}
+		maps = append(maps, MemoryMap{
+			Start: uint64(addr),
+			End:   uint64(addr + size),
+			Perms: string(perms),
+			Path:  C.GoString(&path[0]),
+		})
+		addr += size
+	}
+}
+
 func (dbp *Process) trapWait(pid int) (*Thread, error) {
 	for {
-		port := C.mach_port_wait(dbp.os.portSet)
+		port := C.mach_port_wait(dbp.os.portSet, C.int(dbp.WaitTimeout/time.Millisecond))
 
 		switch port {
 		case dbp.os.notificationPort:
@@ -279,6 +368,9 @@ func (dbp *Process) trapWait(pid int) (*Thread, error) {
 			dbp.exited = true
 			return nil, ProcessExitedError{Pid: dbp.Pid, Status: status.ExitStatus()}
 
+		case C.MACH_RCV_TIMED_OUT:
+			return nil, WaitTimeoutError{Timeout: dbp.WaitTimeout}
+
 		case C.MACH_RCV_INTERRUPTED:
 			if !dbp.halt {
 				// Call trapWait again, it seems
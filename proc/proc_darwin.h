@@ -29,6 +29,9 @@ acquire_mach_task(int, mach_port_name_t*, mach_port_t*, mach_port_t*, mach_port_
 char *
 find_executable(int pid);
 
+kern_return_t
+next_region(task_t, int, mach_vm_address_t *, mach_vm_size_t *, int *, char *, int);
+
 kern_return_t
 get_threads(task_t task, void *);
 
@@ -36,7 +39,7 @@ int
 thread_count(task_t task);
 
 mach_port_t
-mach_port_wait(mach_port_t);
+mach_port_wait(mach_port_t, int);
 
 kern_return_t
 mach_send_reply(mach_msg_header_t);
@@ -1,6 +1,7 @@
 package proc
 
 import (
+	"bufio"
 	"debug/elf"
 	"debug/gosym"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -25,25 +27,46 @@ const (
 	STATUS_RUNNING    = 'R'
 	STATUS_TRACE_STOP = 't'
 	STATUS_ZOMBIE     = 'Z'
+	STATUS_DEAD       = 'X'
 )
 
 // Not actually needed for Linux.
 type OSProcessDetails interface{}
 
-// Create and begin debugging a new process. First entry in
-// `cmd` is the program to run, and then rest are the arguments
-// to be supplied to that process.
-func Launch(cmd []string) (*Process, error) {
+// Create and begin debugging a new process, applying the
+// settings from `config`, which may be nil.
+func LaunchWithConfig(cmd []string, config *LaunchConfig) (*Process, error) {
 	var (
 		proc *exec.Cmd
 		err  error
 	)
+	if config == nil {
+		config = &LaunchConfig{}
+	}
 	dbp := New(0)
 	dbp.execPtraceFunc(func() {
 		proc = exec.Command(cmd[0])
 		proc.Args = cmd
+		proc.Env = config.Env
+		if config.WorkingDir != "" {
+			// A relative program path would otherwise be
+			// resolved against the new working directory.
+			if proc.Path, err = filepath.Abs(proc.Path); err != nil {
+				return
+			}
+			proc.Dir = config.WorkingDir
+		}
 		proc.Stdout = os.Stdout
 		proc.Stderr = os.Stderr
+		if config.Stdin != nil {
+			proc.Stdin = config.Stdin
+		}
+		if config.Stdout != nil {
+			proc.Stdout = config.Stdout
+		}
+		if config.Stderr != nil {
+			proc.Stderr = config.Stderr
+		}
 		proc.SysProcAttr = &syscall.SysProcAttr{Ptrace: true, Setpgid: true}
 		err = proc.Start()
 	})
@@ -55,7 +78,11 @@ func Launch(cmd []string) (*Process, error) {
 	if err != nil {
 		return nil, fmt.Errorf("waiting for target execve failed: %s", err)
 	}
-	return initializeDebugProcess(dbp, proc.Path, false)
+	if dbp, err = initializeDebugProcess(dbp, proc.Path, false); err != nil {
+		return nil, err
+	}
+	dbp.setLaunchInfo(cmd, config, proc.Path)
+	return dbp, nil
 }
 
 // Attach to an existing process with the given PID.
@@ -77,9 +104,20 @@ func (dbp *Process) Kill() (err error) {
 		return
 	}
 	dbp.exited = true
+	dbp.stopOutputWatchers()
 	return
 }
 
+// Detaches from every thread of the process, which lets them run again.
+func (dbp *Process) detach() error {
+	for _, th := range dbp.Threads {
+		if err := PtraceDetach(th.Id, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (dbp *Process) requestManualStop() (err error) {
 	return sys.Kill(dbp.Pid, sys.SIGTRAP)
 }
@@ -110,12 +148,12 @@ func (dbp *Process) addThread(tid int, attach bool) (*Thread, error) {
 		}
 	}
 
-	dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, syscall.PTRACE_O_TRACECLONE) })
+	err = dbp.setPtraceOptions(tid)
 	if err == syscall.ESRCH {
 		if _, _, err = wait(tid, dbp.Pid, 0); err != nil {
 			return nil, fmt.Errorf("error while waiting after adding thread: %d %s", tid, err)
 		}
-		dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, syscall.PTRACE_O_TRACECLONE) })
+		err = dbp.setPtraceOptions(tid)
 		if err == syscall.ESRCH {
 			return nil, err
 		}
@@ -132,22 +170,98 @@ func (dbp *Process) addThread(tid int, attach bool) (*Thread, error) {
 	if dbp.CurrentThread == nil {
 		dbp.SwitchThread(tid)
 	}
+	// Debug registers are not inherited by cloned threads.
+	if len(dbp.Watchpoints) > 0 {
+		if err := dbp.Threads[tid].setWatchpoints(dbp.Watchpoints); err != nil {
+			return nil, err
+		}
+	}
 	return dbp.Threads[tid], nil
 }
 
+func (dbp *Process) setPtraceOptions(tid int) (err error) {
+	options := syscall.PTRACE_O_TRACECLONE | syscall.PTRACE_O_TRACEEXEC
+	if dbp.followFork {
+		options |= syscall.PTRACE_O_TRACEFORK | syscall.PTRACE_O_TRACEVFORK
+	}
+	dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, options) })
+	return
+}
+
+// SetFollowFork enables or disables stopping the process when it forks,
+// see ProcessForkError. The process must be stopped.
+func (dbp *Process) SetFollowFork(enable bool) error {
+	dbp.followFork = enable
+	for _, th := range dbp.Threads {
+		if err := dbp.setPtraceOptions(th.Id); err != nil {
+			return fmt.Errorf("could not set options for thread %d %s", th.Id, err)
+		}
+	}
+	return nil
+}
+
+// Returns a Process for the child created by thread tid calling fork or
+// vfork. The child is traced automatically, through the same thread.
+func (dbp *Process) forkedChild(tid int, vfork bool) (*Process, error) {
+	var (
+		cpid uint
+		err  error
+	)
+	dbp.execPtraceFunc(func() { cpid, err = sys.PtraceGetEventMsg(tid) })
+	if err != nil {
+		return nil, fmt.Errorf("could not get event message: %s", err)
+	}
+	// The child starts stopped by a SIGSTOP, which trapWait may have
+	// already collected, and ignored, as it came from an unknown thread.
+	options := 0
+	if status(int(cpid)) == STATUS_TRACE_STOP {
+		options = sys.WNOHANG
+	}
+	if _, _, err := wait(int(cpid), int(cpid), options); err != nil {
+		return nil, fmt.Errorf("waiting for forked child %d failed: %s", cpid, err)
+	}
+
+	child, err := initializeDebugProcess(newProcess(int(cpid), dbp.ptraceChan, dbp.ptraceDoneChan), "", false)
+	if err != nil {
+		return nil, err
+	}
+	if !vfork {
+		// The breakpoints were copied along with the memory.
+		for addr, bp := range dbp.Breakpoints {
+			childbp := *bp
+			child.Breakpoints[addr] = &childbp
+		}
+		child.breakpointIDCounter = dbp.breakpointIDCounter
+		child.tempBreakpointIDCounter = dbp.tempBreakpointIDCounter
+	}
+	return child, nil
+}
+
+// Adds the threads of the process not known yet. When attaching, the
+// threads not traced yet keep running and may clone new ones, so the
+// threads are listed again until no new one shows up.
 func (dbp *Process) updateThreadList() error {
-	tids, _ := filepath.Glob(fmt.Sprintf("/proc/%d/task/*", dbp.Pid))
-	for _, tidpath := range tids {
-		tidstr := filepath.Base(tidpath)
-		tid, err := strconv.Atoi(tidstr)
-		if err != nil {
-			return err
+	for {
+		tids, _ := filepath.Glob(fmt.Sprintf("/proc/%d/task/*", dbp.Pid))
+		added := false
+		for _, tidpath := range tids {
+			tidstr := filepath.Base(tidpath)
+			tid, err := strconv.Atoi(tidstr)
+			if err != nil {
+				return err
+			}
+			if _, ok := dbp.Threads[tid]; ok {
+				continue
+			}
+			if _, err := dbp.addThread(tid, tid != dbp.Pid); err != nil {
+				return err
+			}
+			added = true
 		}
-		if _, err := dbp.addThread(tid, tid != dbp.Pid); err != nil {
-			return err
+		if !added {
+			return nil
 		}
 	}
-	return nil
 }
 
 func (dbp *Process) findExecutable(path string) (*elf.File, error) {
@@ -167,6 +281,12 @@ func (dbp *Process) findExecutable(path string) (*elf.File, error) {
 		return nil, err
 	}
 	dbp.dwarf = data
+	dbp.debugLoc = nil
+	if sec := elfFile.Section(".debug_loc"); sec != nil {
+		if dbp.debugLoc, err = sec.Data(); err != nil {
+			return nil, err
+		}
+	}
 	return elfFile, nil
 }
 
@@ -239,8 +359,11 @@ func (dbp *Process) parseDebugLineInfo(exe *elf.File, wg *sync.WaitGroup) {
 
 func (dbp *Process) trapWait(pid int) (*Thread, error) {
 	for {
-		wpid, status, err := wait(pid, dbp.Pid, 0)
+		wpid, status, err := dbp.waitTimeout(pid)
 		if err != nil {
+			if _, timeout := err.(WaitTimeoutError); timeout {
+				return nil, err
+			}
 			return nil, fmt.Errorf("wait err %s %d", err, pid)
 		}
 		if wpid == 0 {
@@ -287,10 +410,23 @@ func (dbp *Process) trapWait(pid int) (*Thread, error) {
 			}
 			continue
 		}
+		if status.StopSignal() == sys.SIGTRAP && status.TrapCause() == sys.PTRACE_EVENT_EXEC {
+			return nil, dbp.reloadAfterExec()
+		}
 		if th == nil {
 			// Sometimes we get an unknown thread, ignore it?
 			continue
 		}
+		if status.StopSignal() == sys.SIGTRAP && (status.TrapCause() == sys.PTRACE_EVENT_FORK || status.TrapCause() == sys.PTRACE_EVENT_VFORK) {
+			vfork := status.TrapCause() == sys.PTRACE_EVENT_VFORK
+			child, err := dbp.forkedChild(wpid, vfork)
+			if err != nil {
+				return nil, err
+			}
+			th.running = false
+			dbp.forked = &ProcessForkError{Pid: dbp.Pid, Child: child, Vfork: vfork}
+			return th, nil
+		}
 		if status.StopSignal() == sys.SIGTRAP && dbp.halt {
 			th.running = false
 			dbp.halt = false
@@ -298,7 +434,15 @@ func (dbp *Process) trapWait(pid int) (*Thread, error) {
 		}
 		if status.StopSignal() == sys.SIGTRAP {
 			th.running = false
-			return dbp.handleBreakpointOnThread(wpid)
+			stopped, err := dbp.handleBreakpointOnThread(wpid)
+			if stopped == nil && err == nil {
+				// A watchpoint hit the thread should not stop at.
+				if err := th.resume(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return stopped, err
 		}
 		if th != nil {
 			// TODO(dp) alert user about unexpected signals here.
@@ -309,8 +453,70 @@ func (dbp *Process) trapWait(pid int) (*Thread, error) {
 	}
 }
 
+// Called when the process stops after replacing its image. All threads
+// but the one calling exec are gone and that one now has the ID of the
+// process.
+func (dbp *Process) reloadAfterExec() error {
+	path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", dbp.Pid))
+	if err != nil {
+		return err
+	}
+	var bps []*Breakpoint
+	for _, bp := range dbp.Breakpoints {
+		if !bp.Temp {
+			bps = append(bps, bp)
+		}
+	}
+	dbp.Breakpoints = make(map[uint64]*Breakpoint)
+	dbp.Watchpoints = make(map[uint64]*Watchpoint)
+	dbp.Threads = make(map[int]*Thread)
+	dbp.CurrentThread = nil
+	if err := dbp.loadImage(path); err != nil {
+		return err
+	}
+	return ProcessExecError{Pid: dbp.Pid, Path: path, Breakpoints: bps}
+}
+
+func (dbp *Process) memoryMaps() ([]MemoryMap, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", dbp.Pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var maps []MemoryMap
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// start-end perms offset dev inode [path]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		var m MemoryMap
+		if _, err := fmt.Sscanf(fields[0], "%x-%x", &m.Start, &m.End); err != nil {
+			return nil, fmt.Errorf("could not parse memory map %q: %s", scanner.Text(), err)
+		}
+		m.Perms = fields[1]
+		if len(fields) > 5 {
+			m.Path = strings.Join(fields[5:], " ")
+		}
+		maps = append(maps, m)
+	}
+	return maps, scanner.Err()
+}
+
 func status(pid int) rune {
-	f, err := os.Open(fmt.Sprintf("/proc/%d/stat", pid))
+	return statusFile(fmt.Sprintf("/proc/%d/stat", pid))
+}
+
+// Returns the state of thread tid of process pid, read from its entry
+// in /proc/<pid>/task.
+func threadStatus(pid, tid int) rune {
+	return statusFile(fmt.Sprintf("/proc/%d/task/%d/stat", pid, tid))
+}
+
+func statusFile(path string) rune {
+	f, err := os.Open(path)
 	if err != nil {
 		return '\000'
 	}
@@ -325,6 +531,28 @@ func status(pid int) rune {
 	return state
 }
 
+// Polling interval of waitTimeout.
+const waitPollInterval = 10 * time.Millisecond
+
+// Waits like wait does, giving up with a WaitTimeoutError
+// after dbp.WaitTimeout if it is set.
+func (dbp *Process) waitTimeout(pid int) (int, *sys.WaitStatus, error) {
+	if dbp.WaitTimeout <= 0 {
+		return wait(pid, dbp.Pid, 0)
+	}
+	deadline := time.Now().Add(dbp.WaitTimeout)
+	for {
+		wpid, status, err := pollWait(pid, dbp.Pid)
+		if err != nil || wpid != 0 {
+			return wpid, status, err
+		}
+		if time.Now().After(deadline) {
+			return 0, nil, WaitTimeoutError{Timeout: dbp.WaitTimeout}
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
 func wait(pid, tgid, options int) (int, *sys.WaitStatus, error) {
 	var s sys.WaitStatus
 	if (pid != tgid) || (options != 0) {
@@ -343,17 +571,29 @@ func wait(pid, tgid, options int) (int, *sys.WaitStatus, error) {
 		// https://sourceware.org/bugzilla/show_bug.cgi?id=10095
 		// https://sourceware.org/bugzilla/attachment.cgi?id=5685
 		for {
-			wpid, err := sys.Wait4(pid, &s, sys.WNOHANG|sys.WALL|options, nil)
-			if err != nil {
-				return 0, nil, err
-			}
-			if wpid != 0 {
-				return wpid, &s, err
-			}
-			if status(pid) == STATUS_ZOMBIE {
-				return pid, nil, nil
+			wpid, status, err := pollWait(pid, tgid)
+			if err != nil || wpid != 0 {
+				return wpid, status, err
 			}
 			time.Sleep(200 * time.Millisecond)
 		}
 	}
 }
+
+// Waits for pid without blocking, returning 0 if it has not changed
+// state. The thread group leader is reported with a nil status once it
+// is a zombie, wait4 would not report it while other threads are left.
+func pollWait(pid, tgid int) (int, *sys.WaitStatus, error) {
+	var s sys.WaitStatus
+	wpid, err := sys.Wait4(pid, &s, sys.WNOHANG|sys.WALL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if wpid != 0 {
+		return wpid, &s, nil
+	}
+	if pid == tgid && status(pid) == STATUS_ZOMBIE {
+		return pid, nil, nil
+	}
+	return 0, nil, nil
+}
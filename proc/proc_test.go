@@ -2,12 +2,17 @@ package proc
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -24,7 +29,7 @@ func TestMain(m *testing.M) {
 	os.Exit(protest.RunTestsWithFixtures(m))
 }
 
-func withTestProcess(name string, t *testing.T, fn func(p *Process, fixture protest.Fixture)) {
+func withTestProcess(name string, t testing.TB, fn func(p *Process, fixture protest.Fixture)) {
 	fixture := protest.BuildFixture(name)
 	p, err := Launch([]string{fixture.Path})
 	if err != nil {
@@ -52,7 +57,7 @@ func dataAtAddr(thread *Thread, addr uint64) ([]byte, error) {
 	return thread.readMemory(uintptr(addr), 1)
 }
 
-func assertNoError(err error, t *testing.T, s string) {
+func assertNoError(err error, t testing.TB, s string) {
 	if err != nil {
 		_, file, line, _ := runtime.Caller(1)
 		fname := filepath.Base(file)
@@ -92,6 +97,125 @@ func TestExit(t *testing.T) {
 	})
 }
 
+func TestLaunchWithConfig(t *testing.T) {
+	wd, err := filepath.EvalSymlinks(os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := protest.BuildFixture("envprog")
+	p, err := LaunchWithConfig([]string{fixture.Path}, &LaunchConfig{
+		Env:        []string{"DLV_TEST_ENV=launched", "DLV_TEST_WD=" + wd},
+		WorkingDir: wd,
+	})
+	if err != nil {
+		t.Fatal("LaunchWithConfig():", err)
+	}
+	defer func() {
+		p.Halt()
+		p.Kill()
+	}()
+	err = p.Continue()
+	pe, ok := err.(ProcessExitedError)
+	if !ok {
+		t.Fatalf("Continue() returned unexpected error type %s", err)
+	}
+	if pe.Status != 0 {
+		t.Errorf("Unexpected error status: %d", pe.Status)
+	}
+}
+
+func TestLaunchWithConfigStdio(t *testing.T) {
+	stdinr, stdinw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdinr.Close()
+	stdoutr, stdoutw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdoutr.Close()
+
+	fixture := protest.BuildFixture("stdioprog")
+	p, err := LaunchWithConfig([]string{fixture.Path}, &LaunchConfig{Stdin: stdinr, Stdout: stdoutw})
+	// The child holds its own copy of the write end, closing ours
+	// lets us see EOF on its stdout once it exits.
+	stdoutw.Close()
+	if err != nil {
+		t.Fatal("LaunchWithConfig():", err)
+	}
+	defer func() {
+		p.Halt()
+		p.Kill()
+	}()
+	if _, err := stdinw.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	stdinw.Close()
+
+	err = p.Continue()
+	if _, ok := err.(ProcessExitedError); !ok {
+		t.Fatalf("Continue() returned unexpected error type %s", err)
+	}
+	var out bytes.Buffer
+	if _, err := out.ReadFrom(stdoutr); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "HELLO\n" {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+}
+
+func TestWatchOutput(t *testing.T) {
+	stdoutr, stdoutw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture := protest.BuildFixture("outputprog")
+	p, err := LaunchWithConfig([]string{fixture.Path}, &LaunchConfig{Stdout: stdoutw})
+	stdoutw.Close()
+	if err != nil {
+		t.Fatal("LaunchWithConfig():", err)
+	}
+	defer func() {
+		p.Halt()
+		p.Kill()
+	}()
+	var out bytes.Buffer
+	p.WatchOutput(stdoutr, &out, regexp.MustCompile("^MARKER$"))
+
+	err = p.Continue()
+	me, ok := err.(OutputMatchError)
+	if !ok {
+		t.Fatalf("Continue() returned unexpected error type %s", err)
+	}
+	if me.Line != "MARKER" {
+		t.Fatalf("Unexpected matched line %q", me.Line)
+	}
+	for _, th := range p.Threads {
+		if !th.Stopped() {
+			t.Fatal("expected thread to be stopped, but was not")
+		}
+	}
+}
+
+func TestOutputMatchReportedByStep(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		// A line matched while the process was stopping.
+		p.output.match, p.output.hasMatch = "MARKER", true
+		pc, err := p.PC()
+		assertNoError(err, t, "PC()")
+		if me, ok := p.Step().(OutputMatchError); !ok || me.Line != "MARKER" {
+			t.Fatal("Step() did not report the matched line")
+		}
+		if npc, _ := p.PC(); npc != pc {
+			t.Fatalf("Process resumed before reporting the match, at %#x instead of %#x", npc, pc)
+		}
+		assertNoError(p.Step(), t, "Step()")
+	})
+}
+
 func setFunctionBreakpoint(p *Process, fname string) (*Breakpoint, error) {
 	addr, err := p.FindFunctionLocation(fname, true, 0)
 	if err != nil {
@@ -142,6 +266,79 @@ func TestHalt(t *testing.T) {
 	})
 }
 
+func TestWaitTimeout(t *testing.T) {
+	withTestProcess("loopprog", t, func(p *Process, fixture protest.Fixture) {
+		p.WaitTimeout = 500 * time.Millisecond
+		err := p.Continue()
+		if _, ok := err.(WaitTimeoutError); !ok {
+			t.Fatalf("Continue() returned unexpected error type %s", err)
+		}
+		if !p.Running() {
+			t.Fatal("expected process to be left running after the timeout")
+		}
+		assertNoError(p.Halt(), t, "Halt()")
+		for _, th := range p.Threads {
+			if !th.Stopped() {
+				t.Fatal("expected thread to be stopped, but was not")
+			}
+		}
+	})
+}
+
+func TestWaitTimeoutExit(t *testing.T) {
+	withTestProcess("continuetestprog", t, func(p *Process, fixture protest.Fixture) {
+		p.WaitTimeout = 5 * time.Second
+		err := p.Continue()
+		if _, ok := err.(ProcessExitedError); !ok {
+			t.Fatalf("Continue() returned %v, expected the process to exit", err)
+		}
+	})
+}
+
+func TestWaitStopped(t *testing.T) {
+	withTestProcess("loopprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.WaitStopped(0), t, "WaitStopped() while stopped")
+
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- p.Continue()
+		}()
+		for !p.Running() {
+			runtime.Gosched()
+		}
+		if _, ok := p.WaitStopped(100 * time.Millisecond).(WaitTimeoutError); !ok {
+			t.Fatal("expected WaitStopped() to time out while the process loops")
+		}
+		assertNoError(p.RequestManualStop(), t, "RequestManualStop()")
+		assertNoError(p.WaitStopped(5*time.Second), t, "WaitStopped()")
+		if p.Running() {
+			t.Fatal("process running after WaitStopped()")
+		}
+		assertNoError(<-errChan, t, "Continue()")
+		for _, th := range p.Threads {
+			if !th.Stopped() {
+				t.Fatal("expected thread to be stopped, but was not")
+			}
+		}
+	})
+}
+
+func TestReverseExecutionUnsupported(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		var target Target = p
+		for name, fn := range map[string]func() error{
+			"ContinueBackwards": target.ContinueBackwards,
+			"NextBackwards":     target.NextBackwards,
+			"StepBackwards":     target.StepBackwards,
+			"StepOutBackwards":  target.StepOutBackwards,
+		} {
+			if _, ok := fn().(UnsupportedError); !ok {
+				t.Fatalf("%s() did not return UnsupportedError", name)
+			}
+		}
+	})
+}
+
 func TestStep(t *testing.T) {
 	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
 		helloworldfunc := p.goSymTable.LookupFunc("main.helloworld")
@@ -164,6 +361,53 @@ func TestStep(t *testing.T) {
 	})
 }
 
+func TestStepFaultingInstruction(t *testing.T) {
+	withTestProcess("nilderefprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		for i := 0; i < 100; i++ {
+			assertNoError(p.CurrentThread.Step(), t, "Step()")
+			loc, err := p.CurrentThread.Location()
+			assertNoError(err, t, "Location()")
+			if loc.Fn != nil && strings.HasPrefix(loc.Fn.Name, "runtime.sigtramp") {
+				return
+			}
+		}
+		t.Fatal("the SIGSEGV of the nil dereference was not delivered")
+	})
+}
+
+func TestSetSingleStep(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		bp, err := p.SetBreakpoint(p.goSymTable.LookupFunc("main.helloworld").Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		th := p.CurrentThread
+		assertNoError(th.SetSingleStep(true), t, "SetSingleStep(true)")
+		// The first instructions of the function are executed in order,
+		// the first one is the one under the breakpoint.
+		for i := 0; i < 3; i++ {
+			pc, err := th.PC()
+			assertNoError(err, t, "PC()")
+			assertNoError(p.Continue(), t, "Continue()")
+			if p.CurrentThread.Id != th.Id {
+				t.Fatalf("stopped on thread %d instead of %d", p.CurrentThread.Id, th.Id)
+			}
+			newpc, err := th.PC()
+			assertNoError(err, t, "PC()")
+			if newpc <= pc || newpc-pc > maxInstructionLength {
+				t.Fatalf("did not advance a single instruction: %#x -> %#x", pc, newpc)
+			}
+		}
+
+		assertNoError(th.SetSingleStep(false), t, "SetSingleStep(false)")
+		assertNoError(p.Continue(), t, "Continue()")
+		if p.CurrentBreakpoint() != bp {
+			t.Fatalf("breakpoint not hit after disabling single-step, stopped at %v", p.CurrentBreakpoint())
+		}
+	})
+}
+
 func TestBreakpoint(t *testing.T) {
 	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
 		helloworldfunc := p.goSymTable.LookupFunc("main.helloworld")
@@ -185,6 +429,85 @@ func TestBreakpoint(t *testing.T) {
 	})
 }
 
+func TestListBreakpoints(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		sleepytime := p.goSymTable.LookupFunc("main.sleepytime")
+		helloworld := p.goSymTable.LookupFunc("main.helloworld")
+		bp1, err := p.SetBreakpoint(helloworld.Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		bp2, err := p.SetBreakpoint(sleepytime.Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		tmp, err := p.SetTempBreakpoint(p.goSymTable.LookupFunc("main.main").Entry)
+		assertNoError(err, t, "SetTempBreakpoint()")
+
+		bps := p.ListBreakpoints(false)
+		if len(bps) != 2 || bps[0] != bp1 || bps[1] != bp2 {
+			t.Fatalf("wrong breakpoints listed: %v", bps)
+		}
+		for i, fn := range []string{"main.helloworld", "main.sleepytime"} {
+			if bps[i].FunctionName != fn || bps[i].File != fixture.Source || bps[i].Line == 0 {
+				t.Fatalf("breakpoint %d not resolved to %s: %s %s:%d", bps[i].ID, fn, bps[i].FunctionName, bps[i].File, bps[i].Line)
+			}
+		}
+
+		bps = p.ListBreakpoints(true)
+		if len(bps) != 3 || bps[2] != tmp {
+			t.Fatalf("temporary breakpoint not listed: %v", bps)
+		}
+	})
+}
+
+func TestInstructionAtPC(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		helloworldfunc := p.goSymTable.LookupFunc("main.helloworld")
+		bp, err := p.SetBreakpoint(helloworldfunc.Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		mem, err := dataAtAddr(p.CurrentThread, bp.Addr)
+		assertNoError(err, t, "dataAtAddr()")
+		if mem[0] != 0xCC {
+			t.Fatalf("Breakpoint not installed, found %#x", mem[0])
+		}
+		instr, err := p.CurrentThread.InstructionAtPC()
+		assertNoError(err, t, "InstructionAtPC()")
+		if instr[0] != bp.OriginalData[0] {
+			t.Fatalf("Expected original byte %#x got %#x", bp.OriginalData[0], instr[0])
+		}
+	})
+}
+
+func TestReadInstructionsEndOfMapping(t *testing.T) {
+	// Mappings are listed from /proc.
+	if runtime.GOOS != "linux" {
+		return
+	}
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		maps, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/maps", p.Pid))
+		assertNoError(err, t, "ReadFile()")
+		// A readable mapping not followed by another one.
+		var end uint64
+		lines := strings.Split(strings.TrimSpace(string(maps)), "\n")
+		for i := 0; i+1 < len(lines) && end == 0; i++ {
+			var start, next, nextEnd uint64
+			var perms string
+			fmt.Sscanf(lines[i], "%x-%x %s", &start, &end, &perms)
+			fmt.Sscanf(lines[i+1], "%x-%x", &next, &nextEnd)
+			if end == next || !strings.HasPrefix(perms, "r") {
+				end = 0
+			}
+		}
+		if end == 0 {
+			t.Fatal("No mapping followed by unmapped memory")
+		}
+		code, err := p.CurrentThread.readInstructions(end-3, maxInstructionLength)
+		assertNoError(err, t, "readInstructions()")
+		if len(code) != 3 {
+			t.Fatalf("Read %d bytes at the end of the mapping, expected 3", len(code))
+		}
+	})
+}
+
 func TestBreakpointInSeperateGoRoutine(t *testing.T) {
 	withTestProcess("testthreads", t, func(p *Process, fixture protest.Fixture) {
 		fn := p.goSymTable.LookupFunc("main.anotherthread")
@@ -223,6 +546,32 @@ func TestBreakpointWithNonExistantFunction(t *testing.T) {
 	})
 }
 
+func TestSetBreakpointErrors(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		fn := p.goSymTable.LookupFunc("main.helloworld")
+		bp, err := p.SetBreakpoint(fn.Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+
+		_, err = p.SetBreakpoint(fn.Entry)
+		existsErr, ok := err.(BreakpointExistsError)
+		if !ok {
+			t.Fatalf("SetBreakpoint() at the same address returned %v", err)
+		}
+		if existsErr.Breakpoint != bp {
+			t.Fatalf("wrong existing breakpoint %v (expected %v)", existsErr.Breakpoint, bp)
+		}
+
+		_, err = p.SetBreakpoint(0)
+		invalidErr, ok := err.(InvalidAddressError)
+		if !ok {
+			t.Fatalf("SetBreakpoint(0) returned %v", err)
+		}
+		if invalidErr.Address != 0 {
+			t.Fatalf("wrong invalid address %#x", invalidErr.Address)
+		}
+	})
+}
+
 func TestClearBreakpointBreakpoint(t *testing.T) {
 	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
 		fn := p.goSymTable.LookupFunc("main.sleepytime")
@@ -248,6 +597,95 @@ func TestClearBreakpointBreakpoint(t *testing.T) {
 	})
 }
 
+func TestLineBreakpoint(t *testing.T) {
+	withTestProcess("testnextprog", t, func(p *Process, fixture protest.Fixture) {
+		// The for statement on line 23 is split between the
+		// initialization and the condition / post statement.
+		lbp, err := p.SetLineBreakpoint(fixture.Source, 23)
+		assertNoError(err, t, "SetLineBreakpoint()")
+		if len(lbp.Breakpoints) < 2 {
+			t.Fatalf("Expected multiple addresses for line 23, got %#v", lbp.Addrs())
+		}
+		for _, bp := range lbp.Breakpoints {
+			if bp.ID != lbp.ID {
+				t.Fatalf("Physical breakpoint %#v has ID %d, expected %d", bp.Addr, bp.ID, lbp.ID)
+			}
+		}
+
+		for i := 0; i < 3; i++ {
+			assertNoError(p.Continue(), t, "Continue()")
+			_, ln := currentLineNumber(p, t)
+			if ln != 23 {
+				t.Fatalf("Program stopped at line %d, expected 23", ln)
+			}
+			if p.CurrentBreakpoint().ID != lbp.ID {
+				t.Fatalf("Stopped at breakpoint %d, expected %d", p.CurrentBreakpoint().ID, lbp.ID)
+			}
+		}
+		if lbp.HitCount() != 3 {
+			t.Fatalf("Wrong hit count: %d (expected: 3)", lbp.HitCount())
+		}
+
+		assertNoError(p.ClearLineBreakpoint(lbp), t, "ClearLineBreakpoint()")
+		if len(p.Breakpoints) != 0 {
+			t.Fatal("Not all breakpoints were cleared", len(p.Breakpoints))
+		}
+	})
+}
+
+func TestConditionalBreakpoint(t *testing.T) {
+	withTestProcess("condloopprog", t, func(p *Process, fixture protest.Fixture) {
+		addr, err := p.FindFileLocation(fixture.Source, 9)
+		assertNoError(err, t, "FindFileLocation()")
+		bp, err := p.SetBreakpoint(addr)
+		assertNoError(err, t, "SetBreakpoint()")
+		bp.Cond = "hit"
+
+		for n := 1; n <= 2; n++ {
+			assertNoError(p.Continue(), t, "Continue()")
+			v, err := evalVariable(p, "i")
+			assertNoError(err, t, "EvalVariable()")
+			if v.Value != strconv.Itoa(10*n-1) {
+				t.Fatalf("Stopped with i = %s, expected %d", v.Value, 10*n-1)
+			}
+			if bp.HitCount != uint64(n) {
+				t.Fatalf("Wrong hit count: %d (expected: %d)", bp.HitCount, n)
+			}
+		}
+
+		bp.Cond = "i"
+		if err := p.Continue(); err == nil {
+			t.Fatal("Continue() with a condition of type int succeeded")
+		}
+	})
+}
+
+func TestLineBreakpointRollback(t *testing.T) {
+	withTestProcess("testnextprog", t, func(p *Process, fixture protest.Fixture) {
+		if p.lineInfo.GetLineInfo(fixture.Source) == nil {
+			t.Fatalf("could not find file %s", fixture.Source)
+		}
+		pcs := p.lineInfo.AllPCsForFileLine(fixture.Source, 23)
+		if len(pcs) < 2 {
+			t.Fatalf("Expected multiple addresses for line 23, got %#v", pcs)
+		}
+		bp, err := p.SetBreakpoint(pcs[len(pcs)-1])
+		assertNoError(err, t, "SetBreakpoint()")
+
+		if _, err := p.SetLineBreakpoint(fixture.Source, 23); err == nil {
+			t.Fatal("SetLineBreakpoint() over an existing breakpoint succeeded")
+		}
+		if len(p.Breakpoints) != 1 {
+			t.Fatal("Breakpoints of the line not cleared", len(p.Breakpoints))
+		}
+		lbp, err := p.SetLineBreakpoint(fixture.Source, 15)
+		assertNoError(err, t, "SetLineBreakpoint()")
+		if lbp.ID != bp.ID+1 {
+			t.Fatalf("Line breakpoint got ID %d, expected %d", lbp.ID, bp.ID+1)
+		}
+	})
+}
+
 type nextTest struct {
 	begin, end int
 }
@@ -280,6 +718,49 @@ func testnext(program string, testcases []nextTest, initialLocation string, t *t
 	})
 }
 
+func TestLineToPCsInlined(t *testing.T) {
+	withTestProcess("inlineprog", t, func(p *Process, fixture protest.Fixture) {
+		pcs, err := p.LineToPCs(fixture.Source, 9)
+		assertNoError(err, t, "LineToPCs()")
+		// The body of double is compiled once on its own and once for
+		// each call site it is inlined into.
+		if len(pcs) < 2 {
+			t.Fatalf("expected more than one PC for the inlined line, got %v", pcs)
+		}
+		fns := make(map[string]bool)
+		for _, fpc := range pcs {
+			if fpc.Fn == nil || fpc.PC < fpc.Fn.Entry || fpc.PC >= fpc.Fn.End {
+				t.Fatalf("wrong function for %#x: %v", fpc.PC, fpc.Fn)
+			}
+			fns[fpc.Fn.Name] = true
+		}
+		if !fns["main.main"] || !fns["main.double"] {
+			t.Fatalf("PCs not in both main.double and main.main: %v", fns)
+		}
+	})
+}
+
+func TestNextExitCleansUpBreakpoints(t *testing.T) {
+	withTestProcess("nextexitprog", t, func(p *Process, fixture protest.Fixture) {
+		addr, err := p.FindFileLocation(fixture.Source, 7)
+		assertNoError(err, t, "FindFileLocation()")
+		bp, err := p.SetBreakpoint(addr)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+		p.ClearBreakpoint(bp.Addr)
+		p.CurrentThread.SetPC(bp.Addr)
+		tmp, err := p.SetTempBreakpoint(p.goSymTable.LookupFunc("main.main").Entry)
+		assertNoError(err, t, "SetTempBreakpoint()")
+
+		if err := p.Next(); err == nil {
+			t.Fatal("Next() over os.Exit did not return an error")
+		}
+		if len(p.Breakpoints) != 1 || p.Breakpoints[tmp.Addr] != tmp {
+			t.Fatal("Not all internal breakpoints were cleaned up", len(p.Breakpoints))
+		}
+	})
+}
+
 func TestNextGeneral(t *testing.T) {
 	testcases := []nextTest{
 		{19, 20},
@@ -459,42 +940,174 @@ func TestFindReturnAddressTopOfStackFn(t *testing.T) {
 	})
 }
 
-func TestSwitchThread(t *testing.T) {
+func TestSetBreakpointByLocation(t *testing.T) {
 	withTestProcess("testnextprog", t, func(p *Process, fixture protest.Fixture) {
-		// With invalid thread id
-		err := p.SwitchThread(-1)
-		if err == nil {
-			t.Fatal("Expected error for invalid thread id")
-		}
-		pc, err := p.FindFunctionLocation("main.main", true, 0)
-		if err != nil {
-			t.Fatal(err)
+		bp, err := p.SetBreakpointByLocation("testnextprog.go:24")
+		assertNoError(err, t, "SetBreakpointByLocation(file:line)")
+		if bp.File != fixture.Source || bp.Line != 24 {
+			t.Fatalf("wrong breakpoint location: %s:%d", bp.File, bp.Line)
 		}
-		_, err = p.SetBreakpoint(pc)
-		if err != nil {
-			t.Fatal(err)
+
+		bp, err = p.SetBreakpointByLocation("main.helloworld")
+		assertNoError(err, t, "SetBreakpointByLocation(function)")
+		fn := p.goSymTable.LookupFunc("main.helloworld")
+		if bp.FunctionName != "main.helloworld" || bp.Addr == fn.Entry {
+			t.Fatalf("breakpoint not set after the prologue of main.helloworld: %v", bp)
 		}
-		err = p.Continue()
-		if err != nil {
-			t.Fatal(err)
+
+		fn = p.goSymTable.LookupFunc("main.sleepytime")
+		bp, err = p.SetBreakpointByLocation(fmt.Sprintf("*%#x", fn.Entry))
+		assertNoError(err, t, "SetBreakpointByLocation(address)")
+		if bp.Addr != fn.Entry {
+			t.Fatalf("wrong breakpoint address: %#x (expected: %#x)", bp.Addr, fn.Entry)
 		}
-		var nt int
-		ct := p.CurrentThread.Id
-		for tid := range p.Threads {
-			if tid != ct {
-				nt = tid
-				break
+
+		for _, loc := range []string{"testnextprog.go:1000", "nosuchfile.go:1", "main.nosuchfunction", "*nosuchaddress"} {
+			if _, err := p.SetBreakpointByLocation(loc); err == nil {
+				t.Fatalf("breakpoint set at %s", loc)
 			}
 		}
-		if nt == 0 {
-			t.Fatal("could not find thread to switch to")
-		}
-		// With valid thread id
-		err = p.SwitchThread(nt)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if p.CurrentThread.Id != nt {
+	})
+}
+
+func TestSetBreakpointAtLineOffset(t *testing.T) {
+	withTestProcess("testnextprog", t, func(p *Process, fixture protest.Fixture) {
+		start, _, err := p.goSymTable.LineToPC(fixture.Source, 24)
+		assertNoError(err, t, "LineToPC()")
+		_, err = p.SetBreakpoint(start)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+		_, err = p.ClearBreakpoint(start)
+		assertNoError(err, t, "ClearBreakpoint()")
+
+		if _, err := p.SetBreakpointAtLineOffset(20); err == nil {
+			t.Fatal("breakpoint set outside of the function")
+		}
+		bp, err := p.SetBreakpointAtLineOffset(3)
+		assertNoError(err, t, "SetBreakpointAtLineOffset()")
+		if bp.Line != 27 {
+			t.Fatalf("breakpoint set on the wrong line: %d (expected: 27)", bp.Line)
+		}
+		assertNoError(p.Continue(), t, "Continue()")
+		loc, err := p.CurrentThread.Location()
+		assertNoError(err, t, "Location()")
+		if loc.Line != 27 || p.CurrentBreakpoint() != bp {
+			t.Fatalf("did not stop at the breakpoint: %#v", loc)
+		}
+	})
+}
+
+func TestRunUntil(t *testing.T) {
+	withTestProcess("testnextprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.RunUntil(fixture.Source, 27), t, "RunUntil()")
+		assertLine := func(line int) {
+			loc, err := p.CurrentThread.Location()
+			assertNoError(err, t, "Location()")
+			if loc.Line != line {
+				t.Fatalf("stopped at the wrong line: %d (expected: %d)", loc.Line, line)
+			}
+		}
+		assertLine(27)
+		if len(p.Breakpoints) != 0 {
+			t.Fatalf("temporary breakpoint not cleared: %v", p.Breakpoints)
+		}
+
+		// A breakpoint set by the user is left in place.
+		pc, _, err := p.goSymTable.LineToPC(fixture.Source, 34)
+		assertNoError(err, t, "LineToPC()")
+		bp, err := p.SetBreakpoint(pc)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.RunUntil(fixture.Source, 34), t, "RunUntil()")
+		assertLine(34)
+		if p.Breakpoints[pc] != bp {
+			t.Fatal("breakpoint set by the user was removed")
+		}
+		_, err = p.ClearBreakpoint(pc)
+		assertNoError(err, t, "ClearBreakpoint()")
+
+		// The loop is over, line 27 is not reached again.
+		if _, exited := p.RunUntil(fixture.Source, 27).(ProcessExitedError); !exited {
+			t.Fatal("RunUntil() did not report the exit of the process")
+		}
+		if len(p.Breakpoints) != 0 {
+			t.Fatalf("temporary breakpoint not cleared: %v", p.Breakpoints)
+		}
+	})
+}
+
+func TestStepOut(t *testing.T) {
+	withTestProcess("testnextprog", t, func(p *Process, fixture protest.Fixture) {
+		start, _, err := p.goSymTable.LineToPC(fixture.Source, 24)
+		assertNoError(err, t, "LineToPC()")
+		_, err = p.SetBreakpoint(start)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		assertNoError(p.StepOut(), t, "StepOut()")
+		loc, err := p.CurrentThread.Location()
+		assertNoError(err, t, "Location()")
+		if loc.Fn == nil || loc.Fn.Name != "main.main" || loc.Line != 40 {
+			t.Fatalf("wrong location after StepOut: %#v (expected: main.main line 40)", loc)
+		}
+		for _, bp := range p.Breakpoints {
+			if bp.Temp {
+				t.Fatalf("temporary breakpoint not cleared: %v", bp)
+			}
+		}
+	})
+}
+
+func TestStepOutTopOfStackFn(t *testing.T) {
+	withTestProcess("testreturnaddress", t, func(p *Process, fixture protest.Fixture) {
+		fn := p.goSymTable.LookupFunc("runtime.rt0_go")
+		if fn == nil {
+			t.Fatal("could not find function runtime.rt0_go")
+		}
+		_, err := p.SetBreakpoint(fn.Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+		if err := p.StepOut(); err == nil {
+			t.Fatal("expected error to be returned")
+		}
+	})
+}
+
+func TestSwitchThread(t *testing.T) {
+	withTestProcess("testnextprog", t, func(p *Process, fixture protest.Fixture) {
+		// With invalid thread id
+		err := p.SwitchThread(-1)
+		if err == nil {
+			t.Fatal("Expected error for invalid thread id")
+		}
+		pc, err := p.FindFunctionLocation("main.main", true, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = p.SetBreakpoint(pc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p.Continue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var nt int
+		ct := p.CurrentThread.Id
+		for tid := range p.Threads {
+			if tid != ct {
+				nt = tid
+				break
+			}
+		}
+		if nt == 0 {
+			t.Fatal("could not find thread to switch to")
+		}
+		// With valid thread id
+		err = p.SwitchThread(nt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.CurrentThread.Id != nt {
 			t.Fatal("Did not switch threads")
 		}
 	})
@@ -614,6 +1227,141 @@ func stackMatch(stack []loc, locations []Stackframe) bool {
 	return true
 }
 
+func TestGoroutinesInfoCache(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		gs1, err := p.GoroutinesInfo()
+		assertNoError(err, t, "GoroutinesInfo()")
+		gs2, err := p.GoroutinesInfo()
+		assertNoError(err, t, "GoroutinesInfo()")
+		if len(gs1) == 0 || &gs1[0] != &gs2[0] {
+			t.Fatal("goroutines read again within the same stop")
+		}
+
+		gs3, err := p.RefreshGoroutinesInfo()
+		assertNoError(err, t, "RefreshGoroutinesInfo()")
+		if &gs3[0] == &gs1[0] {
+			t.Fatal("goroutines not read again by RefreshGoroutinesInfo()")
+		}
+
+		assertNoError(p.Continue(), t, "Continue()")
+		gs4, err := p.GoroutinesInfo()
+		assertNoError(err, t, "GoroutinesInfo()")
+		if &gs4[0] == &gs3[0] {
+			t.Fatal("goroutines not read again after Continue()")
+		}
+	})
+}
+
+func TestDefersAndPanics(t *testing.T) {
+	withTestProcess("deferprog", t, func(p *Process, fixture protest.Fixture) {
+		current := func() *G {
+			assertNoError(p.Continue(), t, "Continue()")
+			g, err := p.CurrentThread.GetG()
+			assertNoError(err, t, "GetG()")
+			return g
+		}
+		// The runtime may defer calls of its own before main.main.
+		base := current()
+		if base.Panics != 0 {
+			t.Fatalf("wrong number of panics: %d", base.Panics)
+		}
+		if g := current(); g.Defers != base.Defers+3 {
+			t.Fatalf("wrong number of defers in manyDefers: %d (expected: %d)", g.Defers, base.Defers+3)
+		}
+		if g := current(); g.Panics != 1 {
+			t.Fatalf("wrong number of panics in panicking: %d (expected: 1)", g.Panics)
+		}
+	})
+}
+
+func TestAncestors(t *testing.T) {
+	fixture := protest.BuildFixture("ancestorsprog")
+	p, err := LaunchWithConfig([]string{fixture.Path}, &LaunchConfig{
+		Env: []string{"GODEBUG=tracebackancestors=5"},
+	})
+	if err != nil {
+		t.Fatal("LaunchWithConfig():", err)
+	}
+	defer func() {
+		p.Halt()
+		p.Kill()
+	}()
+	assertNoError(p.Continue(), t, "Continue()")
+	g, err := p.CurrentThread.GetG()
+	assertNoError(err, t, "GetG()")
+	ancestors, err := p.Ancestors(g)
+	assertNoError(err, t, "Ancestors()")
+	if len(ancestors) != 2 {
+		t.Fatalf("wrong number of ancestors: %d (expected: 2)", len(ancestors))
+	}
+	for i, fnname := range []string{"main.middle", "main.main"} {
+		found := false
+		for _, loc := range ancestors[i].Stack {
+			if loc.Fn != nil && loc.Fn.Name == fnname {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("%s not in the stack of ancestor %d: %v", fnname, i, ancestors[i].Stack)
+		}
+	}
+	if ancestors[1].Id != 1 {
+		t.Fatalf("wrong id of the main goroutine: %d", ancestors[1].Id)
+	}
+
+	// Without tracebackancestors nothing is recorded.
+	withTestProcess("ancestorsprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		g, err := p.CurrentThread.GetG()
+		assertNoError(err, t, "GetG()")
+		ancestors, err := p.Ancestors(g)
+		assertNoError(err, t, "Ancestors()")
+		if len(ancestors) != 0 {
+			t.Fatalf("unexpected ancestors: %v", ancestors)
+		}
+	})
+}
+
+func TestGoroutinesInfoFiltered(t *testing.T) {
+	withTestProcess("goroutinestackprog", t, func(p *Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.stacktraceme")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		gs, err := p.GoroutinesInfoFiltered((*G).ChanSendBlocked)
+		assertNoError(err, t, "GoroutinesInfoFiltered(ChanSendBlocked)")
+		// The goroutines are created by the fixture and never exit before the
+		// breakpoint: all of them are blocked sending on the channel.
+		if len(gs) != 10 {
+			t.Fatalf("wrong number of goroutines blocked in chan send: %d (expected: 10)", len(gs))
+		}
+		for _, g := range gs {
+			if g.Status != Gwaiting {
+				t.Fatalf("goroutine %d blocked in chan send is not waiting: %d", g.Id, g.Status)
+			}
+		}
+
+		gs, err = p.GoroutinesInfoFiltered(GoroutineStatus(Grunning))
+		assertNoError(err, t, "GoroutinesInfoFiltered(Grunning)")
+		found := false
+		for _, g := range gs {
+			if g.Status != Grunning {
+				t.Fatalf("goroutine %d is not running: %d", g.Id, g.Status)
+			}
+			if g.Id == p.SelectedGoroutine.Id {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatal("the goroutine stopped at the breakpoint is not running")
+		}
+	})
+}
+
 func TestStacktraceGoroutine(t *testing.T) {
 	mainStack := []loc{{12, "main.stacktraceme"}, {21, "main.main"}}
 	agoroutineStack := []loc{{-1, "runtime.gopark"}, {-1, "runtime.goparkunlock"}, {-1, "runtime.chansend"}, {-1, "runtime.chansend1"}, {8, "main.agoroutine"}}
@@ -665,6 +1413,713 @@ func TestStacktraceGoroutine(t *testing.T) {
 	})
 }
 
+func TestGoroutineStackUsage(t *testing.T) {
+	withTestProcess("stackusageprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		g, err := p.CurrentThread.GetG()
+		assertNoError(err, t, "GetG()")
+		used, total := g.StackUsage()
+		// 1000 frames of recurse, each holding a 64 byte array.
+		if used < 64*1000 {
+			t.Fatalf("Stack usage too small: %d", used)
+		}
+		if used > total {
+			t.Fatalf("Stack usage %d larger than stack size %d", used, total)
+		}
+
+		gs, err := p.GoroutinesInfo()
+		assertNoError(err, t, "GoroutinesInfo()")
+		for _, g := range gs {
+			if used, total := g.StackUsage(); used > total {
+				t.Fatalf("Stack usage %d of goroutine %d larger than stack size %d", used, g.Id, total)
+			}
+		}
+	})
+}
+
+func TestStackframeVariables(t *testing.T) {
+	withTestProcess("stackusageprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		frames, err := p.CurrentThread.Stacktrace(5)
+		assertNoError(err, t, "Stacktrace()")
+
+		// The innermost calls of recurse have n = 0, 1, 2...
+		n := 0
+		for i := range frames {
+			if frames[i].Current.Fn == nil || frames[i].Current.Fn.Name != "main.recurse" {
+				continue
+			}
+			assertNoError(frames[i].LoadVariables(p.CurrentThread, DefaultLoadConfig), t, "LoadVariables()")
+			if len(frames[i].Arguments) != 1 || frames[i].Arguments[0].Name != "n" {
+				t.Fatalf("wrong arguments for frame %d: %v", i, frames[i].Arguments)
+			}
+			if v := frames[i].Arguments[0].Value; v != strconv.Itoa(n) {
+				t.Fatalf("wrong value of n in frame %d: %s (expected: %d)", i, v, n)
+			}
+			found := false
+			for _, v := range frames[i].Locals {
+				found = found || v.Name == "buf"
+			}
+			if !found {
+				t.Fatalf("local variable buf missing from frame %d: %v", i, frames[i].Locals)
+			}
+			n++
+		}
+		if n == 0 {
+			t.Fatal("no frames of main.recurse")
+		}
+	})
+}
+
+func TestDetachAttachRestoresBreakpoints(t *testing.T) {
+	withTestProcess("loopprog", t, func(p *Process, fixture protest.Fixture) {
+		addr, err := p.FindFileLocation(fixture.Source, 10)
+		assertNoError(err, t, "FindFileLocation()")
+		bp, err := p.SetBreakpoint(addr)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		// A line of main.main starting again past its first address, the
+		// breakpoint must not be moved there. main.main never runs it
+		// again since it is blocked calling main.loop.
+		fn := p.goSymTable.LookupFunc("main.main")
+		var retbp *Breakpoint
+		for pc := fn.Entry + 1; pc < fn.End && retbp == nil; pc++ {
+			f, l, _ := p.goSymTable.PCToLine(pc)
+			if _, prev, _ := p.goSymTable.PCToLine(pc - 1); l == prev || f != fixture.Source {
+				continue
+			}
+			if first, err := p.FindFileLocation(f, l); err == nil && first != pc {
+				retbp, err = p.SetBreakpoint(pc)
+				assertNoError(err, t, "SetBreakpoint()")
+			}
+		}
+		if retbp == nil {
+			t.Fatal("No line of main.main starts again past its first address")
+		}
+
+		assertNoError(p.Detach(false), t, "Detach()")
+		if len(p.Breakpoints) != 0 {
+			t.Fatal("Not all breakpoints were cleared", len(p.Breakpoints))
+		}
+		if len(p.DetachedBreakpoints) != 2 {
+			t.Fatal("Wrong number of detached breakpoints", len(p.DetachedBreakpoints))
+		}
+
+		p2, err := Attach(p.Pid)
+		assertNoError(err, t, "Attach()")
+		defer func() {
+			p2.Halt()
+			p2.Kill()
+		}()
+		restored, err := p2.RestoreBreakpoints(p.DetachedBreakpoints)
+		assertNoError(err, t, "RestoreBreakpoints()")
+		if len(restored) != 2 {
+			t.Fatalf("Wrong restored breakpoints: %v", restored)
+		}
+		for _, want := range []*Breakpoint{bp, retbp} {
+			if got, ok := p2.Breakpoints[want.Addr]; !ok || got.ID != want.ID {
+				t.Fatalf("Breakpoint %v not restored at its address: %v", want, restored)
+			}
+		}
+		if len(p2.DetachedBreakpoints) != 0 {
+			t.Fatal("DetachedBreakpoints not cleared", len(p2.DetachedBreakpoints))
+		}
+		assertNoError(p2.Continue(), t, "Continue()")
+		if _, ln := currentLineNumber(p2, t); ln != 10 {
+			t.Fatalf("Program did not stop at the restored breakpoint, stopped at line %d", ln)
+		}
+	})
+}
+
+func TestRestoreBreakpointsRemapsIDs(t *testing.T) {
+	withTestProcess("loopprog", t, func(p *Process, fixture protest.Fixture) {
+		addr, err := p.FindFileLocation(fixture.Source, 10)
+		assertNoError(err, t, "FindFileLocation()")
+		bp, err := p.SetBreakpoint(addr)
+		assertNoError(err, t, "SetBreakpoint()")
+
+		old := []*Breakpoint{
+			{ID: bp.ID, File: fixture.Source, Line: 8},
+			{ID: bp.ID, File: fixture.Source, Line: 17},
+		}
+		restored, err := p.RestoreBreakpoints(old)
+		assertNoError(err, t, "RestoreBreakpoints()")
+		if len(restored) != 2 || restored[0].ID == bp.ID || restored[1].ID != restored[0].ID {
+			t.Fatalf("Wrong IDs of the restored breakpoints: %v (in use: %d)", restored, bp.ID)
+		}
+		next, err := p.SetBreakpoint(p.goSymTable.LookupFunc("main.loop").Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		if next.ID <= restored[0].ID {
+			t.Fatalf("ID %d of a new breakpoint already used by a restored one", next.ID)
+		}
+	})
+}
+
+func TestAttach(t *testing.T) {
+	// Threads are listed from /proc.
+	if runtime.GOOS != "linux" {
+		return
+	}
+	fixture := protest.BuildFixture("attachprog")
+	cmd := exec.Command(fixture.Path)
+	assertNoError(cmd.Start(), t, "Start()")
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	// Let the workers start their threads.
+	time.Sleep(500 * time.Millisecond)
+
+	p, err := Attach(cmd.Process.Pid)
+	assertNoError(err, t, "Attach()")
+	tasks, err := filepath.Glob(fmt.Sprintf("/proc/%d/task/*", p.Pid))
+	assertNoError(err, t, "Glob()")
+	if len(tasks) < 5 || len(p.Threads) != len(tasks) {
+		t.Fatalf("Wrong number of threads: %d (expected: %d)", len(p.Threads), len(tasks))
+	}
+	for _, task := range tasks {
+		tid, _ := strconv.Atoi(filepath.Base(task))
+		if th, ok := p.Threads[tid]; !ok || !th.Stopped() {
+			t.Fatalf("Thread %d not attached", tid)
+		}
+	}
+
+	addr, err := p.FindFunctionLocation("main.tick", true, 0)
+	assertNoError(err, t, "FindFunctionLocation()")
+	_, err = p.SetBreakpoint(addr)
+	assertNoError(err, t, "SetBreakpoint()")
+	assertNoError(p.Continue(), t, "Continue()")
+	if pc := currentPC(p, t); pc != addr {
+		t.Fatalf("Not stopped at main.tick: %#x (expected: %#x)", pc, addr)
+	}
+
+	assertNoError(p.Detach(false), t, "Detach()")
+	time.Sleep(100 * time.Millisecond)
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", cmd.Process.Pid))
+	assertNoError(err, t, "ReadFile()")
+	if fields := strings.Fields(string(stat)); fields[2] == "t" {
+		t.Fatal("Process still stopped after Detach()")
+	}
+}
+
+func TestStepInto(t *testing.T) {
+	withTestProcess("stepintoprog", t, func(p *Process, fixture protest.Fixture) {
+		addr, err := p.FindFileLocation(fixture.Source, 9)
+		assertNoError(err, t, "FindFileLocation()")
+		_, err = p.SetBreakpoint(addr)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+		for _, expected := range []struct {
+			fn   string
+			line int
+		}{{"main.main", 10}, {"main.square", 4}, {"main.square", 5}} {
+			assertNoError(p.StepInto(), t, "StepInto()")
+			loc, err := p.CurrentThread.Location()
+			assertNoError(err, t, "Location()")
+			if loc.Fn == nil || loc.Fn.Name != expected.fn || loc.Line != expected.line {
+				t.Fatalf("Stopped at %s:%d (expected: %s:%d)", loc.File, loc.Line, expected.fn, expected.line)
+			}
+		}
+	})
+}
+
+func TestStepIntoSkipsRuntime(t *testing.T) {
+	withTestProcess("stepintoprog", t, func(p *Process, fixture protest.Fixture) {
+		addr, err := p.FindFileLocation(fixture.Source, 11)
+		assertNoError(err, t, "FindFileLocation()")
+		_, err = p.SetBreakpoint(addr)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+		assertNoError(p.StepInto(), t, "StepInto()")
+		loc, err := p.CurrentThread.Location()
+		assertNoError(err, t, "Location()")
+		if loc.Fn == nil || loc.Fn.Name != "main.main" || loc.Line != 12 {
+			t.Fatalf("Stopped at %s:%d (expected: main.main:12)", loc.File, loc.Line)
+		}
+	})
+}
+
+func TestStepIntoMorestack(t *testing.T) {
+	// The prologue of main.grow calls runtime.morestack, which restarts
+	// the function on a new stack instead of returning.
+	withTestProcess("stepintoprog", t, func(p *Process, fixture protest.Fixture) {
+		addr, err := p.FindFileLocation(fixture.Source, 13)
+		assertNoError(err, t, "FindFileLocation()")
+		_, err = p.SetBreakpoint(addr)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+		assertNoError(p.StepInto(), t, "StepInto()")
+		loc, err := p.CurrentThread.Location()
+		assertNoError(err, t, "Location()")
+		if loc.Fn == nil || loc.Fn.Name != "main.grow" || loc.Line != 17 {
+			t.Fatalf("Stopped at %s:%d (expected: main.grow:17)", loc.File, loc.Line)
+		}
+	})
+}
+
+func TestStepUserCode(t *testing.T) {
+	withTestProcess("skipprog", t, func(p *Process, fixture protest.Fixture) {
+		p.SkipPackages = []string{"runtime", "strings", "fmt"}
+		assertNoError(p.Continue(), t, "Continue()")
+		userLocation := func() string {
+			loc, err := p.CurrentThread.Location()
+			assertNoError(err, t, "Location()")
+			if loc.Fn == nil || !strings.HasPrefix(loc.Fn.Name, "main.") {
+				t.Fatalf("stopped outside of user code: %#v", loc)
+			}
+			return loc.Fn.Name
+		}
+
+		// strings.Repeat is stepped over, main.shout is stepped into.
+		for i := 0; ; i++ {
+			if i == 10 {
+				t.Fatal("did not step into main.shout")
+			}
+			assertNoError(p.StepUserCode(), t, "StepUserCode()")
+			if userLocation() == "main.shout" {
+				break
+			}
+		}
+		for i := 0; ; i++ {
+			if i == 10 {
+				t.Fatal("did not return to main.main")
+			}
+			assertNoError(p.NextUserCode(), t, "NextUserCode()")
+			if userLocation() == "main.main" {
+				break
+			}
+		}
+	})
+}
+
+func TestSoftwareWatch(t *testing.T) {
+	withTestProcess("watchprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		w, err := p.SetSoftwareWatch("main.counter")
+		assertNoError(err, t, "SetSoftwareWatch()")
+		for i := 0; i < 2; i++ {
+			assertNoError(p.ContinueToWatch(w), t, "ContinueToWatch()")
+			if w.OldValue != strconv.Itoa(i) || w.NewValue != strconv.Itoa(i+1) {
+				t.Fatalf("wrong change: %s -> %s (expected: %d -> %d)", w.OldValue, w.NewValue, i, i+1)
+			}
+		}
+
+		w.Cancel()
+		if _, canceled := p.ContinueToWatch(w).(SoftwareWatchCanceledError); !canceled {
+			t.Fatal("ContinueToWatch() not canceled")
+		}
+	})
+}
+
+func TestSoftwareWatchBlocked(t *testing.T) {
+	// The watched goroutine blocks on a channel receive, the goroutine
+	// sending on it runs only while the process is resumed.
+	withTestProcess("watchblockprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		w, err := p.SetSoftwareWatch("main.counter")
+		assertNoError(err, t, "SetSoftwareWatch()")
+		assertNoError(p.ContinueToWatch(w), t, "ContinueToWatch()")
+		if w.OldValue != "0" || w.NewValue != "1" {
+			t.Fatalf("wrong change: %s -> %s (expected: 0 -> 1)", w.OldValue, w.NewValue)
+		}
+	})
+}
+
+func TestSoftwareWatchOtherGoroutine(t *testing.T) {
+	// Another goroutine changes the value while the watched one is
+	// blocked in the runtime, only the change made by the watched
+	// goroutine is reported.
+	withTestProcess("watchotherprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		w, err := p.SetSoftwareWatch("main.counter")
+		assertNoError(err, t, "SetSoftwareWatch()")
+		assertNoError(p.ContinueToWatch(w), t, "ContinueToWatch()")
+		if w.OldValue != "5" || w.NewValue != "6" {
+			t.Fatalf("wrong change: %s -> %s (expected: 5 -> 6)", w.OldValue, w.NewValue)
+		}
+	})
+}
+
+func TestSetWatchpoint(t *testing.T) {
+	withTestProcess("watchprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		v, err := evalVariable(p, "main.counter")
+		assertNoError(err, t, "EvalVariable()")
+		if _, err := p.SetWatchpoint(uintptr(v.Addr+4), 8, WatchWrite); err == nil {
+			t.Fatal("SetWatchpoint() accepted a misaligned address")
+		}
+		wp, err := p.SetWatchpoint(uintptr(v.Addr), 8, WatchWrite)
+		assertNoError(err, t, "SetWatchpoint()")
+		for i := 1; i <= 3; i++ {
+			assertNoError(p.Continue(), t, "Continue()")
+			if p.CurrentWatchpoint() != wp {
+				t.Fatalf("Not stopped at the watchpoint: %v", p.CurrentWatchpoint())
+			}
+			v, err := evalVariable(p, "main.counter")
+			assertNoError(err, t, "EvalVariable()")
+			if v.Value != strconv.Itoa(i) {
+				t.Fatalf("Wrong value of main.counter: %s (expected: %d)", v.Value, i)
+			}
+		}
+		if wp.HitCount != 3 {
+			t.Fatalf("Wrong hit count: %d", wp.HitCount)
+		}
+		_, err = p.ClearWatchpoint(uintptr(v.Addr))
+		assertNoError(err, t, "ClearWatchpoint()")
+		if _, exited := p.Continue().(ProcessExitedError); !exited {
+			t.Fatal("Process did not exit after clearing the watchpoint")
+		}
+	})
+}
+
+func TestRestart(t *testing.T) {
+	withTestProcess("continuetestprog", t, func(p *Process, fixture protest.Fixture) {
+		addr, err := p.FindFunctionLocation("main.sayhi", true, 0)
+		assertNoError(err, t, "FindFunctionLocation()")
+		bp, err := p.SetBreakpoint(addr)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		for _, reset := range []bool{false, true} {
+			np, err := p.Restart(reset)
+			assertNoError(err, t, "Restart()")
+			defer func() {
+				np.Halt()
+				np.Kill()
+			}()
+			if !p.Exited() || np.Pid == p.Pid {
+				t.Fatal("Process not restarted")
+			}
+			nbp, ok := np.FindBreakpoint(addr)
+			if !ok || nbp.ID != bp.ID {
+				t.Fatalf("Breakpoint not preserved: %v", nbp)
+			}
+			if (reset && nbp.HitCount != 0) || (!reset && nbp.HitCount != bp.HitCount) {
+				t.Fatalf("Wrong hit count %d (reset: %v)", nbp.HitCount, reset)
+			}
+			assertNoError(np.Continue(), t, "Continue()")
+			if np.CurrentBreakpoint() != nbp {
+				t.Fatalf("Not stopped at the breakpoint: %v", np.CurrentBreakpoint())
+			}
+			p, bp = np, nbp
+		}
+	})
+}
+
+func TestRestartMissingExecutable(t *testing.T) {
+	fixture := protest.BuildFixture("continuetestprog")
+	data, err := ioutil.ReadFile(fixture.Path)
+	assertNoError(err, t, "ReadFile()")
+	path := filepath.Join(os.TempDir(), "restartprog")
+	assertNoError(ioutil.WriteFile(path, data, 0755), t, "WriteFile()")
+	p, err := Launch([]string{path})
+	os.Remove(path)
+	assertNoError(err, t, "Launch()")
+	defer func() {
+		p.Halt()
+		p.Kill()
+	}()
+	if np, err := p.Restart(false); err == nil {
+		np.Kill()
+		t.Fatal("Restart() did not fail without the executable")
+	}
+	if p.Exited() {
+		t.Fatal("Process killed by a failed Restart()")
+	}
+}
+
+func TestStepToNextGoStatement(t *testing.T) {
+	withTestProcess("spawnprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		fn, err := p.StepToNextGoStatement()
+		assertNoError(err, t, "StepToNextGoStatement()")
+		if fn == nil || fn.Name != "main.worker" {
+			t.Fatalf("Wrong goroutine function: %v (expected: main.worker)", fn)
+		}
+		loc, err := p.CurrentThread.Location()
+		assertNoError(err, t, "Location()")
+		if loc.Fn == nil || loc.Fn.Name != "runtime.newproc" {
+			t.Fatalf("Not stopped at runtime.newproc: %#v", loc)
+		}
+		if len(p.Breakpoints) != 0 {
+			t.Fatal("Not all breakpoints were cleaned up", len(p.Breakpoints))
+		}
+	})
+}
+
+func TestSetBreakpointOnAllGoroutineCreators(t *testing.T) {
+	withTestProcess("gostmtprog", t, func(p *Process, fixture protest.Fixture) {
+		bps, err := p.SetBreakpointOnAllGoroutineCreators()
+		assertNoError(err, t, "SetBreakpointOnAllGoroutineCreators()")
+		callers := map[string]bool{}
+		for _, bp := range bps {
+			if !bp.Tracepoint || !bp.Spawn {
+				t.Fatalf("not a spawn tracepoint: %v", bp)
+			}
+			callers[bp.FunctionName] = true
+		}
+		if len(bps) != 3 || !callers["main.main"] || !callers["main.start"] {
+			t.Fatalf("wrong go statements: %v", bps)
+		}
+
+		spawned := map[string]int{}
+		for range bps {
+			assertNoError(p.Continue(), t, "Continue()")
+			fn, err := p.SpawnedFunction()
+			assertNoError(err, t, "SpawnedFunction()")
+			spawned[fn.Name]++
+		}
+		for _, name := range []string{"main.producer", "main.consumer", "main.main.func1"} {
+			if spawned[name] != 1 {
+				t.Fatalf("%s spawned %d times: %v", name, spawned[name], spawned)
+			}
+		}
+		for _, bp := range bps {
+			if bp.HitCount != 1 {
+				t.Fatalf("go statement at %s:%d hit %d times", bp.File, bp.Line, bp.HitCount)
+			}
+		}
+	})
+}
+
+func TestProcessors(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		_, err := p.SetBreakpoint(p.goSymTable.LookupFunc("main.helloworld").Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		ps, err := p.Processors()
+		assertNoError(err, t, "Processors()")
+		// The fixture inherits the environment, and therefore
+		// GOMAXPROCS, of the test.
+		if len(ps) != runtime.GOMAXPROCS(0) {
+			t.Fatalf("wrong number of Ps: %d (expected: %d)", len(ps), runtime.GOMAXPROCS(0))
+		}
+		running := false
+		for _, pp := range ps {
+			if pp.Status == Prunning && pp.MId >= 0 {
+				running = true
+			}
+		}
+		if !running {
+			t.Fatalf("no running P bound to an M: %v", ps)
+		}
+	})
+}
+
+func TestReadStringUnmapped(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		_, err := p.SetBreakpoint(p.goSymTable.LookupFunc("main.helloworld").Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		// Find a writable mapping not followed by readable memory.
+		maps, err := p.MemoryMaps()
+		assertNoError(err, t, "MemoryMaps()")
+		var end uint64
+		for i := range maps {
+			if !strings.HasPrefix(maps[i].Perms, "rw") {
+				continue
+			}
+			if i+1 == len(maps) || maps[i+1].Start != maps[i].End || maps[i+1].Perms[0] != 'r' {
+				end = maps[i].End
+				break
+			}
+		}
+		if end == 0 {
+			t.Fatal("no writable mapping followed by unreadable memory")
+		}
+
+		// A string whose length extends past the end of the mapping.
+		data := end - 5
+		hdr := data - 16
+		buf := make([]byte, 21)
+		binary.LittleEndian.PutUint64(buf, data)
+		binary.LittleEndian.PutUint64(buf[8:], 100)
+		copy(buf[16:], "hello")
+		_, err = p.CurrentThread.writeMemory(uintptr(hdr), buf)
+		assertNoError(err, t, "writeMemory()")
+
+		s, err := p.CurrentThread.readString(uintptr(hdr))
+		assertNoError(err, t, "readString()")
+		if s != "hello...+95 more (unreadable)" {
+			t.Fatalf("wrong string: %q", s)
+		}
+	})
+}
+
+func TestMemoryMaps(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		_, err := p.SetBreakpoint(p.goSymTable.LookupFunc("main.helloworld").Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+		regs := getRegisters(p, t)
+
+		maps, err := p.MemoryMaps()
+		assertNoError(err, t, "MemoryMaps()")
+		var text *MemoryMap
+		for i := range maps {
+			if regs.PC() >= maps[i].Start && regs.PC() < maps[i].End {
+				text = &maps[i]
+			}
+		}
+		if text == nil {
+			t.Fatalf("no mapping contains the PC %#x", regs.PC())
+		}
+		if !strings.Contains(text.Perms, "x") {
+			t.Fatalf("mapping of the PC is not executable: %s", text.Perms)
+		}
+
+		kind, err := p.ClassifyAddress(regs.PC())
+		assertNoError(err, t, "ClassifyAddress(pc)")
+		if kind != "text" {
+			t.Fatalf("wrong classification for the PC: %q (expected: text)", kind)
+		}
+		g, err := p.CurrentThread.GetG()
+		assertNoError(err, t, "GetG()")
+		kind, err = p.ClassifyAddress(regs.SP())
+		assertNoError(err, t, "ClassifyAddress(sp)")
+		if expected := fmt.Sprintf("goroutine %d stack", g.Id); kind != expected {
+			t.Fatalf("wrong classification for the SP: %q (expected: %q)", kind, expected)
+		}
+	})
+}
+
+func TestHeapObjectInfo(t *testing.T) {
+	withTestProcess("heapprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		scope := &EvalScope{Thread: p.CurrentThread}
+		for _, tc := range []struct {
+			name string
+			size uint64
+		}{{"main.small", 100}, {"main.large", 100000}} {
+			name, size := tc.name, tc.size
+			v, err := scope.packageVarAddr(name)
+			assertNoError(err, t, fmt.Sprintf("packageVarAddr(%s)", name))
+			addr, err := p.CurrentThread.readUintRaw(v.Addr, int64(p.arch.PtrSize()))
+			assertNoError(err, t, "readUintRaw()")
+
+			// Any address inside the object resolves to its start.
+			obj, err := p.HeapObjectInfo(addr + size/2)
+			assertNoError(err, t, fmt.Sprintf("HeapObjectInfo(%s)", name))
+			if obj.Base != addr {
+				t.Fatalf("wrong base for %s: %#x (expected: %#x)", name, obj.Base, addr)
+			}
+			if obj.ElemSize < size || obj.ElemSize > 2*size {
+				t.Fatalf("implausible element size for %s: %d (object size: %d)", name, obj.ElemSize, size)
+			}
+			// Objects larger than 32KB get a span of their own.
+			if large := size > 32<<10; large != (obj.SizeClass == 0) {
+				t.Fatalf("wrong size class for %s: %d", name, obj.SizeClass)
+			}
+		}
+	})
+}
+
+func TestMspanLayout(t *testing.T) {
+	testcases := []struct {
+		ver    GoVersion
+		layout mspanLayout
+	}{
+		{GoVersion{1, 6, 0, 0, 0}, mspanLayout{}},
+		{GoVersion{1, 7, 0, 0, 0}, mspanLayout{startAddr: true}},
+		{GoVersion{1, 8, 0, 0, 0}, mspanLayout{startAddr: true, markBits: true}},
+		{GoVersion{1, 9, 0, 0, 0}, mspanLayout{startAddr: true, markBits: true, spanclass: true}},
+		{GoVersion{1, 10, 0, 0, 0}, mspanLayout{startAddr: true, markBits: true, spanclass: true, inUse: 1}},
+		{GoVersion{-1, 0, 0, 0, 0}, mspanLayout{startAddr: true, markBits: true, spanclass: true, inUse: 1}},
+	}
+	for _, tc := range testcases {
+		if l := mspanLayoutFor(tc.ver); l != tc.layout {
+			t.Fatalf("wrong mspan layout for %v: %+v (expected: %+v)", tc.ver, l, tc.layout)
+		}
+	}
+}
+
+func TestContinueExec(t *testing.T) {
+	// Exec events are only reported on linux.
+	if runtime.GOOS != "linux" {
+		return
+	}
+	fixture := protest.BuildFixture("execprog")
+	target := protest.BuildFixture("testprog")
+	p, err := Launch([]string{fixture.Path, target.Path})
+	if err != nil {
+		t.Fatal("Launch():", err)
+	}
+	defer func() {
+		p.Halt()
+		p.Kill()
+	}()
+
+	pc, err := p.FindFunctionLocation("main.main", true, 0)
+	assertNoError(err, t, "FindFunctionLocation()")
+	bp, err := p.SetBreakpoint(pc)
+	assertNoError(err, t, "SetBreakpoint()")
+	assertNoError(p.Continue(), t, "Continue()")
+	err = p.Continue()
+	execErr, ok := err.(ProcessExecError)
+	if !ok {
+		t.Fatalf("Continue() returned unexpected error %v", err)
+	}
+	if execErr.Path != target.Path {
+		t.Fatalf("wrong path for the new image: %q (expected: %q)", execErr.Path, target.Path)
+	}
+	if len(execErr.Breakpoints) != 1 || execErr.Breakpoints[0] != bp {
+		t.Fatalf("wrong breakpoints removed: %v", execErr.Breakpoints)
+	}
+	if len(p.Breakpoints) != 0 {
+		t.Fatalf("breakpoints of the old image left set: %v", p.Breakpoints)
+	}
+
+	helloworld := p.goSymTable.LookupFunc("main.helloworld")
+	if helloworld == nil {
+		t.Fatal("symbols of the new image not loaded")
+	}
+	_, err = p.SetBreakpoint(helloworld.Entry)
+	assertNoError(err, t, "SetBreakpoint()")
+	assertNoError(p.Continue(), t, "Continue()")
+	if pc := currentPC(p, t); pc != helloworld.Entry {
+		t.Fatalf("stopped at %#x instead of main.helloworld (%#x)", pc, helloworld.Entry)
+	}
+}
+
+func TestFollowFork(t *testing.T) {
+	// Fork events are only reported on linux.
+	if runtime.GOOS != "linux" {
+		return
+	}
+	withTestProcess("forkprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.SetFollowFork(true), t, "SetFollowFork()")
+		err := p.Continue()
+		forkErr, ok := err.(ProcessForkError)
+		if !ok {
+			t.Fatalf("Continue() returned unexpected error %v", err)
+		}
+		child := forkErr.Child
+		if child == nil || child.Pid == p.Pid {
+			t.Fatalf("no handle for the child process: %v", child)
+		}
+		if child.goSymTable.LookupFunc("main.main") == nil {
+			t.Fatal("symbols not loaded for the child process")
+		}
+
+		// Keep following the parent, the runtime may fork more than once.
+		for {
+			assertNoError(child.Detach(false), t, "Detach()")
+			err = p.Continue()
+			if _, exited := err.(ProcessExitedError); exited {
+				break
+			}
+			forkErr, ok := err.(ProcessForkError)
+			if !ok {
+				t.Fatalf("Continue() returned unexpected error %v", err)
+			}
+			child = forkErr.Child
+		}
+	})
+}
+
 func TestKill(t *testing.T) {
 	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
 		if err := p.Kill(); err != nil {
@@ -715,6 +2170,31 @@ func TestGetG(t *testing.T) {
 	})
 }
 
+func TestGetGFallback(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		pc, err := p.FindFunctionLocation("main.main", true, 0)
+		assertNoError(err, t, "FindFunctionLocation()")
+		_, err = p.SetBreakpoint(pc)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		tls, err := p.CurrentThread.TLSBase()
+		assertNoError(err, t, "TLSBase()")
+		if tls == 0 {
+			t.Fatal("TLS base is zero")
+		}
+		gaddr, err := p.CurrentThread.getGAddr()
+		assertNoError(err, t, "getGAddr()")
+		tlsg, err := parseG(p.CurrentThread, gaddr, false)
+		assertNoError(err, t, "parseG()")
+		scang, err := p.CurrentThread.scanG()
+		assertNoError(err, t, "scanG()")
+		if tlsg.Id != scang.Id {
+			t.Fatalf("goroutine mismatch, TLS: %d stack scan: %d", tlsg.Id, scang.Id)
+		}
+	})
+}
+
 func TestContinueMulti(t *testing.T) {
 	withTestProcess("integrationprog", t, func(p *Process, fixture protest.Fixture) {
 		bp1, err := setFunctionBreakpoint(p, "main.main")
@@ -791,6 +2271,56 @@ func TestBreakpointOnFunctionEntry(t *testing.T) {
 	})
 }
 
+func TestFunctions(t *testing.T) {
+	withTestProcess("testprog", t, func(p *Process, fixture protest.Fixture) {
+		find := func(funcs []Function, name string) *Function {
+			for i := range funcs {
+				if funcs[i].Name == name {
+					return &funcs[i]
+				}
+			}
+			return nil
+		}
+
+		funcs := p.Functions(false)
+		for i := 1; i < len(funcs); i++ {
+			if funcs[i].Entry < funcs[i-1].Entry {
+				t.Fatalf("functions not sorted by entry: %s at %#x after %s at %#x", funcs[i].Name, funcs[i].Entry, funcs[i-1].Name, funcs[i-1].Entry)
+			}
+		}
+		fn := find(funcs, "main.main")
+		if fn == nil {
+			t.Fatal("main.main not found")
+		}
+		if fn.Entry == 0 || fn.End <= fn.Entry {
+			t.Fatalf("implausible PC range for main.main: %#x-%#x", fn.Entry, fn.End)
+		}
+		if fn.File != fixture.Source {
+			t.Fatalf("wrong file for main.main: %q (expected: %q)", fn.File, fixture.Source)
+		}
+		if find(funcs, "runtime.main") == nil {
+			t.Fatal("runtime.main not found")
+		}
+
+		funcs = p.Functions(true)
+		if find(funcs, "main.main") == nil {
+			t.Fatal("main.main not found when excluding the standard library")
+		}
+		if fn := find(funcs, "runtime.main"); fn != nil {
+			t.Fatal("runtime.main returned when excluding the standard library")
+		}
+		std := p.stdSourceDir()
+		if std == "" {
+			t.Fatal("source directory of the standard library not found")
+		}
+		for _, fn := range funcs {
+			if strings.HasPrefix(fn.File, std) {
+				t.Fatalf("%s of %s returned when excluding the standard library", fn.Name, fn.File)
+			}
+		}
+	})
+}
+
 func TestProcessReceivesSIGCHLD(t *testing.T) {
 	withTestProcess("sigchldprog", t, func(p *Process, fixture protest.Fixture) {
 		err := p.Continue()
@@ -19,8 +19,12 @@ func PtraceCont(tid, sig int) error {
 	return sys.PtraceCont(tid, sig)
 }
 
-func PtraceSingleStep(tid int) error {
-	return sys.PtraceSingleStep(tid)
+func PtraceSingleStep(tid, sig int) error {
+	_, _, err := sys.Syscall6(sys.SYS_PTRACE, sys.PTRACE_SINGLESTEP, uintptr(tid), 0, uintptr(sig), 0, 0)
+	if err != syscall.Errno(0) {
+		return err
+	}
+	return nil
 }
 
 func PtracePokeUser(tid int, off, addr uintptr) error {
@@ -1,6 +1,10 @@
 package proc
 
-import "fmt"
+import (
+	"fmt"
+
+	sys "golang.org/x/sys/unix"
+)
 
 // An interface for a generic register type. The
 // interface encapsulates the generic values / actions
@@ -11,6 +15,8 @@ type Registers interface {
 	SP() uint64
 	CX() uint64
 	TLS() uint64
+	// Returns the register with the given DWARF register number.
+	DwarfRegister(regnum uint64) (uint64, error)
 	SetPC(*Thread, uint64) error
 	String() string
 }
@@ -18,6 +24,10 @@ type Registers interface {
 // Obtains register values from the debugged process.
 func (thread *Thread) Registers() (Registers, error) {
 	regs, err := registers(thread)
+	if err == sys.ESRCH {
+		// Returned as is, callers check it to skip threads that are gone.
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("could not get registers: %s", err)
 	}
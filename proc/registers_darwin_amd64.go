@@ -83,6 +83,21 @@ func (r *Regs) TLS() uint64 {
 	return r.gs_base
 }
 
+// DWARF register numbers for amd64, from the System V ABI.
+func (r *Regs) DwarfRegister(regnum uint64) (uint64, error) {
+	regs := []uint64{
+		r.rax, r.rdx, r.rcx, r.rbx,
+		r.rsi, r.rdi, r.rbp, r.rsp,
+		r.r8, r.r9, r.r10, r.r11,
+		r.r12, r.r13, r.r14, r.r15,
+		r.rip,
+	}
+	if regnum >= uint64(len(regs)) {
+		return 0, fmt.Errorf("unsupported DWARF register %d", regnum)
+	}
+	return regs[regnum], nil
+}
+
 func (r *Regs) SetPC(thread *Thread, pc uint64) error {
 	kret := C.set_pc(thread.os.thread_act, C.uint64_t(pc))
 	if kret != C.KERN_SUCCESS {
@@ -4,6 +4,9 @@ import "fmt"
 import "bytes"
 import sys "golang.org/x/sys/unix"
 
+// Trap flag (TF) bit of RFLAGS.
+const trapFlagBit = 0x100
+
 type Regs struct {
 	regs *sys.PtraceRegs
 }
@@ -64,6 +67,21 @@ func (r *Regs) TLS() uint64 {
 	return r.regs.Fs_base
 }
 
+// DWARF register numbers for amd64, from the System V ABI.
+func (r *Regs) DwarfRegister(regnum uint64) (uint64, error) {
+	regs := []uint64{
+		r.regs.Rax, r.regs.Rdx, r.regs.Rcx, r.regs.Rbx,
+		r.regs.Rsi, r.regs.Rdi, r.regs.Rbp, r.regs.Rsp,
+		r.regs.R8, r.regs.R9, r.regs.R10, r.regs.R11,
+		r.regs.R12, r.regs.R13, r.regs.R14, r.regs.R15,
+		r.regs.Rip,
+	}
+	if regnum >= uint64(len(regs)) {
+		return 0, fmt.Errorf("unsupported DWARF register %d", regnum)
+	}
+	return regs[regnum], nil
+}
+
 func (r *Regs) SetPC(thread *Thread, pc uint64) (err error) {
 	r.regs.SetPC(pc)
 	thread.dbp.execPtraceFunc(func() { err = sys.PtraceSetRegs(thread.Id, r.regs) })
@@ -20,12 +20,32 @@ type Stackframe struct {
 	Call Location
 	CFA  int64
 	Ret  uint64
+
+	// Arguments and local variables of the function, set by LoadVariables.
+	Arguments []*Variable
+	Locals    []*Variable
 }
 
 func (frame *Stackframe) Scope(thread *Thread) *EvalScope {
 	return &EvalScope{Thread: thread, PC: frame.Current.PC, CFA: frame.CFA}
 }
 
+// LoadVariables reads the arguments and local variables of the frame,
+// with their values read according to cfg.
+func (frame *Stackframe) LoadVariables(thread *Thread, cfg LoadConfig) error {
+	scope := frame.Scope(thread)
+	av, err := scope.FunctionArguments(cfg)
+	if err != nil {
+		return err
+	}
+	lv, err := scope.LocalVariables(cfg)
+	if err != nil {
+		return err
+	}
+	frame.Arguments, frame.Locals = av, lv
+	return nil
+}
+
 // Takes an offset from RSP and returns the address of the
 // instruction the current function is going to return to.
 func (thread *Thread) ReturnAddress() (uint64, error) {
@@ -0,0 +1,59 @@
+package proc
+
+import "fmt"
+
+// Target is the set of execution control methods used by clients
+// of this package. Process implements it by driving a live process
+// through ptrace (or mach on OS X), other backends, such as one
+// replaying a recorded execution, can implement it to be used in
+// its place, including the reverse execution methods which are not
+// available on a live process.
+type Target interface {
+	Continue() error
+	Next() error
+	Step() error
+	StepOut() error
+	StepInto() error
+	StepUserCode() error
+	Halt() error
+	RequestManualStop() error
+
+	ContinueBackwards() error
+	NextBackwards() error
+	StepBackwards() error
+	StepOutBackwards() error
+}
+
+// UnsupportedError is returned by the methods of a Target that its
+// backend is not able to implement.
+type UnsupportedError struct {
+	Op string
+}
+
+func (e UnsupportedError) Error() string {
+	return fmt.Sprintf("%s is not supported by this backend", e.Op)
+}
+
+// ContinueBackwards always fails, a live process can not be
+// executed in reverse.
+func (dbp *Process) ContinueBackwards() error {
+	return UnsupportedError{Op: "continue backwards"}
+}
+
+// NextBackwards always fails, a live process can not be
+// executed in reverse.
+func (dbp *Process) NextBackwards() error {
+	return UnsupportedError{Op: "next backwards"}
+}
+
+// StepBackwards always fails, a live process can not be
+// executed in reverse.
+func (dbp *Process) StepBackwards() error {
+	return UnsupportedError{Op: "step backwards"}
+}
+
+// StepOutBackwards always fails, a live process can not be
+// executed in reverse.
+func (dbp *Process) StepOutBackwards() error {
+	return UnsupportedError{Op: "step out backwards"}
+}
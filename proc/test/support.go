@@ -24,7 +24,17 @@ type Fixture struct {
 var Fixtures map[string]Fixture = make(map[string]Fixture)
 
 func BuildFixture(name string) Fixture {
-	if f, ok := Fixtures[name]; ok {
+	return buildFixture(name, name, "-gcflags=-N -l")
+}
+
+// BuildOptimizedFixture builds the fixture with compiler optimizations
+// and inlining enabled, as a release build would be.
+func BuildOptimizedFixture(name string) Fixture {
+	return buildFixture(name, name+".optimized")
+}
+
+func buildFixture(name, key string, flags ...string) Fixture {
+	if f, ok := Fixtures[key]; ok {
 		return f
 	}
 	parent := ".."
@@ -43,14 +53,16 @@ func BuildFixture(name string) Fixture {
 	tmpfile := filepath.Join(os.TempDir(), fmt.Sprintf("%s.%s", name, hex.EncodeToString(r)))
 
 	// Build the test binary
-	if err := exec.Command("go", "build", "-gcflags=-N -l", "-o", tmpfile, path).Run(); err != nil {
+	args := append([]string{"build"}, flags...)
+	args = append(args, "-o", tmpfile, path)
+	if err := exec.Command("go", args...).Run(); err != nil {
 		fmt.Printf("Error compiling %s: %s\n", path, err)
 		os.Exit(1)
 	}
 
 	source, _ := filepath.Abs(path)
-	Fixtures[name] = Fixture{Name: name, Path: tmpfile, Source: source}
-	return Fixtures[name]
+	Fixtures[key] = Fixture{Name: name, Path: tmpfile, Source: source}
+	return Fixtures[key]
 }
 
 // RunTestsWithFixtures will pre-compile test fixtures before running test
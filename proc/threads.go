@@ -4,6 +4,7 @@ import (
 	"debug/gosym"
 	"encoding/binary"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	sys "golang.org/x/sys/unix"
@@ -21,9 +22,12 @@ type Thread struct {
 	Id                int             // Thread ID or mach port
 	Status            *sys.WaitStatus // Status returned from last wait call
 	CurrentBreakpoint *Breakpoint     // Breakpoint thread is currently stopped at
+	CurrentWatchpoint *Watchpoint     // Watchpoint thread is currently stopped at
 
 	dbp            *Process
 	singleStepping bool
+	trapFlag       bool        // Set by SetSingleStep, the thread stops after every instruction.
+	liftedBp       *Breakpoint // Breakpoint removed by Continue while trapFlag is set.
 	running        bool
 	os             *OSSpecificDetails
 }
@@ -48,6 +52,20 @@ func (thread *Thread) Continue() error {
 	if err != nil {
 		return err
 	}
+	if thread.trapFlag {
+		if err := thread.restoreLiftedBreakpoint(); err != nil {
+			return err
+		}
+		// Stepping over the breakpoint would execute two instructions,
+		// instead remove it until the thread traps again.
+		if bp, ok := thread.dbp.Breakpoints[pc]; ok {
+			if _, err := bp.Clear(thread); err != nil {
+				return err
+			}
+			thread.liftedBp = bp
+		}
+		return thread.resume()
+	}
 	// Check whether we are stopped at a breakpoint, and
 	// if so, single step over it before continuing.
 	if _, ok := thread.dbp.FindBreakpoint(pc); ok {
@@ -58,6 +76,42 @@ func (thread *Thread) Continue() error {
 	return thread.resume()
 }
 
+// SetSingleStep sets or clears the CPU trap flag of the thread. While
+// it is set every Continue stops the thread again after executing a
+// single instruction, allowing clients to implement their own stepping
+// loops. When the thread stops at the address of a breakpoint, the
+// breakpoint is reported as its current breakpoint, without being
+// executed, and the next Continue executes the original instruction.
+func (thread *Thread) SetSingleStep(enable bool) error {
+	if err := thread.setSingleStep(enable); err != nil {
+		return fmt.Errorf("could not set trap flag: %s", err)
+	}
+	thread.trapFlag = enable
+	if !enable {
+		return thread.restoreLiftedBreakpoint()
+	}
+	return nil
+}
+
+// SingleStep reports whether the trap flag was set with SetSingleStep.
+func (thread *Thread) SingleStep() bool {
+	return thread.trapFlag
+}
+
+// Writes back the breakpoint removed by Continue, if it was not
+// cleared in the meantime.
+func (thread *Thread) restoreLiftedBreakpoint() error {
+	bp := thread.liftedBp
+	if bp == nil {
+		return nil
+	}
+	thread.liftedBp = nil
+	if _, ok := thread.dbp.Breakpoints[bp.Addr]; !ok {
+		return nil
+	}
+	return thread.dbp.writeSoftwareBreakpoint(thread, bp.Addr)
+}
+
 // Step a single instruction.
 //
 // Executes exactly one instruction and then returns.
@@ -142,7 +196,7 @@ func (thread *Thread) setNextBreakpoints() (err error) {
 		return err
 	}
 	if g.DeferPC != 0 {
-		if _, err = thread.dbp.SetTempBreakpoint(g.DeferPC); err != nil {
+		if _, err = thread.dbp.setInternalBreakpoint(g.DeferPC); err != nil {
 			return err
 		}
 	}
@@ -235,7 +289,7 @@ func (thread *Thread) setNextTempBreakpoints(curpc uint64, pcs []uint64) error {
 		if pcs[i] == curpc || pcs[i] == curpc-1 {
 			continue
 		}
-		if _, err := thread.dbp.SetTempBreakpoint(pcs[i]); err != nil {
+		if _, err := thread.dbp.setInternalBreakpoint(pcs[i]); err != nil {
 			if _, ok := err.(BreakpointExistsError); !ok {
 				return err
 			}
@@ -253,6 +307,65 @@ func (thread *Thread) SetPC(pc uint64) error {
 	return regs.SetPC(thread, pc)
 }
 
+// Longest possible x86-64 instruction, in bytes.
+const maxInstructionLength = 15
+
+// Returns the bytes of the instruction at the current PC, as they are
+// in the executable: the bytes of any breakpoint installed there are
+// replaced by the original data. Since instructions are not decoded
+// the maximum instruction length is read, or less if the code ends
+// before it, callers must only rely on the bytes that belong to the
+// instruction.
+func (thread *Thread) InstructionAtPC() ([]byte, error) {
+	pc, err := thread.PC()
+	if err != nil {
+		return nil, err
+	}
+	return thread.readInstructions(pc, maxInstructionLength)
+}
+
+// Reads up to size bytes of code starting at addr, replacing the bytes
+// of the breakpoints installed in that range by the original data. Fewer
+// bytes are returned if the memory after addr can not be read, i.e. at
+// the end of the last page of code.
+func (thread *Thread) readInstructions(addr uint64, size int) ([]byte, error) {
+	mem, err := thread.readMemoryPrefix(uintptr(addr), size)
+	if len(mem) == 0 {
+		return nil, err
+	}
+	for _, bp := range thread.dbp.Breakpoints {
+		if bp.Addr >= addr && bp.Addr < addr+uint64(len(mem)) {
+			copy(mem[bp.Addr-addr:], bp.OriginalData)
+		}
+	}
+	return mem, nil
+}
+
+// Reads size bytes starting at addr like readMemory but, if that fails,
+// reads them a page at a time and returns the bytes preceding the first
+// page that can not be read, together with the error.
+func (thread *Thread) readMemoryPrefix(addr uintptr, size int) ([]byte, error) {
+	data, err := thread.readMemory(addr, size)
+	if err == nil {
+		return data, nil
+	}
+	pageSize := uintptr(os.Getpagesize())
+	data = make([]byte, 0, size)
+	for len(data) < size {
+		start := addr + uintptr(len(data))
+		n := int(pageSize - start%pageSize)
+		if n > size-len(data) {
+			n = size - len(data)
+		}
+		page, err := thread.readMemory(start, n)
+		if err != nil {
+			return data, err
+		}
+		data = append(data, page...)
+	}
+	return data, nil
+}
+
 // Returns information on the G (goroutine) that is executing on this thread.
 //
 // The G structure for a thread is stored in thread local memory. Execute instructions
@@ -267,30 +380,97 @@ func (thread *Thread) SetPC(pc uint64) error {
 // any thread, regardless of OS.
 //
 // In order to get around all this craziness, we read the address of the G structure for
-// the current thread from the thread local storage area.
+// the current thread from the thread local storage area, see getGAddr. Should that fail,
+// as it can with unusual TLS setups, the goroutine is looked for with scanG instead,
+// unless the thread is known to run no goroutine (NoGError).
 func (thread *Thread) GetG() (g *G, err error) {
+	gaddr, err := thread.getGAddr()
+	if err == nil {
+		g, err = parseG(thread, gaddr, false)
+	}
+	if err != nil {
+		switch err.(type) {
+		case gOffsetError, NoGError:
+			// Neither is caused by an unusual TLS setup, which is all
+			// scanG works around.
+			return nil, err
+		}
+		if sg, serr := thread.scanG(); serr == nil {
+			g, err = sg, nil
+		}
+	}
+	if err == nil {
+		g.thread = thread
+	}
+	return
+}
+
+// TLSBase returns the base address of the thread local storage area
+// of the thread, as read from the architecture specific register
+// (the FS segment base on linux/amd64, GS on darwin/amd64).
+func (thread *Thread) TLSBase() (uint64, error) {
 	regs, err := thread.Registers()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	return regs.TLS(), nil
+}
+
+type gOffsetError struct{}
+
+func (gOffsetError) Error() string {
+	return "g struct offset not initialized"
+}
 
+// Returns the address of the G running on the thread, stored by the
+// runtime in the TLS area at the offset given by the architecture's
+// GStructOffset, which depends on the Go version and on whether the
+// program was linked externally (cgo).
+func (thread *Thread) getGAddr() (uint64, error) {
 	if thread.dbp.arch.GStructOffset() == 0 {
 		// GetG was called through SwitchThread / updateThreadList during initialization
 		// thread.dbp.arch isn't setup yet (it needs a CurrentThread to read global variables from)
-		return nil, fmt.Errorf("g struct offset not initialized")
+		return 0, gOffsetError{}
 	}
-
-	gaddrbs, err := thread.readMemory(uintptr(regs.TLS()+thread.dbp.arch.GStructOffset()), thread.dbp.arch.PtrSize())
+	tls, err := thread.TLSBase()
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	gaddrbs, err := thread.readMemory(uintptr(tls+thread.dbp.arch.GStructOffset()), thread.dbp.arch.PtrSize())
+	if err != nil {
+		return 0, err
 	}
 	gaddr := binary.LittleEndian.Uint64(gaddrbs)
+	if gaddr == 0 {
+		return 0, NoGError{tid: thread.Id}
+	}
+	return gaddr, nil
+}
 
-	g, err = parseG(thread, gaddr, false)
-	if err == nil {
-		g.thread = thread
+// Looks for the G running on the thread by searching runtime.allg for
+// the goroutine whose stack contains the stack pointer of the thread.
+// This does not depend on TLS but will not find the G of a thread that
+// is running on its system stack (g0), as those are not in allg.
+func (thread *Thread) scanG() (*G, error) {
+	regs, err := thread.Registers()
+	if err != nil {
+		return nil, err
 	}
-	return
+	sp := regs.SP()
+	entries, err := thread.dbp.allgEntries()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		g, err := parseG(thread, entry, true)
+		if err != nil {
+			continue
+		}
+		if g.Status != Gdead && g.StackLo <= sp && sp < g.StackHi {
+			return g, nil
+		}
+	}
+	return nil, NoGError{tid: thread.Id}
 }
 
 // Returns whether the thread is stopped at
@@ -323,3 +503,37 @@ func (thread *Thread) Scope() (*EvalScope, error) {
 	}
 	return locations[0].Scope(thread), nil
 }
+
+// Programs the debug registers of the thread with the given watchpoints,
+// DR0-DR3 hold the addresses and DR7 enables them.
+func (thread *Thread) setWatchpoints(wps map[uint64]*Watchpoint) error {
+	var dr7 uint64
+	for _, wp := range wps {
+		if err := thread.writeDebugRegister(wp.reg, wp.Addr); err != nil {
+			return err
+		}
+		dr7 |= wp.dr7()
+	}
+	return thread.writeDebugRegister(7, dr7)
+}
+
+// Returns the watchpoint that trapped the thread, if any, according to
+// the debug status register DR6, which is then reset.
+func (thread *Thread) watchpointHit() (*Watchpoint, error) {
+	dr6, err := thread.readDebugRegister(6)
+	if err != nil {
+		return nil, err
+	}
+	if dr6&0xf == 0 {
+		return nil, nil
+	}
+	if err := thread.writeDebugRegister(6, 0); err != nil {
+		return nil, err
+	}
+	for _, wp := range thread.dbp.Watchpoints {
+		if dr6&(1<<uint(wp.reg)) != 0 {
+			return wp, nil
+		}
+	}
+	return nil, nil
+}
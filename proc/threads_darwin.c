@@ -135,3 +135,21 @@ thread_blocked(thread_act_t thread) {
 
 	return info.suspend_count;
 }
+
+kern_return_t
+set_trap_flag(thread_act_t thread, int enable) {
+	kern_return_t kret;
+	x86_thread_state64_t regs;
+	mach_msg_type_number_t count = x86_THREAD_STATE64_COUNT;
+
+	kret = thread_get_state(thread, x86_THREAD_STATE64, (thread_state_t)&regs, &count);
+	if (kret != KERN_SUCCESS) return kret;
+
+	if (enable) {
+		regs.__rflags |= 0x100UL;
+	} else {
+		regs.__rflags &= ~0x100UL;
+	}
+
+	return thread_set_state(thread, x86_THREAD_STATE64, (thread_state_t)&regs, count);
+}
@@ -27,10 +27,27 @@ func (t *Thread) singleStep() error {
 	if kret != C.KERN_SUCCESS {
 		return fmt.Errorf("could not single step")
 	}
-	t.dbp.trapWait(0)
-	kret = C.clear_trap_flag(t.os.thread_act)
-	if kret != C.KERN_SUCCESS {
-		return fmt.Errorf("could not clear CPU trap flag")
+	_, werr := t.dbp.trapWait(0)
+	// Leave the flag alone if it was set by SetSingleStep.
+	if !t.trapFlag {
+		kret = C.clear_trap_flag(t.os.thread_act)
+		if kret != C.KERN_SUCCESS {
+			return fmt.Errorf("could not clear CPU trap flag")
+		}
+	}
+	if _, timeout := werr.(WaitTimeoutError); timeout {
+		return werr
+	}
+	return nil
+}
+
+func (t *Thread) setSingleStep(enable bool) error {
+	var flag C.int
+	if enable {
+		flag = 1
+	}
+	if kret := C.set_trap_flag(t.os.thread_act, flag); kret != C.KERN_SUCCESS {
+		return fmt.Errorf("%s", C.GoString(C.mach_error_string(C.mach_error_t(kret))))
 	}
 	return nil
 }
@@ -72,6 +89,11 @@ func (thread *Thread) stopped() bool {
 	return C.thread_blocked(thread.os.thread_act) > C.int(0)
 }
 
+// Exec is not reported on darwin, threads are never left behind by it.
+func (thread *Thread) exists() bool {
+	return true
+}
+
 func (thread *Thread) writeMemory(addr uintptr, data []byte) (int, error) {
 	if len(data) == 0 {
 		return 0, nil
@@ -104,3 +126,11 @@ func (thread *Thread) readMemory(addr uintptr, size int) ([]byte, error) {
 	}
 	return buf, nil
 }
+
+func (thread *Thread) readDebugRegister(reg int) (uint64, error) {
+	return 0, fmt.Errorf("hardware watchpoints are not supported on darwin")
+}
+
+func (thread *Thread) writeDebugRegister(reg int, val uint64) error {
+	return fmt.Errorf("hardware watchpoints are not supported on darwin")
+}
@@ -22,6 +22,9 @@ single_step(thread_act_t);
 kern_return_t
 clear_trap_flag(thread_act_t);
 
+kern_return_t
+set_trap_flag(thread_act_t, int);
+
 kern_return_t
 resume_thread(thread_act_t);
 
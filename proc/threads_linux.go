@@ -9,7 +9,9 @@ import (
 // Not actually used, but necessary
 // to be defined.
 type OSSpecificDetails struct {
-	registers sys.PtraceRegs
+	registers   sys.PtraceRegs
+	haltPending bool       // The SIGSTOP sent by halt has not been delivered yet.
+	pendingSig  sys.Signal // Signal raised while stepping, delivered when the thread runs again.
 }
 
 func (t *Thread) halt() (err error) {
@@ -18,32 +20,104 @@ func (t *Thread) halt() (err error) {
 		err = fmt.Errorf("halt err %s on thread %d", err, t.Id)
 		return
 	}
-	_, _, err = wait(t.Id, t.dbp.Pid, 0)
+	_, status, err := t.dbp.waitTimeout(t.Id)
 	if err != nil {
-		err = fmt.Errorf("wait err %s on thread %d", err, t.Id)
+		if _, timeout := err.(WaitTimeoutError); !timeout {
+			err = fmt.Errorf("wait err %s on thread %d", err, t.Id)
+		}
 		return
 	}
+	if status != nil && status.Stopped() && status.StopSignal() == sys.SIGTRAP {
+		// The thread hit a breakpoint before the SIGSTOP, which is left
+		// pending, was delivered. Move it back on the breakpoint so that
+		// the hit is not lost and reported later from a stale stop.
+		t.os.haltPending = true
+		err = t.rewindBreakpoint()
+	}
 	return
 }
 
+// Moves the thread back to the start of the breakpoint it executed, if
+// it is stopped right after one.
+func (t *Thread) rewindBreakpoint() error {
+	pc, err := t.PC()
+	if err != nil {
+		return err
+	}
+	if bp, ok := t.dbp.Breakpoints[pc-uint64(t.dbp.arch.BreakpointSize())]; ok {
+		return t.SetPC(bp.Addr)
+	}
+	return nil
+}
+
 func (thread *Thread) stopped() bool {
 	state := status(thread.Id)
 	return state == STATUS_TRACE_STOP
 }
 
+// Reports whether the thread is still alive in /proc/<pid>/task. A
+// thread killed by another thread calling exec disappears from it, or
+// is left there as a zombie until it is reaped.
+func (thread *Thread) exists() bool {
+	switch threadStatus(thread.dbp.Pid, thread.Id) {
+	case '\000', STATUS_ZOMBIE, STATUS_DEAD:
+		return false
+	}
+	return true
+}
+
 func (t *Thread) resume() (err error) {
 	t.running = true
-	t.dbp.execPtraceFunc(func() { err = PtraceCont(t.Id, 0) })
+	sig := t.os.pendingSig
+	t.os.pendingSig, t.os.haltPending = 0, false
+	t.dbp.execPtraceFunc(func() { err = PtraceCont(t.Id, int(sig)) })
 	return
 }
 
 func (t *Thread) singleStep() (err error) {
-	t.dbp.execPtraceFunc(func() { err = sys.PtraceSingleStep(t.Id) })
+	for {
+		sig := t.os.pendingSig
+		t.os.pendingSig = 0
+		t.dbp.execPtraceFunc(func() { err = PtraceSingleStep(t.Id, int(sig)) })
+		if err != nil {
+			return err
+		}
+		_, status, err := t.dbp.waitTimeout(t.Id)
+		if err != nil {
+			return err
+		}
+		if status == nil || !status.Stopped() || status.StopSignal() == sys.SIGTRAP {
+			return nil
+		}
+		if status.StopSignal() == sys.SIGSTOP && t.os.haltPending {
+			// The SIGSTOP of a halt that raced with a breakpoint stopped
+			// the thread before the instruction was executed. Discard
+			// it and step again.
+			t.os.haltPending = false
+			continue
+		}
+		// The instruction raised a signal, i.e. a SIGSEGV for a nil
+		// dereference. Stepping it again would only fault again: keep
+		// the signal for the next step or resume, which run the handler
+		// of the program.
+		t.os.pendingSig = status.StopSignal()
+		return nil
+	}
+}
+
+func (t *Thread) setSingleStep(enable bool) (err error) {
+	var regs sys.PtraceRegs
+	t.dbp.execPtraceFunc(func() { err = sys.PtraceGetRegs(t.Id, &regs) })
 	if err != nil {
-		return err
+		return
 	}
-	_, _, err = wait(t.Id, t.dbp.Pid, 0)
-	return err
+	if enable {
+		regs.Eflags |= trapFlagBit
+	} else {
+		regs.Eflags &^= trapFlagBit
+	}
+	t.dbp.execPtraceFunc(func() { err = sys.PtraceSetRegs(t.Id, &regs) })
+	return
 }
 
 func (t *Thread) blocked() bool {
@@ -85,3 +159,18 @@ func (thread *Thread) readMemory(addr uintptr, size int) (data []byte, err error
 	thread.dbp.execPtraceFunc(func() { _, err = sys.PtracePeekData(thread.Id, addr, data) })
 	return
 }
+
+// Offset of u_debugreg in struct user, the debug registers are read
+// and written by PTRACE_PEEKUSER and PTRACE_POKEUSER.
+const debugRegOffset = 848
+
+func (thread *Thread) readDebugRegister(reg int) (val uint64, err error) {
+	var v uintptr
+	thread.dbp.execPtraceFunc(func() { v, err = PtracePeekUser(thread.Id, uintptr(debugRegOffset+reg*8)) })
+	return uint64(v), err
+}
+
+func (thread *Thread) writeDebugRegister(reg int, val uint64) (err error) {
+	thread.dbp.execPtraceFunc(func() { err = PtracePokeUser(thread.Id, uintptr(debugRegOffset+reg*8), uintptr(val)) })
+	return
+}
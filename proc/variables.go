@@ -22,6 +22,17 @@ const (
 	maxArrayValues     = 64 // Max value for reading large arrays.
 	maxErrCount        = 3  // Max number of read errors to accept while evaluating slices, arrays and structs
 
+	// Hard limits on the bytes of a string and the elements of an array
+	// or slice read whatever the LoadConfig, their length is read from
+	// the target and can be garbage, i.e. for an uninitialized variable.
+	maxStringLenLimit   = 1 << 20
+	maxArrayValuesLimit = 1 << 16
+
+	kindDirectIface = 1 << 5 // Set in runtime._type.kind when the value is stored in the interface data word
+
+	reflectFlagIndirGo15 = 1 << 6 // Set in reflect.Value.flag when ptr points to the value, before Go 1.6
+	reflectFlagIndir     = 1 << 7 // Set in reflect.Value.flag when ptr points to the value
+
 	ChanRecv = "chan receive"
 	ChanSend = "chan send"
 )
@@ -40,6 +51,28 @@ type Variable struct {
 	base      uintptr
 	stride    int64
 	fieldType dwarf.Type
+
+	fnEntry uint64 // Entry PC, for variables that name a function.
+
+	// Contents of the register holding the value of a variable that is
+	// not in memory, nil for variables read from Addr.
+	regValue []byte
+}
+
+// VariableDiff is a value found to differ by Variable.Diff.
+type VariableDiff struct {
+	Path  string // Path of the value relative to the compared variables, e.g. "A.B[2]".
+	Left  string // Value in the receiver of Diff.
+	Right string // Value in the argument of Diff.
+}
+
+// MapStats describes how a map is laid out in memory.
+type MapStats struct {
+	Count      int64   // Number of entries.
+	Buckets    int64   // Number of buckets.
+	Overflow   int64   // Approximate number of overflow buckets, -1 if the runtime does not track it.
+	Growing    bool    // Whether entries are being moved to a new bucket array.
+	LoadFactor float64 // Average number of entries per bucket.
 }
 
 // Represents a runtime M (OS thread) structure.
@@ -63,6 +96,23 @@ const (
 	Gcopystack                     // 8 in this state when newstack is moving the stack
 )
 
+// Represents a runtime P (processor) structure.
+type P struct {
+	Id       int    // Processor ID.
+	Status   uint64 // One of the P status constants below.
+	MId      int    // ID of the M (thread) the P is bound to, -1 if none.
+	RunqSize int    // Number of goroutines in the local run queue.
+}
+
+const (
+	// P status, from: src/runtime/runtime2.go
+	Pidle    uint64 = iota // 0
+	Prunning               // 1 owned by an M running user code or the scheduler
+	Psyscall               // 2
+	Pgcstop                // 3
+	Pdead                  // 4
+)
+
 // Represents a runtime G (goroutine) structure (at least the
 // fields that Delve is interested in).
 type G struct {
@@ -81,8 +131,27 @@ type G struct {
 	// PC of entry to top-most deferred function.
 	DeferPC uint64
 
+	// Number of deferred calls pending and of panics in progress,
+	// -1 if the list could not be read.
+	Defers int
+	Panics int
+
+	// Bounds of the goroutine's stack, [StackLo, StackHi).
+	StackLo uint64
+	StackHi uint64
+
 	// Thread that this goroutine is currently allocated to
 	thread *Thread
+
+	addr uint64 // Address of the runtime.g structure.
+}
+
+// Ancestor is a goroutine that created, directly or through other
+// goroutines, another goroutine.
+type Ancestor struct {
+	Id    int        // Goroutine ID of the ancestor.
+	GoPC  uint64     // PC of the go statement executed by the ancestor.
+	Stack []Location // Stack of the ancestor when it executed the go statement.
 }
 
 // Scope for variable evaluation
@@ -132,6 +201,67 @@ func (v *Variable) toField(field *dwarf.StructField) (*Variable, error) {
 	return newVariable(name, uintptr(int64(v.Addr)+field.ByteOffset), field.Type, v.thread)
 }
 
+// Reads the fields of the runtime.p structure v, locating them by name.
+func (v *Variable) parseP() (*P, error) {
+	t, ok := v.resolveTypedefs().dwarfType.(*dwarf.StructType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for runtime.p", v.dwarfType)
+	}
+	p := &P{MId: -1}
+	var runqhead, runqtail uint64
+	for _, field := range t.Field {
+		switch field.Name {
+		case "id", "status", "m", "runqhead", "runqtail":
+		default:
+			continue
+		}
+		val, err := v.thread.readUintRaw(uintptr(int64(v.Addr)+field.ByteOffset), field.Type.Size())
+		if err != nil {
+			return nil, err
+		}
+		switch field.Name {
+		case "id":
+			p.Id = int(int32(val))
+		case "status":
+			p.Status = val
+		case "m":
+			if val != 0 {
+				if p.MId, err = v.thread.readMId(val); err != nil {
+					return nil, err
+				}
+			}
+		case "runqhead":
+			runqhead = val
+		case "runqtail":
+			runqtail = val
+		}
+	}
+	p.RunqSize = int(uint32(runqtail - runqhead))
+	return p, nil
+}
+
+// Reads the id field of the runtime.m structure at maddr.
+func (thread *Thread) readMId(maddr uint64) (int, error) {
+	rdr := thread.dbp.DwarfReader()
+	entry, err := rdr.SeekToTypeNamed("runtime.m")
+	if err != nil {
+		return 0, err
+	}
+	typ, err := thread.dbp.dwarf.Type(entry.Offset)
+	if err != nil {
+		return 0, err
+	}
+	if t, ok := typ.(*dwarf.StructType); ok {
+		for _, field := range t.Field {
+			if field.Name == "id" {
+				id, err := thread.readUintRaw(uintptr(int64(maddr)+field.ByteOffset), field.Type.Size())
+				return int(int32(id)), err
+			}
+		}
+	}
+	return 0, fmt.Errorf("could not find runtime.m id")
+}
+
 func (scope *EvalScope) DwarfReader() *reader.Reader {
 	return scope.Thread.dbp.DwarfReader()
 }
@@ -150,6 +280,12 @@ func (g *G) ChanRecvBlocked() bool {
 	return g.WaitReason == ChanRecv
 }
 
+// Returns whether the goroutine is blocked on
+// a channel send operation.
+func (g *G) ChanSendBlocked() bool {
+	return g.WaitReason == ChanSend
+}
+
 // chanRecvReturnAddr returns the address of the return from a channel read.
 func (g *G) chanRecvReturnAddr(dbp *Process) (uint64, error) {
 	locs, err := dbp.stacktrace(g.PC, g.SP, 4)
@@ -221,6 +357,24 @@ func parseG(thread *Thread, gaddr uint64, deref bool) (*G, error) {
 		}
 	}
 
+	defers, err := countLinks(thread, deferAddr, "runtime._defer")
+	if err != nil {
+		defers = -1
+	}
+	// Parse panic, which precedes _defer.
+	err = rdr.SeekToEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+	panicAddr, err := rdr.AddrForMember("_panic", initialInstructions)
+	if err != nil {
+		return nil, err
+	}
+	panics, err := countLinks(thread, panicAddr, "runtime._panic")
+	if err != nil {
+		panics = -1
+	}
+
 	// Let's parse all of the members we care about in order so that
 	// we don't have to spend any extra time seeking.
 
@@ -229,6 +383,20 @@ func parseG(thread *Thread, gaddr uint64, deref bool) (*G, error) {
 		return nil, err
 	}
 
+	// Parse stack
+	stackAddr, err := rdr.AddrForMember("stack", initialInstructions)
+	if err != nil {
+		return nil, err
+	}
+	// From stack, let's parse lo and hi.
+	stacklo, err := thread.readUintRaw(uintptr(stackAddr), 8)
+	if err != nil {
+		return nil, err
+	}
+	stackhi, err := thread.readUintRaw(uintptr(stackAddr+uint64(thread.dbp.arch.PtrSize())), 8)
+	if err != nil {
+		return nil, err
+	}
 	// Parse sched
 	schedAddr, err := rdr.AddrForMember("sched", initialInstructions)
 	if err != nil {
@@ -288,41 +456,234 @@ func parseG(thread *Thread, gaddr uint64, deref bool) (*G, error) {
 		Func:       fn,
 		WaitReason: waitreason,
 		DeferPC:    deferPC,
+		Defers:     defers,
+		Panics:     panics,
 		Status:     atomicStatus,
+		StackLo:    stacklo,
+		StackHi:    stackhi,
+		addr:       gaddr,
 	}
 	return g, nil
 }
 
-// Returns information for the named variable.
-func (scope *EvalScope) ExtractVariableInfo(name string) (*Variable, error) {
-	varName := name
-	memberName := ""
-	if strings.Contains(name, ".") {
-		idx := strings.Index(name, ".")
-		varName = name[:idx]
-		memberName = name[idx+1:]
+// Longest list countLinks follows, a corrupted list could be circular.
+const maxLinks = 10000
+
+// Returns the length of the list of typename structures chained through
+// their link field, whose first element is pointed to from addr.
+func countLinks(thread *Thread, addr uint64, typename string) (int, error) {
+	var link int64
+	for n := 0; n < maxLinks; n++ {
+		ptr, err := thread.readUintRaw(uintptr(addr), int64(thread.dbp.arch.PtrSize()))
+		if err != nil {
+			return 0, err
+		}
+		if ptr == 0 {
+			return n, nil
+		}
+		// Most lists are empty, only look up the type when needed.
+		if n == 0 {
+			if link, err = thread.dbp.linkOffset(typename); err != nil {
+				return 0, err
+			}
+		}
+		addr = uint64(int64(ptr) + link)
+	}
+	return 0, fmt.Errorf("%s list longer than %d", typename, maxLinks)
+}
+
+// Returns the offset of the link field of the typename structure, read
+// from the debug info once per executable.
+func (dbp *Process) linkOffset(typename string) (int64, error) {
+	if off, ok := dbp.linkOffsets[typename]; ok {
+		return off, nil
+	}
+	rdr := dbp.DwarfReader()
+	entry, err := rdr.SeekToTypeNamed(typename)
+	if err != nil {
+		return 0, err
+	}
+	typ, err := dbp.dwarf.Type(entry.Offset)
+	if err != nil {
+		return 0, err
+	}
+	if t, ok := typ.(*dwarf.StructType); ok {
+		for _, field := range t.Field {
+			if field.Name == "link" {
+				if dbp.linkOffsets == nil {
+					dbp.linkOffsets = make(map[string]int64)
+				}
+				dbp.linkOffsets[typename] = field.ByteOffset
+				return field.ByteOffset, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("could not find %s link", typename)
+}
+
+// Ancestors returns the goroutines that created g, its creator first,
+// as recorded by the runtime when the program runs with
+// GODEBUG=tracebackancestors=N. The list is empty if the program was
+// run without it, or built by a Go version not supporting it.
+func (dbp *Process) Ancestors(g *G) ([]Ancestor, error) {
+	thread := dbp.CurrentThread
+	rdr := reader.New(dbp.dwarf)
+	entry, err := rdr.SeekToTypeNamed("runtime.g")
+	if err != nil {
+		return nil, err
+	}
+	gtype, err := dbp.dwarf.Type(entry.Offset)
+	if err != nil {
+		return nil, err
+	}
+	gv, err := newVariable("g", uintptr(g.addr), gtype, thread)
+	if err != nil {
+		return nil, err
+	}
+	// ancestors *[]ancestorInfo
+	field, err := gv.structMember("ancestors")
+	if err != nil {
+		return nil, nil
+	}
+	ptrSize := int64(dbp.arch.PtrSize())
+	sliceAddr, err := thread.readUintRaw(field.Addr, ptrSize)
+	if err != nil || sliceAddr == 0 {
+		return nil, err
+	}
+	ptrType, ok := resolveTypedefs(field.dwarfType).(*dwarf.PtrType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for g.ancestors", field.dwarfType)
+	}
+	sliceType, ok := resolveTypedefs(ptrType.Type).(*dwarf.StructType)
+	if !ok || len(sliceType.Field) == 0 {
+		return nil, fmt.Errorf("unexpected type %s for g.ancestors", ptrType.Type)
+	}
+	elemPtr, ok := resolveTypedefs(sliceType.Field[0].Type).(*dwarf.PtrType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s for g.ancestors", ptrType.Type)
+	}
+	base, n, err := readSliceHeader(thread, uintptr(sliceAddr))
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors := make([]Ancestor, 0, n)
+	for i := uint64(0); i < n; i++ {
+		elem, err := newVariable("", uintptr(base+i*uint64(elemPtr.Type.Size())), elemPtr.Type, thread)
+		if err != nil {
+			return nil, err
+		}
+		var a Ancestor
+		goid, err := elem.structMember("goid")
+		if err != nil {
+			return nil, err
+		}
+		id, err := thread.readIntRaw(goid.Addr, 8)
+		if err != nil {
+			return nil, err
+		}
+		a.Id = int(id)
+		gopc, err := elem.structMember("gopc")
+		if err != nil {
+			return nil, err
+		}
+		if a.GoPC, err = thread.readUintRaw(gopc.Addr, ptrSize); err != nil {
+			return nil, err
+		}
+		pcs, err := elem.structMember("pcs")
+		if err != nil {
+			return nil, err
+		}
+		pcsBase, npcs, err := readSliceHeader(thread, pcs.Addr)
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < npcs; j++ {
+			pc, err := thread.readUintRaw(uintptr(pcsBase+j*uint64(ptrSize)), ptrSize)
+			if err != nil {
+				return nil, err
+			}
+			// The PCs are return addresses, look up the call instead.
+			f, l, fn := dbp.PCToLine(pc - 1)
+			a.Stack = append(a.Stack, Location{PC: pc, File: f, Line: l, Fn: fn})
+		}
+		ancestors = append(ancestors, a)
+	}
+	return ancestors, nil
+}
+
+// Longest slice readSliceHeader accepts, a corrupted header could have
+// any length.
+const maxSliceHeaderLen = 1 << 16
+
+// Returns the data pointer and the length of the slice header at addr.
+func readSliceHeader(thread *Thread, addr uintptr) (base, n uint64, err error) {
+	ptrSize := thread.dbp.arch.PtrSize()
+	if base, err = thread.readUintRaw(addr, int64(ptrSize)); err != nil {
+		return 0, 0, err
+	}
+	if n, err = thread.readUintRaw(addr+uintptr(ptrSize), int64(ptrSize)); err != nil {
+		return 0, 0, err
+	}
+	if n > maxSliceHeaderLen {
+		return 0, 0, fmt.Errorf("slice at %#x too long: %d", addr, n)
+	}
+	return base, n, nil
+}
+
+// StackUsage returns the number of bytes of the goroutine's
+// stack currently in use and the total size of its stack. Used is 0
+// when the stack pointer is outside of the stack, as it is for a
+// goroutine running on g0 or on a system stack, and for dead ones.
+func (g *G) StackUsage() (used, total uint64) {
+	if g.StackHi < g.StackLo {
+		return 0, 0
+	}
+	sp := g.SP
+	if g.thread != nil {
+		// The SP saved in sched is stale for running goroutines.
+		if regs, err := g.thread.Registers(); err == nil {
+			sp = regs.SP()
+		}
+	}
+	if sp < g.StackLo || sp > g.StackHi {
+		return 0, g.StackHi - g.StackLo
 	}
+	return g.StackHi - sp, g.StackHi - g.StackLo
+}
 
+// Returns information for the named variable. The name can be followed
+// by field selectors and constant indexes of arrays and slices, as in
+// "cfg.Servers[2].Addr.Port".
+func (scope *EvalScope) ExtractVariableInfo(name string) (*Variable, error) {
+	parts := strings.Split(name, ".")
+	varName, index := splitIndexes(parts[0])
 	v, err := scope.extractVarInfo(varName)
+	members := withIndexes(index, parts[1:])
 	if err != nil {
 		origErr := err
 		// Attempt to evaluate name as a package variable.
-		if memberName != "" {
-			v, err = scope.packageVarAddr(name)
-		} else {
-			_, _, fn := scope.Thread.dbp.PCToLine(scope.PC)
-			if fn != nil {
-				v, err = scope.packageVarAddr(fn.PackageName() + "." + name)
+		v, members, err = scope.packageVariable(parts)
+		if err != nil {
+			return nil, origErr
+		}
+	}
+	for _, member := range members {
+		field, index := splitIndexes(member)
+		if field != "" {
+			if v, err = v.structMember(field); err != nil {
+				return nil, err
 			}
 		}
+		if index == "" {
+			continue
+		}
+		indexes, err := parseIndexes(index)
 		if err != nil {
-			return nil, origErr
+			return nil, err
 		}
-		v.Name = name
-	} else {
-		if len(memberName) > 0 {
-			v, err = v.structMember(memberName)
-			if err != nil {
+		for _, idx := range indexes {
+			if v, err = v.element(idx); err != nil {
 				return nil, err
 			}
 		}
@@ -330,16 +691,169 @@ func (scope *EvalScope) ExtractVariableInfo(name string) (*Variable, error) {
 	return v, nil
 }
 
-// Returns the value of the named variable.
-func (scope *EvalScope) EvalVariable(name string) (*Variable, error) {
+// Splits the indexes off a component of a variable name, "Servers[2]"
+// becomes "Servers" and "[2]".
+func splitIndexes(part string) (string, string) {
+	if i := strings.Index(part, "["); i >= 0 {
+		return part[:i], part[i:]
+	}
+	return part, ""
+}
+
+// Returns the selectors following a name, starting with the indexes
+// split off its last component, if any.
+func withIndexes(index string, members []string) []string {
+	if index == "" {
+		return members
+	}
+	return append([]string{index}, members...)
+}
+
+// Parses a sequence of constant indexes, i.e. "[2][0]".
+func parseIndexes(index string) ([]int64, error) {
+	var indexes []int64
+	for rest := index; rest != ""; {
+		end := strings.Index(rest, "]")
+		if rest[0] != '[' || end < 0 {
+			return nil, fmt.Errorf("invalid index expression %s", index)
+		}
+		idx, err := strconv.ParseInt(rest[1:end], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index expression %s", index)
+		}
+		indexes = append(indexes, idx)
+		rest = rest[end+1:]
+	}
+	return indexes, nil
+}
+
+// Looks up a package variable named by the longest prefix of parts
+// qualified with its package path, which may itself contain dots, or
+// by the first part if it is declared in the package of the current
+// function. Functions are looked up in the same way, with no field
+// selectors. Returns the variable and the selectors following its name.
+func (scope *EvalScope) packageVariable(parts []string) (*Variable, []string, error) {
+	for i := len(parts); i > 1; i-- {
+		last, index := splitIndexes(parts[i-1])
+		name := strings.Join(append(parts[:i-1:i-1], last), ".")
+		if v, err := scope.packageVarAddr(name); err == nil {
+			v.Name = name
+			return v, withIndexes(index, parts[i:]), nil
+		}
+	}
+	name := strings.Join(parts, ".")
+	if v, err := scope.functionVariable(name); err == nil {
+		v.Name = name
+		return v, nil, nil
+	}
+
+	_, _, fn := scope.Thread.dbp.PCToLine(scope.PC)
+	if fn == nil {
+		return nil, nil, fmt.Errorf("could not find symbol value for %s", name)
+	}
+	varName, index := splitIndexes(parts[0])
+	if v, err := scope.packageVarAddr(fn.PackageName() + "." + varName); err == nil {
+		v.Name = varName
+		return v, withIndexes(index, parts[1:]), nil
+	}
+	v, err := scope.functionVariable(fn.PackageName() + "." + name)
+	if err != nil {
+		return nil, nil, err
+	}
+	v.Name = name
+	return v, nil, nil
+}
+
+// Returns the value of the named variable, read according to cfg.
+func (scope *EvalScope) EvalVariable(name string, cfg LoadConfig) (*Variable, error) {
 	v, err := scope.ExtractVariableInfo(name)
 	if err != nil {
 		return nil, err
 	}
-	err = v.loadValue(true)
+	err = v.loadValueWithConfig(true, cfg)
 	return v, err
 }
 
+// LoadConfig limits how much of a value is read by EvalVariable and the
+// other functions loading variables. Every limit is taken literally,
+// zero included, negative values mean no limit: start from
+// DefaultLoadConfig to change some of them. Strings are never read past
+// 1MB and arrays past 65536 elements.
+type LoadConfig struct {
+	// Number of levels of pointers dereferenced. Pointers past the limit
+	// are shown as their address, i.e. "(*main.T)(0xc820010000)", the
+	// value they point to can be evaluated later selecting its fields.
+	FollowPointers int
+
+	// What to do with the parts of the value that can not be read.
+	Unreadable UnreadablePolicy
+
+	MaxStringLen       int // Bytes of a string.
+	MaxArrayValues     int // Elements of an array or slice.
+	MaxStructFields    int // Fields of a struct.
+	MaxVariableRecurse int // Levels of nested structs whose fields are shown.
+}
+
+// DefaultLoadConfig follows every pointer and reads up to 64 bytes of a
+// string, 64 elements of an array or slice, all the fields of a struct
+// and one level of nested structs.
+var DefaultLoadConfig = LoadConfig{
+	FollowPointers:     -1,
+	Unreadable:         UnreadablePlaceholder,
+	MaxStringLen:       maxArrayValues,
+	MaxArrayValues:     maxArrayValues,
+	MaxStructFields:    -1,
+	MaxVariableRecurse: maxVariableRecurse,
+}
+
+// Returns cfg with the negative limits replaced by the largest value
+// allowed and the ones above the hard limits lowered to them.
+func (cfg LoadConfig) normalized() LoadConfig {
+	limit := func(n *int, max int) {
+		if *n < 0 || *n > max {
+			*n = max
+		}
+	}
+	limit(&cfg.MaxStringLen, maxStringLenLimit)
+	limit(&cfg.MaxArrayValues, maxArrayValuesLimit)
+	limit(&cfg.MaxStructFields, int(^uint(0)>>1))
+	limit(&cfg.MaxVariableRecurse, int(^uint(0)>>1))
+	return cfg
+}
+
+// UnreadablePolicy says how a value is loaded when part of it, i.e. an
+// element of an array or the target of a pointer field, can not be read.
+type UnreadablePolicy int
+
+const (
+	// Replace the unreadable part with "<unreadable: error>", for
+	// strings keep the bytes preceding it. This is what EvalVariable does.
+	UnreadablePlaceholder UnreadablePolicy = iota
+	// Fail loading the whole value.
+	UnreadableAbort
+	// End the array, slice, struct or string containing the unreadable
+	// part before it, with "...+N more (unreadable)".
+	UnreadableTruncate
+)
+
+// EvalExpressions evaluates every expression of exprs, as EvalVariable
+// does with cfg, e.g. the elements of the list "a, b, c.field" split on
+// commas.
+// The returned slices are parallel to exprs: for each expression either
+// the variable or the error that stopped its evaluation is set, a failing
+// expression does not prevent the following ones from being evaluated.
+func (scope *EvalScope) EvalExpressions(exprs []string, cfg LoadConfig) ([]*Variable, []error) {
+	vars := make([]*Variable, len(exprs))
+	errs := make([]error, len(exprs))
+	for i, expr := range exprs {
+		vars[i], errs[i] = scope.EvalVariable(strings.TrimSpace(expr), cfg)
+		if errs[i] != nil {
+			vars[i] = nil
+		}
+	}
+	return vars, errs
+}
+
 // Sets the value of the named variable
 func (scope *EvalScope) SetVariable(name, value string) error {
 	v, err := scope.ExtractVariableInfo(name)
@@ -349,13 +863,13 @@ func (scope *EvalScope) SetVariable(name, value string) error {
 	return v.setValue(value)
 }
 
-func (scope *EvalScope) extractVariableFromEntry(entry *dwarf.Entry) (*Variable, error) {
+func (scope *EvalScope) extractVariableFromEntry(entry *dwarf.Entry, cfg LoadConfig) (*Variable, error) {
 	rdr := scope.DwarfReader()
 	v, err := scope.extractVarInfoFromEntry(entry, rdr)
 	if err != nil {
 		return nil, err
 	}
-	err = v.loadValue(true)
+	err = v.loadValueWithConfig(true, cfg)
 	return v, err
 }
 
@@ -385,17 +899,17 @@ func (scope *EvalScope) extractVarInfo(varName string) (*Variable, error) {
 }
 
 // LocalVariables returns all local variables from the current function scope.
-func (scope *EvalScope) LocalVariables() ([]*Variable, error) {
-	return scope.variablesByTag(dwarf.TagVariable)
+func (scope *EvalScope) LocalVariables(cfg LoadConfig) ([]*Variable, error) {
+	return scope.variablesByTag(dwarf.TagVariable, cfg)
 }
 
 // FunctionArguments returns the name, value, and type of all current function arguments.
-func (scope *EvalScope) FunctionArguments() ([]*Variable, error) {
-	return scope.variablesByTag(dwarf.TagFormalParameter)
+func (scope *EvalScope) FunctionArguments(cfg LoadConfig) ([]*Variable, error) {
+	return scope.variablesByTag(dwarf.TagFormalParameter, cfg)
 }
 
 // PackageVariables returns the name, value, and type of all package variables in the application.
-func (scope *EvalScope) PackageVariables() ([]*Variable, error) {
+func (scope *EvalScope) PackageVariables(cfg LoadConfig) ([]*Variable, error) {
 	reader := scope.DwarfReader()
 
 	vars := make([]*Variable, 0)
@@ -406,108 +920,857 @@ func (scope *EvalScope) PackageVariables() ([]*Variable, error) {
 		}
 
 		// Ignore errors trying to extract values
-		val, err := scope.extractVariableFromEntry(entry)
+		val, err := scope.extractVariableFromEntry(entry, cfg)
+		if err != nil {
+			continue
+		}
+		vars = append(vars, val)
+	}
+
+	return vars, nil
+}
+
+func (dbp *Process) EvalPackageVariable(name string, cfg LoadConfig) (*Variable, error) {
+	scope := &EvalScope{Thread: dbp.CurrentThread, PC: 0, CFA: 0}
+
+	v, err := scope.packageVarAddr(name)
+	if err != nil {
+		return nil, err
+	}
+	err = v.loadValueWithConfig(true, cfg)
+	return v, err
+}
+
+// EvalPackageExpression evaluates expr, a package variable qualified
+// with its package path followed by field selectors, i.e.
+// "main.cfg.Items". It does not use the scope of a goroutine: it can be
+// called wherever the process is stopped, even in runtime code.
+func (dbp *Process) EvalPackageExpression(expr string, cfg LoadConfig) (*Variable, error) {
+	scope := &EvalScope{Thread: dbp.CurrentThread, PC: 0, CFA: 0}
+
+	v, members, err := scope.packageVariable(strings.Split(expr, "."))
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		v, err = v.structMember(member)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = v.loadValueWithConfig(true, cfg)
+	return v, err
+}
+
+func (scope *EvalScope) packageVarAddr(name string) (*Variable, error) {
+	reader := scope.DwarfReader()
+	for entry, err := reader.NextPackageVariable(); entry != nil; entry, err = reader.NextPackageVariable() {
 		if err != nil {
+			return nil, err
+		}
+
+		n, ok := entry.Val(dwarf.AttrName).(string)
+		if !ok {
 			continue
 		}
-		vars = append(vars, val)
+
+		if n == name {
+			return scope.extractVarInfoFromEntry(entry, reader)
+		}
+	}
+	return nil, fmt.Errorf("could not find symbol value for %s", name)
+}
+
+// Returns a func variable for the named function, its address
+// is the entry point of the function.
+func (scope *EvalScope) functionVariable(name string) (*Variable, error) {
+	fn := scope.Thread.dbp.goSymTable.LookupFunc(name)
+	if fn == nil {
+		return nil, fmt.Errorf("could not find function %s", name)
+	}
+	v, err := newVariable(name, uintptr(fn.Entry), &dwarf.FuncType{}, scope.Thread)
+	if err != nil {
+		return nil, err
+	}
+	v.fnEntry = fn.Entry
+	return v, nil
+}
+
+func (v *Variable) structMember(memberName string) (*Variable, error) {
+	structVar, err := v.maybeDereference()
+	if err != nil {
+		return nil, err
+	}
+	structVar.Name = v.Name
+	structVar = structVar.resolveTypedefs()
+
+	switch t := structVar.dwarfType.(type) {
+	case *dwarf.StructType:
+		for _, field := range t.Field {
+			if field.Name != memberName {
+				continue
+			}
+			if structVar.Addr == 0 {
+				return nil, fmt.Errorf("%s is nil", v.Name)
+			}
+			return structVar.toField(field)
+		}
+		if method, err := structVar.embeddedInterfaceMethod(t, memberName); err == nil {
+			method.Name = fmt.Sprintf("%s.%s", v.Name, memberName)
+			return method, nil
+		}
+		return nil, fmt.Errorf("%s has no member %s", v.Name, memberName)
+	default:
+		return nil, fmt.Errorf("%s type %s is not a struct", v.Name, structVar.dwarfType)
+	}
+}
+
+// Returns the element idx of the array or slice v.
+func (v *Variable) element(idx int64) (*Variable, error) {
+	typ := resolveTypedefs(v.dwarfType)
+	switch t := typ.(type) {
+	case *dwarf.ArrayType:
+	case *dwarf.StructType:
+		if !strings.HasPrefix(t.StructName, "[]") {
+			return nil, fmt.Errorf("%s type %s is not an array or slice", v.Name, v.dwarfType)
+		}
+	default:
+		return nil, fmt.Errorf("%s type %s is not an array or slice", v.Name, v.dwarfType)
+	}
+	// Slice information is not loaded for named slice types.
+	arr, err := newVariable(v.Name, v.Addr, typ, v.thread)
+	if err != nil {
+		return nil, err
+	}
+	if idx < 0 || idx >= arr.Len {
+		return nil, fmt.Errorf("index %d out of range for %s of length %d", idx, v.Name, arr.Len)
+	}
+	return newVariable(fmt.Sprintf("%s[%d]", v.Name, idx), uintptr(int64(arr.base)+idx*arr.stride), arr.fieldType, v.thread)
+}
+
+// Looks for a method promoted from one of the interfaces embedded in
+// the struct, returning a func variable for its implementation.
+func (v *Variable) embeddedInterfaceMethod(t *dwarf.StructType, methodName string) (*Variable, error) {
+	for _, field := range t.Field {
+		// Embedded fields are named after their type.
+		typedef, ok := field.Type.(*dwarf.TypedefType)
+		if !ok || field.Name != typedef.Name[strings.LastIndex(typedef.Name, ".")+1:] {
+			continue
+		}
+		if st, ok := typedef.Type.(*dwarf.StructType); !ok || st.StructName != "runtime.iface" {
+			continue
+		}
+		iface, err := v.toField(field)
+		if err != nil {
+			return nil, err
+		}
+		if method, err := iface.interfaceMethod(methodName); err == nil {
+			return method, nil
+		}
+	}
+	return nil, fmt.Errorf("no embedded interface has method %s", methodName)
+}
+
+// Returns a func variable for the implementation of the named
+// method of a non-empty interface, as found in its itab.
+func (v *Variable) interfaceMethod(methodName string) (*Variable, error) {
+	tab, err := v.structMember("tab")
+	if err != nil {
+		return nil, err
+	}
+	inter, err := tab.structMember("inter")
+	if err != nil {
+		return nil, err
+	}
+	methods, err := inter.structMember("mhdr")
+	if err != nil {
+		return nil, err
+	}
+
+	// The itab lists the implementations in the same
+	// order as the interface type lists its methods.
+	for i := int64(0); i < methods.Len; i++ {
+		method, err := newVariable("", uintptr(int64(methods.base)+(i*methods.stride)), methods.fieldType, v.thread)
+		if err != nil {
+			return nil, err
+		}
+		name, err := method.structMember("name")
+		if err == nil {
+			name, err = name.maybeDereference()
+		}
+		if err != nil {
+			return nil, err
+		}
+		n, err := v.thread.readString(uintptr(name.Addr))
+		if err != nil {
+			return nil, err
+		}
+		if n != methodName {
+			continue
+		}
+
+		fun, err := tab.structMember("fun")
+		if err != nil {
+			return nil, err
+		}
+		ptrSize := v.thread.dbp.arch.PtrSize()
+		pc, err := v.thread.readUintRaw(fun.Addr+uintptr(int(i)*ptrSize), int64(ptrSize))
+		if err != nil {
+			return nil, err
+		}
+		fnv, err := newVariable("", uintptr(pc), &dwarf.FuncType{}, v.thread)
+		if err != nil {
+			return nil, err
+		}
+		fnv.fnEntry = pc
+		return fnv, nil
+	}
+	return nil, fmt.Errorf("interface has no method %s", methodName)
+}
+
+// Extracts the name and type of a variable from a dwarf entry
+// then executes the instructions given in the  DW_AT_location attribute to grab the variable's address
+func (scope *EvalScope) extractVarInfoFromEntry(entry *dwarf.Entry, rdr *reader.Reader) (*Variable, error) {
+	if entry == nil {
+		return nil, fmt.Errorf("invalid entry")
+	}
+
+	if entry.Tag != dwarf.TagFormalParameter && entry.Tag != dwarf.TagVariable {
+		return nil, fmt.Errorf("invalid entry tag, only supports FormalParameter and Variable, got %s", entry.Tag.String())
+	}
+
+	n, ok := entry.Val(dwarf.AttrName).(string)
+	if !ok {
+		return nil, fmt.Errorf("type assertion failed")
+	}
+
+	offset, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+	if !ok {
+		return nil, fmt.Errorf("type assertion failed")
+	}
+
+	t, err := scope.Type(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var instructions []byte
+	switch loc := entry.Val(dwarf.AttrLocation).(type) {
+	case nil:
+		// No location at all.
+	case []byte:
+		instructions = loc
+	case int64:
+		// Offset of a location list, used for the variables of
+		// optimized functions whose location changes with the PC.
+		if instructions, err = scope.locationListEntry(loc); err != nil {
+			return nil, fmt.Errorf("could not read location list of %s: %s", n, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported location for %s", n)
+	}
+
+	loc, err := op.EvalLocation(scope.CFA, scope.dwarfRegisters, instructions)
+	if err == op.ErrOptimizedOut {
+		return nil, fmt.Errorf("%s has been optimized out", n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if loc.InRegister {
+		regval, err := scope.dwarfRegisters(loc.Register)
+		if err != nil {
+			return nil, fmt.Errorf("%s is stored in register %d: %s", n, loc.Register, err)
+		}
+		return newRegisterVariable(n, regval, t, scope.Thread)
+	}
+
+	return newVariable(n, uintptr(loc.Addr), t, scope.Thread)
+}
+
+// Returns a variable whose value is held in a register, which must be
+// of a scalar type: values made of several parts are not supported.
+func newRegisterVariable(name string, regval uint64, dwarfType dwarf.Type, thread *Thread) (*Variable, error) {
+	switch resolveTypedefs(dwarfType).(type) {
+	case *dwarf.IntType, *dwarf.UintType, *dwarf.BoolType, *dwarf.PtrType, *dwarf.FuncType:
+	default:
+		return nil, fmt.Errorf("%s of type %s is stored in a register, only scalar values are supported", name, dwarfType)
+	}
+	v, err := newVariable(name, 0, dwarfType, thread)
+	if err != nil {
+		return nil, err
+	}
+	v.regValue = make([]byte, 8)
+	binary.LittleEndian.PutUint64(v.regValue, regval)
+	return v, nil
+}
+
+// Reads size bytes of the value of v, from memory or from the register
+// holding it.
+func (v *Variable) readMemory(size int) ([]byte, error) {
+	if v.regValue == nil {
+		return v.thread.readMemory(v.Addr, size)
+	}
+	if size > len(v.regValue) {
+		return nil, fmt.Errorf("%s does not fit in a register", v.Name)
+	}
+	return v.regValue[:size], nil
+}
+
+func (v *Variable) readIntRaw(size int64) (int64, error) {
+	if v.regValue == nil {
+		return v.thread.readIntRaw(v.Addr, size)
+	}
+	u, err := v.readUintRaw(size)
+	return int64(u), err
+}
+
+func (v *Variable) readUintRaw(size int64) (uint64, error) {
+	if v.regValue == nil {
+		return v.thread.readUintRaw(v.Addr, size)
+	}
+	val, err := v.readMemory(int(size))
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 8)
+	copy(buf, val)
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+// Returns the location expression that applies at the PC of the scope in
+// the location list at off.
+func (scope *EvalScope) locationListEntry(off int64) ([]byte, error) {
+	dbp := scope.Thread.dbp
+	if dbp.debugLoc == nil {
+		return nil, fmt.Errorf("could not find .debug_loc section")
+	}
+	cu, err := dbp.dwarf.Reader().SeekPC(scope.PC)
+	if err != nil {
+		return nil, err
+	}
+	base, _ := cu.Val(dwarf.AttrLowpc).(uint64)
+	return op.LocationListEntry(dbp.debugLoc, off, base, scope.PC)
+}
+
+// Returns the value of a register of the thread, only available for the
+// topmost frame as the registers of the callers are not saved.
+func (scope *EvalScope) dwarfRegisters(regnum uint64) (uint64, error) {
+	regs, err := scope.Thread.Registers()
+	if err != nil {
+		return 0, err
+	}
+	if regs.PC() != scope.PC {
+		return 0, fmt.Errorf("registers are only available for the topmost frame")
+	}
+	return regs.DwarfRegister(regnum)
+}
+
+// EnumName returns the name of the constant declared with the same type
+// as v whose value is the current value of v, or an empty string if there
+// is no such constant (or v is not an integer).
+func (v *Variable) EnumName() string {
+	var (
+		n   int64
+		err error
+	)
+	switch t := v.resolveTypedefs().dwarfType.(type) {
+	case *dwarf.IntType:
+		n, err = v.readIntRaw(t.ByteSize)
+		// readIntRaw does not sign extend
+		shift := uint(64 - 8*t.ByteSize)
+		n = (n << shift) >> shift
+	case *dwarf.UintType:
+		var u uint64
+		u, err = v.readUintRaw(t.ByteSize)
+		n = int64(u)
+	default:
+		return ""
+	}
+	if err != nil {
+		return ""
+	}
+
+	dbp := v.thread.dbp
+	reader := dbp.DwarfReader()
+	for entry, err := reader.NextPackageConstant(); entry != nil; entry, err = reader.NextPackageConstant() {
+		if err != nil {
+			return ""
+		}
+
+		val, ok := entry.Val(dwarf.AttrConstValue).(int64)
+		if !ok || val != n {
+			continue
+		}
+		offset, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			continue
+		}
+		t, err := dbp.dwarf.Type(offset)
+		if err != nil || t.String() != v.dwarfType.String() {
+			continue
+		}
+		name, _ := entry.Val(dwarf.AttrName).(string)
+		return name
+	}
+	return ""
+}
+
+// Diff compares v with other, which must have the same type, and returns
+// every value where they differ. Struct fields and array and slice elements
+// are compared recursively, pointers are compared by address and all other
+// values by their loaded value.
+func (v *Variable) Diff(other *Variable) ([]VariableDiff, error) {
+	if v.dwarfType.String() != other.dwarfType.String() {
+		return nil, fmt.Errorf("can not compare %s to %s", v.dwarfType, other.dwarfType)
+	}
+	var diffs []VariableDiff
+	if err := v.diff(other, "", &diffs); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+func (v *Variable) diff(other *Variable, path string, diffs *[]VariableDiff) error {
+	v = v.resolveTypedefs()
+	other = other.resolveTypedefs()
+
+	switch t := v.dwarfType.(type) {
+	case *dwarf.PtrType:
+		size := int64(v.thread.dbp.arch.PtrSize())
+		lptr, err := v.readUintRaw(size)
+		if err != nil {
+			return err
+		}
+		rptr, err := other.readUintRaw(size)
+		if err != nil {
+			return err
+		}
+		if lptr != rptr {
+			*diffs = append(*diffs, VariableDiff{path, fmt.Sprintf("%#x", lptr), fmt.Sprintf("%#x", rptr)})
+		}
+		return nil
+	case *dwarf.StructType:
+		switch {
+		case strings.HasPrefix(t.StructName, "[]"):
+			return v.diffElements(other, path, diffs)
+		case t.StructName != "string" && t.StructName != "runtime.eface" && t.StructName != "runtime.iface":
+			for _, field := range t.Field {
+				lfield, err := v.toField(field)
+				if err != nil {
+					return err
+				}
+				rfield, err := other.toField(field)
+				if err != nil {
+					return err
+				}
+				fieldPath := field.Name
+				if path != "" {
+					fieldPath = path + "." + field.Name
+				}
+				if err := lfield.diff(rfield, fieldPath, diffs); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case *dwarf.ArrayType:
+		return v.diffElements(other, path, diffs)
+	}
+
+	lval, err := v.loadValueInternal(false, 0, DefaultLoadConfig.normalized())
+	if err != nil {
+		return err
+	}
+	rval, err := other.loadValueInternal(false, 0, DefaultLoadConfig.normalized())
+	if err != nil {
+		return err
+	}
+	if lval != rval {
+		*diffs = append(*diffs, VariableDiff{path, lval, rval})
+	}
+	return nil
+}
+
+// Compares the elements two arrays or slices have in common, then
+// their lengths.
+func (v *Variable) diffElements(other *Variable, path string, diffs *[]VariableDiff) error {
+	n := v.Len
+	if other.Len < n {
+		n = other.Len
+	}
+	for i := int64(0); i < n; i++ {
+		lelem, err := newVariable("", uintptr(int64(v.base)+(i*v.stride)), v.fieldType, v.thread)
+		if err != nil {
+			return err
+		}
+		relem, err := newVariable("", uintptr(int64(other.base)+(i*other.stride)), other.fieldType, other.thread)
+		if err != nil {
+			return err
+		}
+		if err := lelem.diff(relem, fmt.Sprintf("%s[%d]", path, i), diffs); err != nil {
+			return err
+		}
+	}
+	if v.Len != other.Len {
+		*diffs = append(*diffs, VariableDiff{fmt.Sprintf("len(%s)", path), strconv.FormatInt(v.Len, 10), strconv.FormatInt(other.Len, 10)})
+	}
+	return nil
+}
+
+// PtrElemType returns the name of the type v points to, or an empty
+// string if v is not a pointer. The pointer itself is not read, so the
+// type is also reported for nil pointers.
+func (v *Variable) PtrElemType() string {
+	if t, ok := v.resolveTypedefs().dwarfType.(*dwarf.PtrType); ok {
+		return t.Type.String()
+	}
+	return ""
+}
+
+// BackingArray returns a variable for the array backing the slice v,
+// of type [cap(v)]T, so that the elements past len(v) are visible.
+func (v *Variable) BackingArray() (*Variable, error) {
+	t, ok := v.resolveTypedefs().dwarfType.(*dwarf.StructType)
+	if !ok || !strings.HasPrefix(t.StructName, "[]") {
+		return nil, fmt.Errorf("%s is not a slice", v.Name)
+	}
+	// Slice information is not loaded for named slice types.
+	slice, err := newVariable(v.Name, v.Addr, t, v.thread)
+	if err != nil {
+		return nil, err
+	}
+	arr := &dwarf.ArrayType{
+		CommonType: dwarf.CommonType{ByteSize: slice.Cap * slice.stride},
+		Type:       slice.fieldType,
+		Count:      slice.Cap,
+	}
+	return newVariable(v.Name, slice.base, arr, v.thread)
+}
+
+// PtrDiff returns the number of elements between the addresses held
+// by the pointers v and other, that is (v - other) / sizeof(*v). Both
+// must point to the same type.
+func (v *Variable) PtrDiff(other *Variable) (int64, error) {
+	lptr, ok := v.resolveTypedefs().dwarfType.(*dwarf.PtrType)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a pointer", v.Name)
+	}
+	rptr, ok := other.resolveTypedefs().dwarfType.(*dwarf.PtrType)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a pointer", other.Name)
+	}
+	if lptr.Type.String() != rptr.Type.String() {
+		return 0, fmt.Errorf("mismatched element types %s and %s", lptr.Type, rptr.Type)
+	}
+	size := lptr.Type.Size()
+	if size <= 0 {
+		return 0, fmt.Errorf("can not compute distance between pointers to %s, element size is %d", lptr.Type, size)
+	}
+
+	ptrSize := int64(v.thread.dbp.arch.PtrSize())
+	laddr, err := v.readUintRaw(ptrSize)
+	if err != nil {
+		return 0, err
+	}
+	raddr, err := other.readUintRaw(ptrSize)
+	if err != nil {
+		return 0, err
+	}
+	return (int64(laddr) - int64(raddr)) / size, nil
+}
+
+// ContextState reports whether the context v, a context.Context or a
+// pointer to one of its implementations, has been cancelled. It returns
+// "active" or "cancelled: " followed by the cancellation error, just
+// "cancelled" if the done channel is closed but the error is not set. The
+// state is read from the done channel and the err field of the nearest
+// cancelCtx.
+func (v *Variable) ContextState() (string, error) {
+	ctx := v
+	for {
+		ctx = ctx.resolveTypedefs()
+		switch t := ctx.dwarfType.(type) {
+		case *dwarf.PtrType:
+			ptrval, err := ctx.readUintRaw(int64(ctx.thread.dbp.arch.PtrSize()))
+			if err != nil {
+				return "", err
+			}
+			if ptrval == 0 {
+				return "", fmt.Errorf("%s is nil", v.Name)
+			}
+			ctx, err = newVariable("", uintptr(ptrval), t.Type, ctx.thread)
+			if err != nil {
+				return "", err
+			}
+		case *dwarf.StructType:
+			if t.StructName == "runtime.iface" || t.StructName == "runtime.eface" {
+				_, data, err := ctx.interfaceValue()
+				if err != nil {
+					return "", err
+				}
+				if data == nil {
+					return "", fmt.Errorf("%s is nil", v.Name)
+				}
+				ctx = data
+				continue
+			}
+			if !strings.HasPrefix(t.StructName, "context.") && !strings.HasPrefix(t.StructName, "golang.org/x/net/context.") {
+				return "", fmt.Errorf("%s is not a context", v.Name)
+			}
+			// cancelCtx has an err field, timerCtx embeds a cancelCtx and
+			// valueCtx embeds its parent.
+			var next *dwarf.StructField
+			for _, field := range t.Field {
+				switch field.Name {
+				case "err":
+					return ctx.cancelCtxState(field)
+				case "cancelCtx", "Context":
+					if next == nil || next.Name != "cancelCtx" {
+						next = field
+					}
+				}
+			}
+			if next == nil {
+				// Background and TODO are never cancelled.
+				return "active", nil
+			}
+			var err error
+			ctx, err = ctx.toField(next)
+			if err != nil {
+				return "", err
+			}
+		default:
+			// emptyCtx is an int in older versions of the package.
+			return "active", nil
+		}
 	}
-
-	return vars, nil
 }
 
-func (dbp *Process) EvalPackageVariable(name string) (*Variable, error) {
-	scope := &EvalScope{Thread: dbp.CurrentThread, PC: 0, CFA: 0}
-
-	v, err := scope.packageVarAddr(name)
+// Returns the state of the cancelCtx v, whose err field is errField.
+func (v *Variable) cancelCtxState(errField *dwarf.StructField) (string, error) {
+	errv, err := v.toField(errField)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	err = v.loadValue(true)
-	return v, err
+	state, err := errv.contextErr()
+	if err != nil || state != "active" {
+		return state, err
+	}
+	// Some versions of the package do not have a done field.
+	done, err := v.structMember("done")
+	if err != nil {
+		return "active", nil
+	}
+	closed, err := done.contextDoneClosed()
+	if err != nil {
+		return "", err
+	}
+	if closed {
+		return "cancelled", nil
+	}
+	return "active", nil
 }
 
-func (scope *EvalScope) packageVarAddr(name string) (*Variable, error) {
-	reader := scope.DwarfReader()
-	for entry, err := reader.NextPackageVariable(); entry != nil; entry, err = reader.NextPackageVariable() {
+// Reports whether v, the done field of a cancelCtx, is closed. It is
+// a channel, or a sync/atomic.Value holding one in recent versions of
+// the package. The channel is created by the first call to Done, it
+// is nil until then.
+func (v *Variable) contextDoneClosed() (bool, error) {
+	ch := v.resolveTypedefs()
+	if t, ok := ch.dwarfType.(*dwarf.StructType); ok && t.StructName == "sync/atomic.Value" {
+		iface, err := ch.structMember("v")
 		if err != nil {
-			return nil, err
-		}
-
-		n, ok := entry.Val(dwarf.AttrName).(string)
-		if !ok {
-			continue
+			return false, err
 		}
-
-		if n == name {
-			return scope.extractVarInfoFromEntry(entry, reader)
+		_, data, err := iface.resolveTypedefs().interfaceValue()
+		if err != nil || data == nil {
+			return false, err
 		}
+		ch = data.resolveTypedefs()
 	}
-	return nil, fmt.Errorf("could not find symbol value for %s", name)
+	return ch.chanClosed()
 }
 
-func (v *Variable) structMember(memberName string) (*Variable, error) {
-	structVar, err := v.maybeDereference()
-	structVar.Name = v.Name
+// Reports whether the channel v is closed, a nil channel is not.
+func (v *Variable) chanClosed() (bool, error) {
+	ptr, ok := v.dwarfType.(*dwarf.PtrType)
+	if !ok {
+		return false, fmt.Errorf("%s is not a channel", v.Name)
+	}
+	addr, err := v.readUintRaw(int64(v.thread.dbp.arch.PtrSize()))
+	if err != nil || addr == 0 {
+		return false, err
+	}
+	hchan, err := newVariable(v.Name, uintptr(addr), ptr.Type, v.thread)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	structVar = structVar.resolveTypedefs()
+	closed, err := hchan.structMember("closed")
+	if err != nil {
+		return false, err
+	}
+	val, err := closed.readUintRaw(closed.dwarfType.Size())
+	return val != 0, err
+}
 
-	switch t := structVar.dwarfType.(type) {
+// IsNil reports whether v, which must be of a type that can be compared
+// to nil, is nil. As in Go an interface is nil only if both its type and
+// its data words are zero: an interface holding a nil pointer is not.
+func (v *Variable) IsNil() (bool, error) {
+	rv := v.resolveTypedefs()
+	ptrSize := int64(v.thread.dbp.arch.PtrSize())
+	switch t := rv.dwarfType.(type) {
+	case *dwarf.PtrType, *dwarf.FuncType:
+		// Maps and channels are pointers too.
 	case *dwarf.StructType:
-		for _, field := range t.Field {
-			if field.Name != memberName {
-				continue
+		switch {
+		case t.StructName == "runtime.iface" || t.StructName == "runtime.eface":
+			// Both words, tab or _type followed by data.
+			words, err := rv.readMemory(int(2 * ptrSize))
+			if err != nil {
+				return false, err
 			}
-			if structVar.Addr == 0 {
-				return nil, fmt.Errorf("%s is nil", v.Name)
+			for _, b := range words {
+				if b != 0 {
+					return false, nil
+				}
 			}
-			return structVar.toField(field)
+			return true, nil
+		case strings.HasPrefix(t.StructName, "[]"):
+			// A slice is nil if its array pointer, the first field, is.
+		default:
+			return false, fmt.Errorf("%s of type %s can not be nil", v.Name, v.Type)
 		}
-		return nil, fmt.Errorf("%s has no member %s", v.Name, memberName)
 	default:
-		return nil, fmt.Errorf("%s type %s is not a struct", v.Name, structVar.dwarfType)
+		return false, fmt.Errorf("%s of type %s can not be nil", v.Name, v.Type)
+	}
+	val, err := rv.readUintRaw(ptrSize)
+	if err != nil {
+		return false, err
 	}
+	return val == 0, nil
 }
 
-// Extracts the name and type of a variable from a dwarf entry
-// then executes the instructions given in the  DW_AT_location attribute to grab the variable's address
-func (scope *EvalScope) extractVarInfoFromEntry(entry *dwarf.Entry, rdr *reader.Reader) (*Variable, error) {
-	if entry == nil {
-		return nil, fmt.Errorf("invalid entry")
+// OnceState reports whether Do has been called on v, a sync.Once or a
+// pointer to one, returning "done" or "pending". The state is read from
+// the done flag, which is set once the function passed to Do returns.
+func (v *Variable) OnceState() (string, error) {
+	once, err := v.maybeDereference()
+	if err != nil {
+		return "", err
 	}
-
-	if entry.Tag != dwarf.TagFormalParameter && entry.Tag != dwarf.TagVariable {
-		return nil, fmt.Errorf("invalid entry tag, only supports FormalParameter and Variable, got %s", entry.Tag.String())
+	if once.Addr == 0 {
+		return "", fmt.Errorf("%s is nil", v.Name)
 	}
-
-	n, ok := entry.Val(dwarf.AttrName).(string)
-	if !ok {
-		return nil, fmt.Errorf("type assertion failed")
+	once.Name = v.Name
+	once = once.resolveTypedefs()
+	if t, ok := once.dwarfType.(*dwarf.StructType); !ok || t.StructName != "sync.Once" {
+		return "", fmt.Errorf("%s is not a sync.Once", v.Name)
 	}
-
-	offset, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
-	if !ok {
-		return nil, fmt.Errorf("type assertion failed")
+	done, err := once.structMember("done")
+	if err != nil {
+		return "", err
+	}
+	// done is an atomic.Uint32 in newer versions of the package.
+	if t, ok := done.resolveTypedefs().dwarfType.(*dwarf.StructType); ok && t.StructName == "sync/atomic.Uint32" {
+		if done, err = done.structMember("v"); err != nil {
+			return "", err
+		}
 	}
+	val, err := done.thread.readUintRaw(done.Addr, done.dwarfType.Size())
+	if err != nil {
+		return "", err
+	}
+	if val != 0 {
+		return "done", nil
+	}
+	return "pending", nil
+}
 
-	t, err := scope.Type(offset)
+// Formats the err field of a cancelCtx, which is an atomic.Value
+// holding the error in newer versions of the context package.
+func (v *Variable) contextErr() (string, error) {
+	if t, ok := v.resolveTypedefs().dwarfType.(*dwarf.StructType); ok && t.StructName == "sync/atomic.Value" {
+		var err error
+		if v, err = v.structMember("v"); err != nil {
+			return "", err
+		}
+	}
+	name, data, err := v.resolveTypedefs().interfaceValue()
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if data == nil {
+		return "active", nil
+	}
+	var msg string
+	switch {
+	case name == "*errors.errorString":
+		s, err := data.structMember("s")
+		if err != nil {
+			return "", err
+		}
+		msg, err = v.thread.readString(s.Addr)
+		if err != nil {
+			return "", err
+		}
+	case strings.HasSuffix(name, "context.deadlineExceededError"):
+		msg = "context deadline exceeded"
+	default:
+		val, err := data.loadValueInternal(false, 0, DefaultLoadConfig.normalized())
+		if err != nil {
+			return "", err
+		}
+		msg = fmt.Sprintf("%s(%s)", name, val)
 	}
+	return "cancelled: " + msg, nil
+}
 
-	instructions, ok := entry.Val(dwarf.AttrLocation).([]byte)
+// MapStats decodes the runtime header of the map v. Fields are found by
+// name so that the differences between the layouts used by the versions
+// of the runtime are accounted for.
+func (v *Variable) MapStats() (*MapStats, error) {
+	ptr, ok := v.resolveTypedefs().dwarfType.(*dwarf.PtrType)
 	if !ok {
-		return nil, fmt.Errorf("type assertion failed")
+		return nil, fmt.Errorf("%s is not a map", v.Name)
 	}
-
-	addr, err := op.ExecuteStackProgram(scope.CFA, instructions)
+	hmap, ok := ptr.Type.(*dwarf.StructType)
+	if !ok || !(strings.HasPrefix(hmap.StructName, "hash<") || hmap.StructName == "runtime.hmap") {
+		return nil, fmt.Errorf("%s is not a map", v.Name)
+	}
+	hmapAddr, err := v.readUintRaw(int64(v.thread.dbp.arch.PtrSize()))
 	if err != nil {
 		return nil, err
 	}
+	stats := &MapStats{Buckets: 1, Overflow: -1}
+	if hmapAddr == 0 {
+		return stats, nil
+	}
 
-	return newVariable(n, uintptr(addr), t, scope.Thread)
+	for _, field := range hmap.Field {
+		switch field.Name {
+		case "count", "B", "noverflow", "oldbuckets":
+		default:
+			continue
+		}
+		val, err := v.thread.readUintRaw(uintptr(int64(hmapAddr)+field.ByteOffset), field.Type.Size())
+		if err != nil {
+			return nil, err
+		}
+		switch field.Name {
+		case "count":
+			stats.Count = int64(val)
+		case "B":
+			stats.Buckets = 1 << val
+		case "noverflow":
+			stats.Overflow = int64(val)
+		case "oldbuckets":
+			stats.Growing = val != 0
+		}
+	}
+	stats.LoadFactor = float64(stats.Count) / float64(stats.Buckets)
+	return stats, nil
 }
 
 // If v is a pointer a new variable is returned containing the value pointed by v.
@@ -516,7 +1779,7 @@ func (v *Variable) maybeDereference() (*Variable, error) {
 
 	switch t := v.dwarfType.(type) {
 	case *dwarf.PtrType:
-		ptrval, err := v.thread.readUintRaw(uintptr(v.Addr), int64(v.thread.dbp.arch.PtrSize()))
+		ptrval, err := v.readUintRaw(int64(v.thread.dbp.arch.PtrSize()))
 		if err != nil {
 			return nil, err
 		}
@@ -529,26 +1792,36 @@ func (v *Variable) maybeDereference() (*Variable, error) {
 
 // Returns a Variable with the same address but a concrete dwarfType.
 func (v *Variable) resolveTypedefs() *Variable {
-	typ := v.dwarfType
+	r := *v
+	r.dwarfType = resolveTypedefs(v.dwarfType)
+	return &r
+}
+
+// Returns the type named by typ, following chains of typedefs.
+func resolveTypedefs(typ dwarf.Type) dwarf.Type {
 	for {
 		if tt, ok := typ.(*dwarf.TypedefType); ok {
 			typ = tt.Type
 		} else {
-			break
+			return typ
 		}
 	}
-	r := *v
-	r.dwarfType = typ
-	return &r
 }
 
-// Extracts the value of the variable at the given address.
-func (v *Variable) loadValue(printStructName bool) (err error) {
-	v.Value, err = v.loadValueInternal(printStructName, 0)
+// Extracts the value of the variable at the given address, as
+// DefaultLoadConfig allows.
+func (v *Variable) loadValue(printStructName bool) error {
+	return v.loadValueWithConfig(printStructName, DefaultLoadConfig)
+}
+
+// Extracts the value of the variable at the given address, reading no
+// more than allowed by cfg.
+func (v *Variable) loadValueWithConfig(printStructName bool, cfg LoadConfig) (err error) {
+	v.Value, err = v.loadValueInternal(printStructName, 0, cfg.normalized())
 	return
 }
 
-func (v *Variable) loadValueInternal(printStructName bool, recurseLevel int) (string, error) {
+func (v *Variable) loadValueInternal(printStructName bool, recurseLevel int, cfg LoadConfig) (string, error) {
 	v = v.resolveTypedefs()
 
 	switch t := v.dwarfType.(type) {
@@ -561,9 +1834,15 @@ func (v *Variable) loadValueInternal(printStructName bool, recurseLevel int) (st
 		if ptrv.Addr == 0 {
 			return fmt.Sprintf("%s nil", t.String()), nil
 		}
+		if cfg.FollowPointers == 0 {
+			return fmt.Sprintf("(%s)(%#x)", t.String(), ptrv.Addr), nil
+		}
+		if cfg.FollowPointers > 0 {
+			cfg.FollowPointers--
+		}
 
 		// Don't increase the recursion level when dereferencing pointers
-		val, err := ptrv.loadValueInternal(printStructName, recurseLevel)
+		val, err := ptrv.loadValueInternal(printStructName, recurseLevel, cfg)
 		if err != nil {
 			return "", err
 		}
@@ -572,16 +1851,22 @@ func (v *Variable) loadValueInternal(printStructName bool, recurseLevel int) (st
 	case *dwarf.StructType:
 		switch {
 		case t.StructName == "string":
-			return v.thread.readString(uintptr(v.Addr))
+			return v.thread.loadString(uintptr(v.Addr), cfg)
 		case strings.HasPrefix(t.StructName, "[]"):
-			return v.loadArrayValues(recurseLevel)
+			return v.loadArrayValues(recurseLevel, cfg)
+		case t.StructName == "runtime.eface" || t.StructName == "runtime.iface":
+			return v.loadInterface(recurseLevel, cfg)
 		default:
 			// Recursively call extractValue to grab
 			// the value of all the members of the struct.
-			if recurseLevel <= maxVariableRecurse {
+			if recurseLevel <= cfg.MaxVariableRecurse {
 				errcount := 0
 				fields := make([]string, 0, len(t.Field))
 				for i, field := range t.Field {
+					if i >= cfg.MaxStructFields {
+						fields = append(fields, fmt.Sprintf("...+%d more", len(t.Field)-i))
+						break
+					}
 					var (
 						err      error
 						val      string
@@ -590,9 +1875,16 @@ func (v *Variable) loadValueInternal(printStructName bool, recurseLevel int) (st
 
 					fieldvar, err = v.toField(field)
 					if err == nil {
-						val, err = fieldvar.loadValueInternal(printStructName, recurseLevel+1)
+						val, err = fieldvar.loadValueInternal(printStructName, recurseLevel+1, cfg)
 					}
 					if err != nil {
+						if cfg.Unreadable == UnreadableAbort {
+							return "", err
+						}
+						if cfg.Unreadable == UnreadableTruncate {
+							fields = append(fields, fmt.Sprintf("...+%d more (unreadable)", len(t.Field)-i))
+							break
+						}
 						errcount++
 						val = fmt.Sprintf("<unreadable: %s>", err.Error())
 					}
@@ -615,7 +1907,7 @@ func (v *Variable) loadValueInternal(printStructName bool, recurseLevel int) (st
 			return "{...}", nil
 		}
 	case *dwarf.ArrayType:
-		return v.loadArrayValues(recurseLevel)
+		return v.loadArrayValues(recurseLevel, cfg)
 	case *dwarf.ComplexType:
 		return v.readComplex(t.ByteSize)
 	case *dwarf.IntType:
@@ -641,6 +1933,9 @@ func (v *Variable) loadValueInternal(printStructName bool, recurseLevel int) (st
 
 func (v *Variable) setValue(value string) error {
 	v = v.resolveTypedefs()
+	if v.regValue != nil {
+		return fmt.Errorf("can not set %s, it is stored in a register", v.Name)
+	}
 
 	switch t := v.dwarfType.(type) {
 	case *dwarf.PtrType:
@@ -661,6 +1956,12 @@ func (v *Variable) setValue(value string) error {
 }
 
 func (thread *Thread) readString(addr uintptr) (string, error) {
+	return thread.loadString(addr, DefaultLoadConfig.normalized())
+}
+
+// Reads the string at addr, up to cfg.MaxStringLen bytes. cfg.Unreadable
+// says what to do if only a prefix of them can be read.
+func (thread *Thread) loadString(addr uintptr, cfg LoadConfig) (string, error) {
 	// string data structure is always two ptrs in size. Addr, followed by len
 	// http://research.swtch.com/godata
 
@@ -675,8 +1976,8 @@ func (thread *Thread) readString(addr uintptr) (string, error) {
 	}
 
 	count := strlen
-	if count > maxArrayValues {
-		count = maxArrayValues
+	if count > cfg.MaxStringLen {
+		count = cfg.MaxStringLen
 	}
 
 	// read addr
@@ -689,14 +1990,19 @@ func (thread *Thread) readString(addr uintptr) (string, error) {
 		return "", nil
 	}
 
-	val, err = thread.readMemory(addr, count)
-	if err != nil {
+	// A corrupted length can make the string extend past the mapped
+	// memory, keep the bytes that can be read.
+	val, err = thread.readMemoryPrefix(addr, count)
+	if err != nil && (len(val) == 0 || cfg.Unreadable == UnreadableAbort) {
 		return "", fmt.Errorf("could not read string at %#v due to %s", addr, err)
 	}
 
 	retstr := *(*string)(unsafe.Pointer(&val))
 
-	if count != strlen {
+	switch {
+	case len(val) != count:
+		retstr = retstr + fmt.Sprintf("...+%d more (unreadable)", strlen-len(val))
+	case count != strlen:
 		retstr = retstr + fmt.Sprintf("...+%d more", strlen-count)
 	}
 
@@ -750,23 +2056,30 @@ func (v *Variable) loadSliceInfo(t *dwarf.StructType) error {
 	return nil
 }
 
-func (v *Variable) loadArrayValues(recurseLevel int) (string, error) {
+func (v *Variable) loadArrayValues(recurseLevel int, cfg LoadConfig) (string, error) {
 	vals := make([]string, 0)
 	errcount := 0
 
 	for i := int64(0); i < v.Len; i++ {
 		// Cap number of elements
-		if i >= maxArrayValues {
-			vals = append(vals, fmt.Sprintf("...+%d more", v.Len-maxArrayValues))
+		if i >= int64(cfg.MaxArrayValues) {
+			vals = append(vals, fmt.Sprintf("...+%d more", v.Len-i))
 			break
 		}
 
 		var val string
 		fieldvar, err := newVariable("", uintptr(int64(v.base)+(i*v.stride)), v.fieldType, v.thread)
 		if err == nil {
-			val, err = fieldvar.loadValueInternal(false, recurseLevel+1)
+			val, err = fieldvar.loadValueInternal(false, recurseLevel+1, cfg)
 		}
 		if err != nil {
+			if cfg.Unreadable == UnreadableAbort {
+				return "", err
+			}
+			if cfg.Unreadable == UnreadableTruncate {
+				vals = append(vals, fmt.Sprintf("...+%d more (unreadable)", v.Len-i))
+				break
+			}
 			errcount++
 			val = fmt.Sprintf("<unreadable: %s>", err.Error())
 		}
@@ -785,6 +2098,206 @@ func (v *Variable) loadArrayValues(recurseLevel int) (string, error) {
 	}
 }
 
+// TypeAssert returns the value held by the interface v, read according
+// to cfg, if its dynamic type is typename, i.e. "*main.T", as the type
+// assertion v.(*main.T) would. Otherwise the error mirrors the panic of
+// the assertion.
+func (v *Variable) TypeAssert(typename string, cfg LoadConfig) (*Variable, error) {
+	rv := v.resolveTypedefs()
+	t, ok := rv.dwarfType.(*dwarf.StructType)
+	if !ok || (t.StructName != "runtime.iface" && t.StructName != "runtime.eface") {
+		return nil, fmt.Errorf("%s (type %s) is not an interface", v.Name, v.Type)
+	}
+	name, data, err := rv.interfaceValue()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("interface conversion: interface is nil, not %s", typename)
+	}
+	if name != typename {
+		return nil, fmt.Errorf("interface conversion: %s is %s, not %s", v.Type, name, typename)
+	}
+	data.Name = fmt.Sprintf("%s.(%s)", v.Name, typename)
+	err = data.loadValueWithConfig(true, cfg)
+	return data, err
+}
+
+// Returns the name of the dynamic type of the interface v and a
+// variable of that type holding its value, using the runtime type
+// descriptor it points to. The variable is nil if v is nil.
+func (v *Variable) interfaceValue() (string, *Variable, error) {
+	typeVar := v
+	if t := v.dwarfType.(*dwarf.StructType); t.StructName == "runtime.iface" {
+		tab, err := v.structMember("tab")
+		if err != nil {
+			return "", nil, err
+		}
+		tabptr, err := v.thread.readUintRaw(uintptr(tab.Addr), int64(v.thread.dbp.arch.PtrSize()))
+		if err != nil {
+			return "", nil, err
+		}
+		if tabptr == 0 {
+			return "", nil, nil
+		}
+		typeVar = tab
+	}
+	typ, err := typeVar.structMember("_type")
+	if err != nil {
+		return "", nil, err
+	}
+	typptr, err := v.thread.readUintRaw(uintptr(typ.Addr), int64(v.thread.dbp.arch.PtrSize()))
+	if err != nil {
+		return "", nil, err
+	}
+	if typptr == 0 {
+		return "", nil, nil
+	}
+
+	typname, err := typ.structMember("_string")
+	if err == nil {
+		typname, err = typname.maybeDereference()
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	name, err := v.thread.readString(uintptr(typname.Addr))
+	if err != nil {
+		return "", nil, err
+	}
+	kind, err := typ.structMember("kind")
+	if err != nil {
+		return "", nil, err
+	}
+	kindval, err := v.thread.readUintRaw(uintptr(kind.Addr), 1)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rdr := reader.New(v.thread.dbp.dwarf)
+	entry, err := rdr.SeekToTypeNamed(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not find type %s: %s", name, err)
+	}
+	dynType, err := v.thread.dbp.dwarf.Type(entry.Offset)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := v.structMember("data")
+	if err != nil {
+		return "", nil, err
+	}
+	// Pointer shaped values are stored directly in the data word,
+	// everything else is pointed to by it.
+	addr := data.Addr
+	if kindval&kindDirectIface == 0 {
+		dataptr, err := v.thread.readUintRaw(uintptr(data.Addr), int64(v.thread.dbp.arch.PtrSize()))
+		if err != nil {
+			return "", nil, err
+		}
+		addr = uintptr(dataptr)
+	}
+	datav, err := newVariable("", addr, dynType, v.thread)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, datav, nil
+}
+
+// ReflectValue returns the value wrapped by v, a reflect.Value, as a
+// variable of its type. The type is read from the typ field, the value is
+// stored in the ptr field if it is pointer shaped and pointed to by it
+// otherwise, as told by the flag field.
+func (v *Variable) ReflectValue(cfg LoadConfig) (*Variable, error) {
+	rv := v.resolveTypedefs()
+	if t, ok := rv.dwarfType.(*dwarf.StructType); !ok || t.StructName != "reflect.Value" {
+		return nil, fmt.Errorf("%s (type %s) is not a reflect.Value", v.Name, v.Type)
+	}
+	typ, err := rv.structMember("typ")
+	if err != nil {
+		return nil, err
+	}
+	typptr, err := v.thread.readUintRaw(uintptr(typ.Addr), int64(v.thread.dbp.arch.PtrSize()))
+	if err != nil {
+		return nil, err
+	}
+	if typptr == 0 {
+		return nil, fmt.Errorf("%s is the zero reflect.Value", v.Name)
+	}
+	typname, err := typ.structMember("string")
+	if err == nil {
+		typname, err = typname.maybeDereference()
+	}
+	if err != nil {
+		return nil, err
+	}
+	name, err := v.thread.readString(uintptr(typname.Addr))
+	if err != nil {
+		return nil, err
+	}
+	entry, err := reader.New(v.thread.dbp.dwarf).SeekToTypeNamed(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not find type %s: %s", name, err)
+	}
+	valType, err := v.thread.dbp.dwarf.Type(entry.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	flag, err := rv.structMember("flag")
+	if err != nil {
+		return nil, err
+	}
+	flagval, err := v.thread.readUintRaw(uintptr(flag.Addr), int64(v.thread.dbp.arch.PtrSize()))
+	if err != nil {
+		return nil, err
+	}
+	ver, _, err := v.thread.dbp.getGoInformation()
+	if err != nil {
+		return nil, err
+	}
+	indir := uint64(reflectFlagIndir)
+	if !ver.AfterOrEqual(GoVersion{1, 6, -1, 0, 0}) {
+		indir = reflectFlagIndirGo15
+	}
+	ptr, err := rv.structMember("ptr")
+	if err != nil {
+		return nil, err
+	}
+	addr := ptr.Addr
+	if flagval&indir != 0 {
+		ptrval, err := v.thread.readUintRaw(uintptr(ptr.Addr), int64(v.thread.dbp.arch.PtrSize()))
+		if err != nil {
+			return nil, err
+		}
+		addr = uintptr(ptrval)
+	}
+	val, err := newVariable(fmt.Sprintf("%s.Interface().(%s)", v.Name, name), addr, valType, v.thread)
+	if err != nil {
+		return nil, err
+	}
+	err = val.loadValueWithConfig(true, cfg)
+	return val, err
+}
+
+// Loads the value held by an interface, formatted as a conversion
+// to its dynamic type.
+func (v *Variable) loadInterface(recurseLevel int, cfg LoadConfig) (string, error) {
+	name, data, err := v.interfaceValue()
+	if err != nil {
+		return "", err
+	}
+	if data == nil {
+		return "nil", nil
+	}
+	val, err := data.loadValueInternal(false, recurseLevel, cfg)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s(%s)", name, val), nil
+}
+
 func (v *Variable) readComplex(size int64) (string, error) {
 	var fs int64
 	switch size {
@@ -884,7 +2397,7 @@ func (v *Variable) writeComplex(value string, size int64) error {
 }
 
 func (v *Variable) readInt(size int64) (string, error) {
-	n, err := v.thread.readIntRaw(v.Addr, size)
+	n, err := v.readIntRaw(size)
 	if err != nil {
 		return "", err
 	}
@@ -914,7 +2427,7 @@ func (thread *Thread) readIntRaw(addr uintptr, size int64) (int64, error) {
 }
 
 func (v *Variable) readUint(size int64) (string, error) {
-	n, err := v.thread.readUintRaw(v.Addr, size)
+	n, err := v.readUintRaw(size)
 	if err != nil {
 		return "", err
 	}
@@ -977,7 +2490,7 @@ func (thread *Thread) readUintRaw(addr uintptr, size int64) (uint64, error) {
 }
 
 func (v *Variable) readFloat(size int64) (string, error) {
-	val, err := v.thread.readMemory(v.Addr, int(size))
+	val, err := v.readMemory(int(size))
 	if err != nil {
 		return "", err
 	}
@@ -1022,7 +2535,7 @@ func (v *Variable) writeFloatRaw(f float64, size int64) error {
 }
 
 func (v *Variable) readBool() (string, error) {
-	val, err := v.thread.readMemory(v.Addr, 1)
+	val, err := v.readMemory(1)
 	if err != nil {
 		return "", err
 	}
@@ -1047,24 +2560,44 @@ func (v *Variable) writeBool(value string) error {
 	return err
 }
 
-func (v *Variable) readFunctionPtr() (string, error) {
-	val, err := v.thread.readMemory(v.Addr, v.thread.dbp.arch.PtrSize())
+// FunctionEntry returns the entry PC of the function v refers to,
+// either because v names a function or because it is a func value.
+// Nil func values have an entry PC of zero.
+func (v *Variable) FunctionEntry() (uint64, error) {
+	if v.fnEntry != 0 {
+		return v.fnEntry, nil
+	}
+	if _, ok := v.resolveTypedefs().dwarfType.(*dwarf.FuncType); !ok {
+		return 0, fmt.Errorf("%s is not a function", v.Name)
+	}
+
+	val, err := v.readMemory(v.thread.dbp.arch.PtrSize())
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
 	// dereference pointer to find function pc
 	fnaddr := uintptr(binary.LittleEndian.Uint64(val))
 	if fnaddr == 0 {
-		return "nil", nil
+		return 0, nil
 	}
 
 	val, err = v.thread.readMemory(fnaddr, v.thread.dbp.arch.PtrSize())
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(val), nil
+}
+
+func (v *Variable) readFunctionPtr() (string, error) {
+	funcAddr, err := v.FunctionEntry()
 	if err != nil {
 		return "", err
 	}
+	if funcAddr == 0 {
+		return "nil", nil
+	}
 
-	funcAddr := binary.LittleEndian.Uint64(val)
 	fn := v.thread.dbp.goSymTable.PCToFunc(uint64(funcAddr))
 	if fn == nil {
 		return "", fmt.Errorf("could not find function for %#v", funcAddr)
@@ -1074,7 +2607,7 @@ func (v *Variable) readFunctionPtr() (string, error) {
 }
 
 // Fetches all variables of a specific type in the current function scope
-func (scope *EvalScope) variablesByTag(tag dwarf.Tag) ([]*Variable, error) {
+func (scope *EvalScope) variablesByTag(tag dwarf.Tag, cfg LoadConfig) ([]*Variable, error) {
 	reader := scope.DwarfReader()
 
 	_, err := reader.SeekToFunction(scope.PC)
@@ -1090,7 +2623,7 @@ func (scope *EvalScope) variablesByTag(tag dwarf.Tag) ([]*Variable, error) {
 		}
 
 		if entry.Tag == tag {
-			val, err := scope.extractVariableFromEntry(entry)
+			val, err := scope.extractVariableFromEntry(entry, cfg)
 			if err != nil {
 				// skip variables that we can't parse yet
 				continue
@@ -2,8 +2,10 @@ package proc
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 
 	protest "github.com/derekparker/delve/proc/test"
@@ -36,7 +38,7 @@ func evalVariable(p *Process, symbol string) (*Variable, error) {
 	if err != nil {
 		return nil, err
 	}
-	return scope.EvalVariable(symbol)
+	return scope.EvalVariable(symbol, DefaultLoadConfig)
 }
 
 func (tc *varTest) settable() bool {
@@ -192,7 +194,7 @@ func (s varArray) Less(i, j int) bool {
 
 func TestLocalVariables(t *testing.T) {
 	testcases := []struct {
-		fn     func(*EvalScope) ([]*Variable, error)
+		fn     func(*EvalScope, LoadConfig) ([]*Variable, error)
 		output []varTest
 	}{
 		{(*EvalScope).LocalVariables,
@@ -244,7 +246,7 @@ func TestLocalVariables(t *testing.T) {
 		for _, tc := range testcases {
 			scope, err := p.CurrentThread.Scope()
 			assertNoError(err, t, "AsScope()")
-			vars, err := tc.fn(scope)
+			vars, err := tc.fn(scope, DefaultLoadConfig)
 			assertNoError(err, t, "LocalVariables() returned an error")
 
 			sort.Sort(varArray(vars))
@@ -298,7 +300,7 @@ func TestFrameEvaluation(t *testing.T) {
 			scope, err := p.ConvertEvalScope(g.Id, frame)
 			assertNoError(err, t, "ConvertEvalScope()")
 			t.Logf("scope = %v", scope)
-			v, err := scope.EvalVariable("i")
+			v, err := scope.EvalVariable("i", DefaultLoadConfig)
 			t.Logf("v = %v", v)
 			if err != nil {
 				t.Logf("Goroutine %d: %v\n", g.Id, err)
@@ -323,7 +325,7 @@ func TestFrameEvaluation(t *testing.T) {
 		for i := 0; i <= 3; i++ {
 			scope, err := p.ConvertEvalScope(g.Id, i+1)
 			assertNoError(err, t, fmt.Sprintf("ConvertEvalScope() on frame %d", i+1))
-			v, err := scope.EvalVariable("n")
+			v, err := scope.EvalVariable("n", DefaultLoadConfig)
 			assertNoError(err, t, fmt.Sprintf("EvalVariable() on frame %d", i+1))
 			n, err := strconv.Atoi(v.Value)
 			assertNoError(err, t, fmt.Sprintf("strconv.Atoi(%s) on frame %d", v.Value, i+1))
@@ -388,3 +390,718 @@ func TestPointerSetting(t *testing.T) {
 		pval("*5")
 	})
 }
+
+func TestEnumName(t *testing.T) {
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		v, err := evalVariable(p, "d1")
+		assertNoError(err, t, "EvalVariable(d1)")
+		if name := v.EnumName(); name != "main.Monday" {
+			t.Fatalf("Wrong enum name for d1: %q (expected: main.Monday)", name)
+		}
+
+		v, err = evalVariable(p, "d2")
+		assertNoError(err, t, "EvalVariable(d2)")
+		if name := v.EnumName(); name != "" {
+			t.Fatalf("Unexpected enum name for d2: %q", name)
+		}
+	})
+}
+
+func TestInterfaceValues(t *testing.T) {
+	testcases := []varTest{
+		{"ifaces", "[]interface {} len: 5, cap: 5, [int(1),string(x),main.astruct({A: 2}),*main.astruct(*{A: 3}),nil]", "", "[]interface {}", nil},
+		{"stringer", "main.Weekday(1)", "", "fmt.Stringer", nil},
+	}
+
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		for _, tc := range testcases {
+			v, err := evalVariable(p, tc.name)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			assertVariable(t, v, tc)
+		}
+	})
+}
+
+func TestVariableDiff(t *testing.T) {
+	expected := []VariableDiff{
+		{"In.X", "2", "3"},
+		{"Arr[1]", "2", "5"},
+		{"len(Sl)", "3", "2"},
+	}
+
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		o1, err := evalVariable(p, "o1")
+		assertNoError(err, t, "EvalVariable(o1)")
+		o2, err := evalVariable(p, "o2")
+		assertNoError(err, t, "EvalVariable(o2)")
+
+		diffs, err := o1.Diff(o2)
+		assertNoError(err, t, "Diff()")
+		if len(diffs) != len(expected) {
+			t.Fatalf("Expected %d differences got %d: %v", len(expected), len(diffs), diffs)
+		}
+		for i := range expected {
+			if diffs[i] != expected[i] {
+				t.Fatalf("Expected %#v got %#v", expected[i], diffs[i])
+			}
+		}
+
+		diffs, err = o1.Diff(o1)
+		assertNoError(err, t, "Diff()")
+		if len(diffs) != 0 {
+			t.Fatalf("Unexpected differences comparing o1 to itself: %v", diffs)
+		}
+	})
+}
+
+func TestPtrElemType(t *testing.T) {
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		v, err := evalVariable(p, "n.Next")
+		assertNoError(err, t, "EvalVariable(n.Next)")
+		if typ := v.PtrElemType(); typ != "main.node" {
+			t.Fatalf("Wrong element type for n.Next: %q (expected: main.node)", typ)
+		}
+
+		v, err = evalVariable(p, "n.Val")
+		assertNoError(err, t, "EvalVariable(n.Val)")
+		if typ := v.PtrElemType(); typ != "" {
+			t.Fatalf("Unexpected element type for n.Val: %q", typ)
+		}
+	})
+}
+
+func TestPtrDiff(t *testing.T) {
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		start, err := evalVariable(p, "start")
+		assertNoError(err, t, "EvalVariable(start)")
+		end, err := evalVariable(p, "end")
+		assertNoError(err, t, "EvalVariable(end)")
+
+		n, err := end.PtrDiff(start)
+		assertNoError(err, t, "PtrDiff(end, start)")
+		if n != 5 {
+			t.Fatalf("Wrong distance between end and start: %d (expected: 5)", n)
+		}
+		n, err = start.PtrDiff(end)
+		assertNoError(err, t, "PtrDiff(start, end)")
+		if n != -5 {
+			t.Fatalf("Wrong distance between start and end: %d (expected: -5)", n)
+		}
+
+		ps, err := evalVariable(p, "ps")
+		assertNoError(err, t, "EvalVariable(ps)")
+		if _, err := ps.PtrDiff(start); err == nil {
+			t.Fatal("expected an error for pointers to different types")
+		}
+	})
+}
+
+func TestContextState(t *testing.T) {
+	testcases := []struct {
+		name  string
+		state string
+	}{
+		{"background", "active"},
+		{"active", "active"},
+		{"cancelled", "cancelled: context canceled"},
+		{"expired", "cancelled: context deadline exceeded"},
+		{"values", "cancelled: context canceled"},
+	}
+
+	withTestProcess("contextprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		for _, tc := range testcases {
+			v, err := evalVariable(p, tc.name)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			state, err := v.ContextState()
+			assertNoError(err, t, fmt.Sprintf("ContextState(%s)", tc.name))
+			if state != tc.state {
+				t.Fatalf("Wrong state for %s: %q (expected: %q)", tc.name, state, tc.state)
+			}
+		}
+
+		for name, closed := range map[string]bool{"closedDone": true, "openDone": false, "nilDone": false} {
+			v, err := evalVariable(p, name)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", name))
+			c, err := v.resolveTypedefs().chanClosed()
+			assertNoError(err, t, fmt.Sprintf("chanClosed(%s)", name))
+			if c != closed {
+				t.Fatalf("Wrong closed state for %s: %v (expected: %v)", name, c, closed)
+			}
+		}
+	})
+}
+
+func TestOnceState(t *testing.T) {
+	withTestProcess("onceprog", t, func(p *Process, fixture protest.Fixture) {
+		for _, state := range []string{"pending", "done"} {
+			assertNoError(p.Continue(), t, "Continue() returned an error")
+			for _, name := range []string{"once", "ponce"} {
+				v, err := evalVariable(p, name)
+				assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", name))
+				s, err := v.OnceState()
+				assertNoError(err, t, fmt.Sprintf("OnceState(%s)", name))
+				if s != state {
+					t.Fatalf("Wrong state for %s: %q (expected: %q)", name, s, state)
+				}
+			}
+		}
+	})
+}
+
+func TestFollowPointers(t *testing.T) {
+	withTestProcess("testvariables", t, func(p *Process, fixture protest.Fixture) {
+		pc, _, _ := p.goSymTable.LineToPC(fixture.Source, varTestBreakpointLineNumber)
+		_, err := p.SetBreakpoint(pc)
+		assertNoError(err, t, "SetBreakpoint() returned an error")
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+		scope, err := p.CurrentThread.Scope()
+		assertNoError(err, t, "Scope()")
+
+		testcases := []struct {
+			name           string
+			followPointers int
+			value          string
+		}{
+			{"a7", 0, "(*main.FooBar)(0x"},
+			{"a7", 1, "*main.FooBar {Baz: 5, Bur: strum}"},
+			{"a9", 0, "*main.FooBar nil"},
+			{"ms", 1, "main.Nest {Level: 0, Nest: *main.Nest {Level: 1, Nest: (*main.Nest)(0x"},
+		}
+		for _, tc := range testcases {
+			cfg := DefaultLoadConfig
+			cfg.FollowPointers = tc.followPointers
+			v, err := scope.EvalVariable(tc.name, cfg)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			if !strings.HasPrefix(v.Value, tc.value) {
+				t.Fatalf("wrong value for %s with FollowPointers %d: %q (expected: %q)", tc.name, tc.followPointers, v.Value, tc.value)
+			}
+		}
+	})
+}
+
+func TestEvalPackageExpression(t *testing.T) {
+	withTestProcess("pkgvarsprog", t, func(p *Process, fixture protest.Fixture) {
+		_, err := p.SetBreakpoint(p.goSymTable.LookupFunc("runtime.GC").Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		v, err := p.EvalPackageExpression("main.items", DefaultLoadConfig)
+		assertNoError(err, t, "EvalPackageExpression(main.items)")
+		if v.Len != 4 {
+			t.Fatalf("wrong length of main.items: %d (expected: 4)", v.Len)
+		}
+		v, err = p.EvalPackageExpression("main.cfg.Items", DefaultLoadConfig)
+		assertNoError(err, t, "EvalPackageExpression(main.cfg.Items)")
+		if v.Len != 2 {
+			t.Fatalf("wrong length of main.cfg.Items: %d (expected: 2)", v.Len)
+		}
+		v, err = p.EvalPackageExpression("main.cfg.Name", DefaultLoadConfig)
+		assertNoError(err, t, "EvalPackageExpression(main.cfg.Name)")
+		if v.Value != "cfg" {
+			t.Fatalf("wrong value of main.cfg.Name: %q (expected: \"cfg\")", v.Value)
+		}
+		if _, err := p.EvalPackageExpression("items", DefaultLoadConfig); err == nil {
+			t.Fatal("unqualified package variable resolved without a scope")
+		}
+	})
+}
+
+func TestUnreadablePolicy(t *testing.T) {
+	testcases := []struct {
+		name   string
+		policy UnreadablePolicy
+		value  string // Empty if loading must fail.
+	}{
+		{"main.h", UnreadablePlaceholder, "main.holder {A: 1, P: <unreadable: "},
+		{"main.h", UnreadableTruncate, "main.holder {A: 1, ...+2 more (unreadable)}"},
+		{"main.h", UnreadableAbort, ""},
+		{"main.ptrs", UnreadablePlaceholder, "[]*int len: 3, cap: 3, [*1,<unreadable: "},
+		{"main.ptrs", UnreadableTruncate, "[]*int len: 3, cap: 3, [*1,...+2 more (unreadable)]"},
+		{"main.ptrs", UnreadableAbort, ""},
+	}
+	withTestProcess("unreadableprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		scope, err := p.CurrentThread.Scope()
+		assertNoError(err, t, "Scope()")
+		for _, tc := range testcases {
+			cfg := DefaultLoadConfig
+			cfg.Unreadable = tc.policy
+			v, err := scope.EvalVariable(tc.name, cfg)
+			if tc.value == "" {
+				if err == nil {
+					t.Fatalf("loading %s with policy %d did not fail: %q", tc.name, tc.policy, v.Value)
+				}
+				continue
+			}
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			if !strings.HasPrefix(v.Value, tc.value) {
+				t.Fatalf("wrong value for %s with policy %d: %q (expected: %q)", tc.name, tc.policy, v.Value, tc.value)
+			}
+		}
+	})
+}
+
+func TestLoadConfigLimits(t *testing.T) {
+	x := strings.Repeat("x", 100)
+	zeros := strings.TrimSuffix(strings.Repeat("0,", 100), ",")
+	with := func(change func(*LoadConfig)) LoadConfig {
+		cfg := DefaultLoadConfig
+		change(&cfg)
+		return cfg
+	}
+	testcases := []struct {
+		name  string
+		cfg   LoadConfig
+		value string
+	}{
+		{"main.long", DefaultLoadConfig, x[:64] + "...+36 more"},
+		{"main.long", with(func(cfg *LoadConfig) { cfg.MaxStringLen = 10 }), x[:10] + "...+90 more"},
+		{"main.long", with(func(cfg *LoadConfig) { cfg.MaxStringLen = -1 }), x},
+		{"main.many", DefaultLoadConfig, "[]int len: 100, cap: 100, [" + zeros[:127] + ",...+36 more]"},
+		{"main.many", with(func(cfg *LoadConfig) { cfg.MaxArrayValues = 2 }), "[]int len: 100, cap: 100, [0,0,...+98 more]"},
+		{"main.many", with(func(cfg *LoadConfig) { cfg.MaxArrayValues = -1 }), "[]int len: 100, cap: 100, [" + zeros + "]"},
+		{"main.nested", DefaultLoadConfig, "main.deep {O: main.outer {In: main.inner {...}, C: 3}}"},
+		{"main.nested", with(func(cfg *LoadConfig) { cfg.MaxVariableRecurse = -1 }), "main.deep {O: main.outer {In: main.inner {A: 1, B: 2}, C: 3}}"},
+		{"main.nested.O", with(func(cfg *LoadConfig) { cfg.MaxStructFields = 1 }), "main.outer {In: main.inner {A: 1, ...+1 more}, ...+1 more}"},
+	}
+	withTestProcess("loadlimitsprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		scope, err := p.CurrentThread.Scope()
+		assertNoError(err, t, "Scope()")
+		for _, tc := range testcases {
+			v, err := scope.EvalVariable(tc.name, tc.cfg)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			if v.Value != tc.value {
+				t.Fatalf("wrong value for %s with %+v: %q (expected: %q)", tc.name, tc.cfg, v.Value, tc.value)
+			}
+		}
+	})
+}
+
+func TestLoadConfigHardLimits(t *testing.T) {
+	cfg := LoadConfig{MaxStringLen: -1, MaxArrayValues: math.MaxInt32}.normalized()
+	if cfg.MaxStringLen != maxStringLenLimit || cfg.MaxArrayValues != maxArrayValuesLimit {
+		t.Fatalf("hard limits not applied: %+v", cfg)
+	}
+}
+
+func TestTypeAssert(t *testing.T) {
+	withTestProcess("pkgvarsprog", t, func(p *Process, fixture protest.Fixture) {
+		_, err := p.SetBreakpoint(p.goSymTable.LookupFunc("runtime.GC").Entry)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+
+		value, err := p.EvalPackageExpression("main.value", DefaultLoadConfig)
+		assertNoError(err, t, "EvalPackageExpression(main.value)")
+		v, err := value.TypeAssert("*main.config", DefaultLoadConfig)
+		assertNoError(err, t, "TypeAssert(*main.config)")
+		if v.Type != "*main.config" || !strings.Contains(v.Value, "Name: cfg") {
+			t.Fatalf("wrong asserted value: %s %s", v.Type, v.Value)
+		}
+
+		_, err = value.TypeAssert("main.config", DefaultLoadConfig)
+		if err == nil || err.Error() != "interface conversion: interface {} is *main.config, not main.config" {
+			t.Fatalf("wrong error for a failed assertion: %v", err)
+		}
+		nilvalue, err := p.EvalPackageExpression("main.nilvalue", DefaultLoadConfig)
+		assertNoError(err, t, "EvalPackageExpression(main.nilvalue)")
+		if _, err := nilvalue.TypeAssert("*main.config", DefaultLoadConfig); err == nil {
+			t.Fatal("assertion of a nil interface succeeded")
+		}
+		items, err := p.EvalPackageExpression("main.items", DefaultLoadConfig)
+		assertNoError(err, t, "EvalPackageExpression(main.items)")
+		if _, err := items.TypeAssert("int", DefaultLoadConfig); err == nil {
+			t.Fatal("assertion of a slice succeeded")
+		}
+	})
+}
+
+func TestIsNil(t *testing.T) {
+	testcases := []struct {
+		name  string
+		isNil bool
+	}{
+		{"r1.err", true},
+		{"r2.err", false}, // holds a nil *myError
+		{"nilerr", true},
+		{"nilmap", true},
+		{"m", false},
+		{"fn2", true},
+		{"fn1", false},
+		{"spare", false},
+	}
+
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		for _, tc := range testcases {
+			v, err := evalVariable(p, tc.name)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			isNil, err := v.IsNil()
+			assertNoError(err, t, fmt.Sprintf("IsNil(%s)", tc.name))
+			if isNil != tc.isNil {
+				t.Fatalf("Wrong result for %s: %v (expected: %v)", tc.name, isNil, tc.isNil)
+			}
+		}
+
+		v, err := evalVariable(p, "d1")
+		assertNoError(err, t, "EvalVariable(d1)")
+		if _, err := v.IsNil(); err == nil {
+			t.Fatal("expected error comparing an integer to nil")
+		}
+	})
+}
+
+func TestBackingArray(t *testing.T) {
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		v, err := evalVariable(p, "spare")
+		assertNoError(err, t, "EvalVariable(spare)")
+		arr, err := v.BackingArray()
+		assertNoError(err, t, "BackingArray()")
+		if arr.Len != 5 {
+			t.Fatalf("Wrong length for the backing array: %d (expected: 5)", arr.Len)
+		}
+		assertNoError(arr.loadValue(false), t, "loadValue()")
+		if arr.Value != "[5]int [1,2,3,4,5]" {
+			t.Fatalf("Wrong value for the backing array: %q", arr.Value)
+		}
+
+		v, err = evalVariable(p, "n")
+		assertNoError(err, t, "EvalVariable(n)")
+		if _, err := v.BackingArray(); err == nil {
+			t.Fatal("expected an error for a struct")
+		}
+	})
+}
+
+func TestSelectorChains(t *testing.T) {
+	testcases := []varTest{
+		{"o1.In.X", "2", "", "int", nil},
+		{"o2.In.X", "3", "", "int", nil},
+		{"n2.Next.Val", "3", "", "int", nil},
+		{"n2.Next.Next", "*main.node nil", "", "*main.node", nil},
+		{"o1.In.Y", "", "", "", fmt.Errorf("o1.In has no member Y")},
+		{"n2.Next.Next.Val", "", "", "", fmt.Errorf("n2.Next.Next is nil")},
+		{"o1.Arr[1]", "2", "", "int", nil},
+		{"o1.Sl[2]", "3", "", "int", nil},
+		{"cfg.Servers[2].Addr.Port", "443", "", "int", nil},
+		{"cfg.Servers[0].Addr.Host", "h1", "", "struct string", nil},
+		{"cfg.Servers[3].Addr", "", "", "", fmt.Errorf("index 3 out of range for cfg.Servers of length 3")},
+		{"o1.In[0]", "", "", "", fmt.Errorf("o1.In type main.inner is not an array or slice")},
+	}
+
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		for _, tc := range testcases {
+			variable, err := evalVariable(p, tc.name)
+			if tc.err == nil {
+				assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+				assertVariable(t, variable, tc)
+			} else {
+				if err == nil {
+					t.Fatalf("Expected error %s, got no error", tc.err.Error())
+				}
+				if tc.err.Error() != err.Error() {
+					t.Fatalf("Unexpected error. Expected %s got %s", tc.err.Error(), err.Error())
+				}
+			}
+		}
+	})
+}
+
+func TestEvalExpressions(t *testing.T) {
+	testcases := []varTest{
+		{"o1.In.X", "2", "", "int", nil},
+		{"o1.In.Y", "", "", "", fmt.Errorf("o1.In has no member Y")},
+		{"n2.Next.Val", "3", "", "int", nil},
+	}
+
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+		scope, err := p.CurrentThread.Scope()
+		assertNoError(err, t, "Scope()")
+
+		vars, errs := scope.EvalExpressions(strings.Split("o1.In.X, o1.In.Y, n2.Next.Val", ","), DefaultLoadConfig)
+		if len(vars) != len(testcases) || len(errs) != len(testcases) {
+			t.Fatalf("wrong number of results %d %d", len(vars), len(errs))
+		}
+		for i, tc := range testcases {
+			if tc.err == nil {
+				assertNoError(errs[i], t, fmt.Sprintf("EvalExpressions(%s)", tc.name))
+				assertVariable(t, vars[i], tc)
+			} else {
+				if errs[i] == nil || vars[i] != nil {
+					t.Fatalf("Expected error %s, got %v", tc.err.Error(), vars[i])
+				}
+				if tc.err.Error() != errs[i].Error() {
+					t.Fatalf("Unexpected error. Expected %s got %s", tc.err.Error(), errs[i].Error())
+				}
+			}
+		}
+	})
+}
+
+func TestCompiledExpr(t *testing.T) {
+	testcases := []varTest{
+		{"o1.In.X", "2", "", "int", nil},
+		{"n2.Next.Val", "3", "", "int", nil},
+		{"n2.Next.Next.Val", "", "", "", fmt.Errorf("n2.Next.Next is nil")},
+		{"cfg.Servers[2].Addr.Port", "443", "", "int", nil},
+		{"o1.Arr[1]", "2", "", "int", nil},
+		{"cfg.Servers[3].Addr", "", "", "", fmt.Errorf("index 3 out of range for cfg.Servers of length 3")},
+	}
+
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+		scope, err := p.CurrentThread.Scope()
+		assertNoError(err, t, "Scope()")
+
+		for _, tc := range testcases {
+			ce, err := scope.Compile(tc.name)
+			assertNoError(err, t, fmt.Sprintf("Compile(%s)", tc.name))
+			variable, err := ce.Eval(scope, DefaultLoadConfig)
+			if tc.err == nil {
+				assertNoError(err, t, fmt.Sprintf("Eval(%s)", tc.name))
+				assertVariable(t, variable, tc)
+			} else {
+				if err == nil {
+					t.Fatalf("Expected error %s, got no error", tc.err.Error())
+				}
+				if tc.err.Error() != err.Error() {
+					t.Fatalf("Unexpected error. Expected %s got %s", tc.err.Error(), err.Error())
+				}
+			}
+		}
+
+		if _, err := scope.Compile("o1.In.Y"); err == nil {
+			t.Fatal("expected error compiling o1.In.Y")
+		}
+	})
+}
+
+// Continues to a breakpoint in a loop that only stops every 10 hits,
+// either checking its condition as compiled by the breakpoint or
+// evaluating it with EvalVariable on every hit.
+func benchmarkConditionalBreakpoint(b *testing.B, compiled bool) {
+	withTestProcess("condloopprog", b, func(p *Process, fixture protest.Fixture) {
+		pc, err := p.FindFileLocation(fixture.Source, 9)
+		assertNoError(err, b, "FindFileLocation()")
+		bp, err := p.SetBreakpoint(pc)
+		assertNoError(err, b, "SetBreakpoint()")
+		if compiled {
+			bp.Cond = "hit"
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for {
+				assertNoError(p.Continue(), b, "Continue()")
+				if compiled {
+					break
+				}
+				v, err := evalVariable(p, "hit")
+				assertNoError(err, b, "EvalVariable()")
+				if v.Value == "true" {
+					break
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkConditionEvalVariable(b *testing.B) {
+	benchmarkConditionalBreakpoint(b, false)
+}
+
+func BenchmarkConditionCompiled(b *testing.B) {
+	benchmarkConditionalBreakpoint(b, true)
+}
+
+func TestFunctionEntry(t *testing.T) {
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+		entry := p.goSymTable.LookupFunc("main.helloworld").Entry
+
+		for _, name := range []string{"main.helloworld", "helloworld", "fn1"} {
+			v, err := evalVariable(p, name)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", name))
+			if v.Value != "main.helloworld" {
+				t.Fatalf("Wrong value for %s: %q (expected: main.helloworld)", name, v.Value)
+			}
+			pc, err := v.FunctionEntry()
+			assertNoError(err, t, fmt.Sprintf("FunctionEntry(%s)", name))
+			if pc != entry {
+				t.Fatalf("Wrong entry for %s: %#x (expected: %#x)", name, pc, entry)
+			}
+		}
+
+		v, err := evalVariable(p, "fn2")
+		assertNoError(err, t, "EvalVariable(fn2)")
+		pc, err := v.FunctionEntry()
+		assertNoError(err, t, "FunctionEntry(fn2)")
+		if pc != 0 {
+			t.Fatalf("Wrong entry for nil func: %#x", pc)
+		}
+	})
+}
+
+func TestEmbeddedInterfaceMethod(t *testing.T) {
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		v, err := evalVariable(p, "h.Greet")
+		assertNoError(err, t, "EvalVariable(h.Greet)")
+		if v.Value != "main.(*english).Greet" {
+			t.Fatalf("Wrong value for h.Greet: %q (expected: main.(*english).Greet)", v.Value)
+		}
+		pc, err := v.FunctionEntry()
+		assertNoError(err, t, "FunctionEntry(h.Greet)")
+		if entry := p.goSymTable.LookupFunc("main.(*english).Greet").Entry; pc != entry {
+			t.Fatalf("Wrong entry for h.Greet: %#x (expected: %#x)", pc, entry)
+		}
+
+		if _, err := evalVariable(p, "h.Missing"); err == nil {
+			t.Fatal("Expected an error evaluating h.Missing")
+		}
+	})
+}
+
+func TestReflectValue(t *testing.T) {
+	withTestProcess("reflectprog", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		for name, value := range map[string]string{"main.rv": "42", "main.rvptr": "*42"} {
+			v, err := evalVariable(p, name)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", name))
+			val, err := v.ReflectValue(DefaultLoadConfig)
+			assertNoError(err, t, fmt.Sprintf("ReflectValue(%s)", name))
+			if val.Value != value {
+				t.Fatalf("Wrong value wrapped by %s: %q (expected: %q)", name, val.Value, value)
+			}
+		}
+		v, err := evalVariable(p, "main.zero")
+		assertNoError(err, t, "EvalVariable(main.zero)")
+		if _, err := v.ReflectValue(DefaultLoadConfig); err == nil {
+			t.Fatal("ReflectValue() of the zero reflect.Value did not fail")
+		}
+	})
+}
+
+func TestMapStats(t *testing.T) {
+	withTestProcess("testvariables4", t, func(p *Process, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue() returned an error")
+
+		v, err := evalVariable(p, "m")
+		assertNoError(err, t, "EvalVariable(m)")
+		stats, err := v.MapStats()
+		assertNoError(err, t, "MapStats(m)")
+		if stats.Count != 100 {
+			t.Fatalf("Wrong count: %d (expected: 100)", stats.Count)
+		}
+		if stats.Buckets < 8 || stats.Buckets&(stats.Buckets-1) != 0 {
+			t.Fatalf("Implausible number of buckets: %d", stats.Buckets)
+		}
+		if stats.LoadFactor <= 0 || stats.LoadFactor > 6.5 {
+			t.Fatalf("Implausible load factor: %f", stats.LoadFactor)
+		}
+
+		v, err = evalVariable(p, "nilmap")
+		assertNoError(err, t, "EvalVariable(nilmap)")
+		stats, err = v.MapStats()
+		assertNoError(err, t, "MapStats(nilmap)")
+		if stats.Count != 0 {
+			t.Fatalf("Wrong count for nil map: %d", stats.Count)
+		}
+
+		v, err = evalVariable(p, "d1")
+		assertNoError(err, t, "EvalVariable(d1)")
+		if _, err := v.MapStats(); err == nil {
+			t.Fatal("Expected an error decoding a non-map variable")
+		}
+	})
+}
+
+func TestOptimizedArguments(t *testing.T) {
+	fixture := protest.BuildOptimizedFixture("optimizedprog")
+	p, err := Launch([]string{fixture.Path})
+	if err != nil {
+		t.Fatal("Launch():", err)
+	}
+	defer func() {
+		p.Halt()
+		p.Kill()
+	}()
+
+	// At the entry of the function the arguments are where the caller
+	// put them, in registers for compilers passing arguments in them.
+	pc, err := p.FindFunctionLocation("main.sum", false, 0)
+	assertNoError(err, t, "FindFunctionLocation()")
+	_, err = p.SetBreakpoint(pc)
+	assertNoError(err, t, "SetBreakpoint()")
+	assertNoError(p.Continue(), t, "Continue()")
+
+	for _, tc := range []varTest{
+		{"a", "1", "", "int", nil},
+		{"b", "2", "", "int", nil},
+	} {
+		variable, err := evalVariable(p, tc.name)
+		assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+		assertVariable(t, variable, tc)
+	}
+}
+
+func TestOptimizedPointerInRegister(t *testing.T) {
+	fixture := protest.BuildOptimizedFixture("optimizedprog")
+	p, err := Launch([]string{fixture.Path})
+	if err != nil {
+		t.Fatal("Launch():", err)
+	}
+	defer func() {
+		p.Halt()
+		p.Kill()
+	}()
+
+	pc, err := p.FindFunctionLocation("main.dist", false, 0)
+	assertNoError(err, t, "FindFunctionLocation()")
+	_, err = p.SetBreakpoint(pc)
+	assertNoError(err, t, "SetBreakpoint()")
+	assertNoError(p.Continue(), t, "Continue()")
+
+	pv, err := evalVariable(p, "p")
+	assertNoError(err, t, "EvalVariable(p)")
+	qv, err := evalVariable(p, "q")
+	assertNoError(err, t, "EvalVariable(q)")
+	if pv.regValue == nil || qv.regValue == nil {
+		t.Skip("the arguments of main.dist are not passed in registers")
+	}
+
+	isnil, err := pv.IsNil()
+	assertNoError(err, t, "IsNil()")
+	if isnil {
+		t.Fatal("p held in a register reported as nil")
+	}
+	n, err := qv.PtrDiff(pv)
+	assertNoError(err, t, "PtrDiff()")
+	if n != 1 {
+		t.Fatalf("wrong distance between q and p: %d (expected: 1)", n)
+	}
+	diffs, err := pv.Diff(qv)
+	assertNoError(err, t, "Diff()")
+	if len(diffs) != 1 {
+		t.Fatalf("wrong differences between p and q: %v", diffs)
+	}
+}
@@ -0,0 +1,149 @@
+package proc
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// SoftwareWatch is a watchpoint implemented by single stepping, created
+// by SetSoftwareWatch. It works on any number of variables and on any
+// architecture, at the cost of stopping the process after every
+// instruction.
+type SoftwareWatch struct {
+	Expr     string
+	OldValue string // Value before the last change.
+	NewValue string // Value after the last change.
+
+	g        *G                       // Goroutine stepped by ContinueToWatch.
+	compiled map[uint64]*CompiledExpr // Expr compiled for each function by entry, nil where it is not in scope.
+	canceled int32
+}
+
+// SoftwareWatchCanceledError is returned by ContinueToWatch when Cancel
+// was called on the watch.
+type SoftwareWatchCanceledError struct {
+	Expr string
+}
+
+func (e SoftwareWatchCanceledError) Error() string {
+	return fmt.Sprintf("watch of %s canceled", e.Expr)
+}
+
+// SetSoftwareWatch evaluates expr, as accepted by EvalScope.Compile, in
+// the scope of the current thread and returns a watch of its value, to
+// be used with ContinueToWatch. The watch is bound to the current
+// goroutine, only that goroutine is stepped by ContinueToWatch.
+func (dbp *Process) SetSoftwareWatch(expr string) (*SoftwareWatch, error) {
+	g, err := dbp.CurrentThread.GetG()
+	if err != nil {
+		return nil, err
+	}
+	scope, err := dbp.CurrentThread.Scope()
+	if err != nil {
+		return nil, err
+	}
+	ce, err := scope.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	v, err := ce.Eval(scope, DefaultLoadConfig)
+	if err != nil {
+		return nil, err
+	}
+	w := &SoftwareWatch{Expr: expr, NewValue: v.Value, g: g, compiled: make(map[uint64]*CompiledExpr)}
+	if fn := dbp.goSymTable.PCToFunc(scope.PC); fn != nil {
+		w.compiled[fn.Entry] = ce
+	}
+	return w, nil
+}
+
+// Cancel makes ContinueToWatch return a SoftwareWatchCanceledError
+// before its next step, the watch can not be continued afterwards. It
+// can be called from any goroutine.
+func (w *SoftwareWatch) Cancel() {
+	atomic.StoreInt32(&w.canceled, 1)
+}
+
+// Evaluates the expression in the scope of thread. Returns false if it
+// can not be evaluated there, i.e. in a function where a watched local
+// variable is not in scope.
+func (w *SoftwareWatch) eval(thread *Thread) (string, bool) {
+	scope, err := thread.Scope()
+	if err != nil {
+		return "", false
+	}
+	fn := thread.dbp.goSymTable.PCToFunc(scope.PC)
+	if fn == nil {
+		return "", false
+	}
+	ce, ok := w.compiled[fn.Entry]
+	if !ok {
+		ce, _ = scope.Compile(w.Expr)
+		w.compiled[fn.Entry] = ce
+	}
+	if ce == nil {
+		return "", false
+	}
+	v, err := ce.Eval(scope, DefaultLoadConfig)
+	if err != nil {
+		return "", false
+	}
+	return v.Value, true
+}
+
+// ContinueToWatch single steps the goroutine of w, leaving the other
+// threads stopped, evaluating the expression again after each step
+// until its value changes. OldValue and NewValue of w are then set to
+// the values before and after the change. Steps where the expression
+// can not be evaluated are skipped. Breakpoints are stepped over without
+// stopping. Calls to the runtime, where the goroutine can block, are not
+// single stepped: as in Next the process is resumed until they return
+// on the goroutine. Any goroutine may have changed the value meanwhile,
+// the value after their return is not reported, it is the one later
+// steps are compared to.
+func (dbp *Process) ContinueToWatch(w *SoftwareWatch) error {
+	return dbp.run(func() error {
+		g, err := dbp.FindGoroutine(w.g.Id)
+		if err != nil {
+			return err
+		}
+		thread := g.thread
+		if thread == nil {
+			if thread, err = dbp.continueGoroutineTo(g, g.PC); err != nil {
+				return err
+			}
+		}
+		for atomic.LoadInt32(&w.canceled) == 0 {
+			pc, err := thread.PC()
+			if err != nil {
+				return err
+			}
+			stepped := true
+			if fn := dbp.goSymTable.PCToFunc(pc); fn != nil && isRuntimeFunc(fn) {
+				// Functions without a caller, such as the return
+				// trampoline of a signal handler, are stepped.
+				if ret, err := thread.ReturnAddress(); err == nil {
+					if thread, err = dbp.continueGoroutineTo(g, ret); err != nil {
+						return err
+					}
+					stepped = false
+				} else if err := thread.Step(); err != nil {
+					return err
+				}
+			} else if err := thread.Step(); err != nil {
+				return err
+			}
+			value, ok := w.eval(thread)
+			if !ok || value == w.NewValue {
+				continue
+			}
+			if !stepped {
+				w.NewValue = value
+				continue
+			}
+			w.OldValue, w.NewValue = w.NewValue, value
+			return dbp.SwitchThread(thread.Id)
+		}
+		return SoftwareWatchCanceledError{Expr: w.Expr}
+	})
+}
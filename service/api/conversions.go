@@ -18,6 +18,8 @@ func ConvertBreakpoint(bp *proc.Breakpoint) *Breakpoint {
 		Stacktrace:   bp.Stacktrace,
 		Goroutine:    bp.Goroutine,
 		Variables:    bp.Variables,
+		Spawn:        bp.Spawn,
+		Cond:         bp.Cond,
 	}
 }
 
@@ -56,6 +58,34 @@ func ConvertVar(v *proc.Variable) Variable {
 	}
 }
 
+// ConvertLoadConfig converts an internal load configuration to an API LoadConfig.
+func ConvertLoadConfig(cfg proc.LoadConfig) *LoadConfig {
+	return &LoadConfig{
+		FollowPointers:     cfg.FollowPointers,
+		Unreadable:         int(cfg.Unreadable),
+		MaxStringLen:       cfg.MaxStringLen,
+		MaxArrayValues:     cfg.MaxArrayValues,
+		MaxStructFields:    cfg.MaxStructFields,
+		MaxVariableRecurse: cfg.MaxVariableRecurse,
+	}
+}
+
+// LoadConfigToProc converts an API LoadConfig to the internal one, nil
+// becomes proc.DefaultLoadConfig.
+func LoadConfigToProc(cfg *LoadConfig) proc.LoadConfig {
+	if cfg == nil {
+		return proc.DefaultLoadConfig
+	}
+	return proc.LoadConfig{
+		FollowPointers:     cfg.FollowPointers,
+		Unreadable:         proc.UnreadablePolicy(cfg.Unreadable),
+		MaxStringLen:       cfg.MaxStringLen,
+		MaxArrayValues:     cfg.MaxArrayValues,
+		MaxStructFields:    cfg.MaxStructFields,
+		MaxVariableRecurse: cfg.MaxVariableRecurse,
+	}
+}
+
 func ConvertFunction(fn *gosym.Func) *Function {
 	if fn == nil {
 		return nil
@@ -71,12 +101,15 @@ func ConvertFunction(fn *gosym.Func) *Function {
 
 // convertGoroutine converts an internal Goroutine to an API Goroutine.
 func ConvertGoroutine(g *proc.G) *Goroutine {
+	used, size := g.StackUsage()
 	return &Goroutine{
-		ID:       g.Id,
-		PC:       g.PC,
-		File:     g.File,
-		Line:     g.Line,
-		Function: ConvertFunction(g.Func),
+		ID:        g.Id,
+		PC:        g.PC,
+		File:      g.File,
+		Line:      g.Line,
+		Function:  ConvertFunction(g.Func),
+		StackUsed: used,
+		StackSize: size,
 	}
 }
 
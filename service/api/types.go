@@ -42,6 +42,10 @@ type Breakpoint struct {
 	Goroutine bool `json:"goroutine"`
 	// variables to evaluate
 	Variables []string `json:"variables,omitempty"`
+	// retrieve the function started by the go statement
+	Spawn bool `json:"spawn,omitempty"`
+	// boolean variable, the breakpoint only stops when it is true
+	Cond string `json:"cond,omitempty"`
 }
 
 // Thread is a thread within the debugged process.
@@ -118,6 +122,10 @@ type Goroutine struct {
 	Line int `json:"line"`
 	// Function is function information at the program counter. May be nil.
 	Function *Function `json:"function,omitempty"`
+	// StackUsed is the number of bytes of the goroutine's stack in use.
+	StackUsed uint64 `json:"stackUsed"`
+	// StackSize is the total size of the goroutine's stack.
+	StackSize uint64 `json:"stackSize"`
 }
 
 // DebuggerCommand is a command which changes the debugger's execution state.
@@ -138,6 +146,7 @@ type BreakpointInfo struct {
 	Goroutine  *Goroutine   `json:"goroutine,omitempty"`
 	Variables  []Variable   `json:"variables,omitempty"`
 	Arguments  []Variable   `json:"arguments,omitempty"`
+	Spawned    *Function    `json:"spawned,omitempty"`
 }
 
 type EvalScope struct {
@@ -145,6 +154,17 @@ type EvalScope struct {
 	Frame       int
 }
 
+// LoadConfig limits how much of the value of a variable is read, as
+// proc.LoadConfig does. A nil *LoadConfig stands for proc.DefaultLoadConfig.
+type LoadConfig struct {
+	FollowPointers     int
+	Unreadable         int // One of the proc.UnreadablePolicy values.
+	MaxStringLen       int
+	MaxArrayValues     int
+	MaxStructFields    int
+	MaxVariableRecurse int
+}
+
 const (
 	// Continue resumes process execution.
 	Continue = "continue"
@@ -47,11 +47,11 @@ type Client interface {
 	GetThread(id int) (*api.Thread, error)
 
 	// ListPackageVariables lists all package variables in the context of the current thread.
-	ListPackageVariables(filter string) ([]api.Variable, error)
+	ListPackageVariables(filter string, cfg *api.LoadConfig) ([]api.Variable, error)
 	// EvalVariable returns a variable in the context of the current thread.
-	EvalVariable(scope api.EvalScope, symbol string) (*api.Variable, error)
+	EvalVariable(scope api.EvalScope, symbol string, cfg *api.LoadConfig) (*api.Variable, error)
 	// ListPackageVariablesFor lists all package variables in the context of a thread.
-	ListPackageVariablesFor(threadID int, filter string) ([]api.Variable, error)
+	ListPackageVariablesFor(threadID int, filter string, cfg *api.LoadConfig) ([]api.Variable, error)
 
 	// SetVariable sets the value of a variable
 	SetVariable(scope api.EvalScope, symbol, value string) error
@@ -61,17 +61,17 @@ type Client interface {
 	// ListFunctions lists all functions in the process matching filter.
 	ListFunctions(filter string) ([]string, error)
 	// ListLocals lists all local variables in scope.
-	ListLocalVariables(scope api.EvalScope) ([]api.Variable, error)
+	ListLocalVariables(scope api.EvalScope, cfg *api.LoadConfig) ([]api.Variable, error)
 	// ListFunctionArgs lists all arguments to the current function.
-	ListFunctionArgs(scope api.EvalScope) ([]api.Variable, error)
+	ListFunctionArgs(scope api.EvalScope, cfg *api.LoadConfig) ([]api.Variable, error)
 	// ListRegisters lists registers and their values.
 	ListRegisters() (string, error)
 
 	// ListGoroutines lists all goroutines.
 	ListGoroutines() ([]*api.Goroutine, error)
 
-	// Returns stacktrace
-	Stacktrace(goroutineId, depth int, full bool) ([]api.Stackframe, error)
+	// Returns stacktrace, with the arguments and locals of the frames if cfg is not nil
+	Stacktrace(goroutineId, depth int, cfg *api.LoadConfig) ([]api.Stackframe, error)
 
 	// Returns whether we attached to a running process or not
 	AttachedToExistingProcess() bool
@@ -9,7 +9,6 @@ import (
 
 	"github.com/derekparker/delve/proc"
 	"github.com/derekparker/delve/service/api"
-	sys "golang.org/x/sys/unix"
 )
 
 // Debugger service.
@@ -23,6 +22,9 @@ import (
 type Debugger struct {
 	config  *Config
 	process *proc.Process
+	// target controls the execution of process, it is the
+	// process itself unless a different backend is in use.
+	target proc.Target
 }
 
 // Config provides the configuration to start a Debugger.
@@ -36,6 +38,10 @@ type Config struct {
 	// AttachPid is the PID of an existing process to which the debugger should
 	// attach.
 	AttachPid int
+	// NewTarget, if set, returns the Target controlling the execution of
+	// the process, which is otherwise controlled directly. It is called
+	// again with the new process on Restart.
+	NewTarget func(p *proc.Process) (proc.Target, error)
 }
 
 // New creates a new Debugger.
@@ -60,9 +66,28 @@ func New(config *Config) (*Debugger, error) {
 		}
 		d.process = p
 	}
+	if err := d.setProcess(d.process); err != nil {
+		d.process.Detach(d.config.AttachPid == 0)
+		return nil, err
+	}
 	return d, nil
 }
 
+// Makes p the debugged process, with its execution controlled by the
+// Target returned by NewTarget if there is one.
+func (d *Debugger) setProcess(p *proc.Process) error {
+	var target proc.Target = p
+	if d.config.NewTarget != nil {
+		var err error
+		if target, err = d.config.NewTarget(p); err != nil {
+			return err
+		}
+	}
+	d.process = p
+	d.target = target
+	return nil
+}
+
 func (d *Debugger) ProcessPid() int {
 	return d.process.Pid
 }
@@ -76,32 +101,15 @@ func (d *Debugger) Detach(kill bool) error {
 }
 
 func (d *Debugger) Restart() error {
-	if !d.process.Exited() {
-		if d.process.Running() {
-			d.process.Halt()
-		}
-		// Ensure the process is in a PTRACE_STOP.
-		if err := sys.Kill(d.ProcessPid(), sys.SIGSTOP); err != nil {
-			return err
-		}
-		if err := d.Detach(true); err != nil {
-			return err
-		}
-	}
-	p, err := proc.Launch(d.config.ProcessArgs)
-	if err != nil {
+	p, err := d.process.Restart(false)
+	if p == nil {
 		return fmt.Errorf("could not launch process: %s", err)
 	}
-	for addr, bp := range d.process.Breakpoints {
-		if bp.Temp {
-			continue
-		}
-		if _, err := p.SetBreakpoint(addr); err != nil {
-			return err
-		}
+	if terr := d.setProcess(p); terr != nil {
+		p.Detach(true)
+		return terr
 	}
-	d.process = p
-	return nil
+	return err
 }
 
 func (d *Debugger) State() (*api.DebuggerState, error) {
@@ -166,6 +174,7 @@ func (d *Debugger) CreateBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoin
 	bp.Goroutine = requestedBp.Goroutine
 	bp.Stacktrace = requestedBp.Stacktrace
 	bp.Variables = requestedBp.Variables
+	bp.Cond = requestedBp.Cond
 	createdBp = api.ConvertBreakpoint(bp)
 	log.Printf("created breakpoint: %#v", createdBp)
 	return createdBp, nil
@@ -184,10 +193,7 @@ func (d *Debugger) ClearBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoint
 
 func (d *Debugger) Breakpoints() []*api.Breakpoint {
 	bps := []*api.Breakpoint{}
-	for _, bp := range d.process.Breakpoints {
-		if bp.Temp {
-			continue
-		}
+	for _, bp := range d.process.ListBreakpoints(false) {
 		bps = append(bps, api.ConvertBreakpoint(bp))
 	}
 	return bps
@@ -225,7 +231,7 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 	switch command.Name {
 	case api.Continue:
 		log.Print("continuing")
-		err = d.process.Continue()
+		err = d.target.Continue()
 		state, stateErr := d.State()
 		if stateErr != nil {
 			return state, stateErr
@@ -244,10 +250,10 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 
 	case api.Next:
 		log.Print("nexting")
-		err = d.process.Next()
+		err = d.target.Next()
 	case api.Step:
 		log.Print("stepping")
-		err = d.process.Step()
+		err = d.target.Step()
 	case api.SwitchThread:
 		log.Printf("switching to thread %d", command.ThreadID)
 		err = d.process.SwitchThread(command.ThreadID)
@@ -258,7 +264,7 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 		// RequestManualStop does not invoke any ptrace syscalls, so it's safe to
 		// access the process directly.
 		log.Print("halting")
-		err = d.process.RequestManualStop()
+		err = d.target.RequestManualStop()
 	}
 	if err != nil {
 		return nil, err
@@ -283,12 +289,20 @@ func (d *Debugger) collectBreakpointInformation(state *api.DebuggerState) error
 		bpi.Goroutine = api.ConvertGoroutine(g)
 	}
 
+	if bp.Spawn {
+		fn, err := d.process.SpawnedFunction()
+		if err != nil {
+			return err
+		}
+		bpi.Spawned = api.ConvertFunction(fn)
+	}
+
 	if bp.Stacktrace > 0 {
 		rawlocs, err := d.process.CurrentThread.Stacktrace(bp.Stacktrace)
 		if err != nil {
 			return err
 		}
-		bpi.Stacktrace, err = d.convertStacktrace(rawlocs, false)
+		bpi.Stacktrace, err = d.convertStacktrace(rawlocs, nil)
 		if err != nil {
 			return err
 		}
@@ -303,13 +317,13 @@ func (d *Debugger) collectBreakpointInformation(state *api.DebuggerState) error
 		bpi.Variables = make([]api.Variable, len(bp.Variables))
 	}
 	for i := range bp.Variables {
-		v, err := s.EvalVariable(bp.Variables[i])
+		v, err := s.EvalVariable(bp.Variables[i], proc.DefaultLoadConfig)
 		if err != nil {
 			return err
 		}
 		bpi.Variables[i] = api.ConvertVar(v)
 	}
-	vars, err := functionArguments(s)
+	vars, err := functionArguments(s, proc.DefaultLoadConfig)
 	if err == nil {
 		bpi.Arguments = vars
 	}
@@ -350,7 +364,7 @@ func regexFilterFuncs(filter string, allFuncs []gosym.Func) ([]string, error) {
 	return funcs, nil
 }
 
-func (d *Debugger) PackageVariables(threadID int, filter string) ([]api.Variable, error) {
+func (d *Debugger) PackageVariables(threadID int, filter string, cfg proc.LoadConfig) ([]api.Variable, error) {
 	regex, err := regexp.Compile(filter)
 	if err != nil {
 		return nil, fmt.Errorf("invalid filter argument: %s", err.Error())
@@ -365,7 +379,7 @@ func (d *Debugger) PackageVariables(threadID int, filter string) ([]api.Variable
 	if err != nil {
 		return nil, err
 	}
-	pv, err := scope.PackageVariables()
+	pv, err := scope.PackageVariables(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -397,28 +411,28 @@ func convertVars(pv []*proc.Variable) []api.Variable {
 	return vars
 }
 
-func (d *Debugger) LocalVariables(scope api.EvalScope) ([]api.Variable, error) {
+func (d *Debugger) LocalVariables(scope api.EvalScope, cfg proc.LoadConfig) ([]api.Variable, error) {
 	s, err := d.process.ConvertEvalScope(scope.GoroutineID, scope.Frame)
 	if err != nil {
 		return nil, err
 	}
-	pv, err := s.LocalVariables()
+	pv, err := s.LocalVariables(cfg)
 	if err != nil {
 		return nil, err
 	}
 	return convertVars(pv), err
 }
 
-func (d *Debugger) FunctionArguments(scope api.EvalScope) ([]api.Variable, error) {
+func (d *Debugger) FunctionArguments(scope api.EvalScope, cfg proc.LoadConfig) ([]api.Variable, error) {
 	s, err := d.process.ConvertEvalScope(scope.GoroutineID, scope.Frame)
 	if err != nil {
 		return nil, err
 	}
-	return functionArguments(s)
+	return functionArguments(s, cfg)
 }
 
-func functionArguments(s *proc.EvalScope) ([]api.Variable, error) {
-	pv, err := s.FunctionArguments()
+func functionArguments(s *proc.EvalScope, cfg proc.LoadConfig) ([]api.Variable, error) {
+	pv, err := s.FunctionArguments(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -429,12 +443,12 @@ func functionArguments(s *proc.EvalScope) ([]api.Variable, error) {
 	return vars, nil
 }
 
-func (d *Debugger) EvalVariableInScope(scope api.EvalScope, symbol string) (*api.Variable, error) {
+func (d *Debugger) EvalVariableInScope(scope api.EvalScope, symbol string, cfg proc.LoadConfig) (*api.Variable, error) {
 	s, err := d.process.ConvertEvalScope(scope.GoroutineID, scope.Frame)
 	if err != nil {
 		return nil, err
 	}
-	v, err := s.EvalVariable(symbol)
+	v, err := s.EvalVariable(symbol, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -462,7 +476,9 @@ func (d *Debugger) Goroutines() ([]*api.Goroutine, error) {
 	return goroutines, err
 }
 
-func (d *Debugger) Stacktrace(goroutineId, depth int, full bool) ([]api.Stackframe, error) {
+// Stacktrace returns the frames of the goroutine, with their arguments
+// and local variables read according to cfg, or without them if cfg is nil.
+func (d *Debugger) Stacktrace(goroutineId, depth int, cfg *proc.LoadConfig) ([]api.Stackframe, error) {
 	var rawlocs []proc.Stackframe
 
 	g, err := d.process.FindGoroutine(goroutineId)
@@ -479,25 +495,19 @@ func (d *Debugger) Stacktrace(goroutineId, depth int, full bool) ([]api.Stackfra
 		return nil, err
 	}
 
-	return d.convertStacktrace(rawlocs, full)
+	return d.convertStacktrace(rawlocs, cfg)
 }
 
-func (d *Debugger) convertStacktrace(rawlocs []proc.Stackframe, full bool) ([]api.Stackframe, error) {
+func (d *Debugger) convertStacktrace(rawlocs []proc.Stackframe, cfg *proc.LoadConfig) ([]api.Stackframe, error) {
 	locations := make([]api.Stackframe, 0, len(rawlocs))
 	for i := range rawlocs {
 		frame := api.Stackframe{Location: api.ConvertLocation(rawlocs[i].Call)}
-		if full {
-			scope := rawlocs[i].Scope(d.process.CurrentThread)
-			lv, err := scope.LocalVariables()
-			if err != nil {
-				return nil, err
-			}
-			av, err := scope.FunctionArguments()
-			if err != nil {
+		if cfg != nil {
+			if err := rawlocs[i].LoadVariables(d.process.CurrentThread, *cfg); err != nil {
 				return nil, err
 			}
-			frame.Locals = convertVars(lv)
-			frame.Arguments = convertVars(av)
+			frame.Locals = convertVars(rawlocs[i].Locals)
+			frame.Arguments = convertVars(rawlocs[i].Arguments)
 		}
 		locations = append(locations, frame)
 	}
@@ -9,6 +9,7 @@ import (
 	grpc "net/rpc"
 	"net/rpc/jsonrpc"
 
+	"github.com/derekparker/delve/proc"
 	"github.com/derekparker/delve/service"
 	"github.com/derekparker/delve/service/api"
 	"github.com/derekparker/delve/service/debugger"
@@ -113,11 +114,16 @@ func (s *RPCServer) GetBreakpoint(id int, breakpoint *api.Breakpoint) error {
 type StacktraceGoroutineArgs struct {
 	Id    int
 	Depth int
-	Full  bool
+	Cfg   *api.LoadConfig // Arguments and locals of the frames are not read if nil.
 }
 
 func (s *RPCServer) StacktraceGoroutine(args *StacktraceGoroutineArgs, locations *[]api.Stackframe) error {
-	locs, err := s.debugger.Stacktrace(args.Id, args.Depth, args.Full)
+	var cfg *proc.LoadConfig
+	if args.Cfg != nil {
+		c := api.LoadConfigToProc(args.Cfg)
+		cfg = &c
+	}
+	locs, err := s.debugger.Stacktrace(args.Id, args.Depth, cfg)
 	if err != nil {
 		return err
 	}
@@ -166,7 +172,12 @@ func (s *RPCServer) GetThread(id int, thread *api.Thread) error {
 	return nil
 }
 
-func (s *RPCServer) ListPackageVars(filter string, variables *[]api.Variable) error {
+type PackageVarsArgs struct {
+	Filter string
+	Cfg    *api.LoadConfig
+}
+
+func (s *RPCServer) ListPackageVars(args *PackageVarsArgs, variables *[]api.Variable) error {
 	state, err := s.debugger.State()
 	if err != nil {
 		return err
@@ -177,7 +188,7 @@ func (s *RPCServer) ListPackageVars(filter string, variables *[]api.Variable) er
 		return fmt.Errorf("no current thread")
 	}
 
-	vars, err := s.debugger.PackageVariables(current.ID, filter)
+	vars, err := s.debugger.PackageVariables(current.ID, args.Filter, api.LoadConfigToProc(args.Cfg))
 	if err != nil {
 		return err
 	}
@@ -188,6 +199,7 @@ func (s *RPCServer) ListPackageVars(filter string, variables *[]api.Variable) er
 type ThreadListArgs struct {
 	Id     int
 	Filter string
+	Cfg    *api.LoadConfig
 }
 
 func (s *RPCServer) ListThreadPackageVars(args *ThreadListArgs, variables *[]api.Variable) error {
@@ -195,7 +207,7 @@ func (s *RPCServer) ListThreadPackageVars(args *ThreadListArgs, variables *[]api
 		return fmt.Errorf("no thread with id %d", args.Id)
 	}
 
-	vars, err := s.debugger.PackageVariables(args.Id, args.Filter)
+	vars, err := s.debugger.PackageVariables(args.Id, args.Filter, api.LoadConfigToProc(args.Cfg))
 	if err != nil {
 		return err
 	}
@@ -217,8 +229,13 @@ func (s *RPCServer) ListRegisters(arg interface{}, registers *string) error {
 	return nil
 }
 
-func (s *RPCServer) ListLocalVars(scope api.EvalScope, variables *[]api.Variable) error {
-	vars, err := s.debugger.LocalVariables(scope)
+type ScopeVarsArgs struct {
+	Scope api.EvalScope
+	Cfg   *api.LoadConfig
+}
+
+func (s *RPCServer) ListLocalVars(args ScopeVarsArgs, variables *[]api.Variable) error {
+	vars, err := s.debugger.LocalVariables(args.Scope, api.LoadConfigToProc(args.Cfg))
 	if err != nil {
 		return err
 	}
@@ -226,8 +243,8 @@ func (s *RPCServer) ListLocalVars(scope api.EvalScope, variables *[]api.Variable
 	return nil
 }
 
-func (s *RPCServer) ListFunctionArgs(scope api.EvalScope, variables *[]api.Variable) error {
-	vars, err := s.debugger.FunctionArguments(scope)
+func (s *RPCServer) ListFunctionArgs(args ScopeVarsArgs, variables *[]api.Variable) error {
+	vars, err := s.debugger.FunctionArguments(args.Scope, api.LoadConfigToProc(args.Cfg))
 	if err != nil {
 		return err
 	}
@@ -238,10 +255,11 @@ func (s *RPCServer) ListFunctionArgs(scope api.EvalScope, variables *[]api.Varia
 type EvalSymbolArgs struct {
 	Scope  api.EvalScope
 	Symbol string
+	Cfg    *api.LoadConfig
 }
 
 func (s *RPCServer) EvalSymbol(args EvalSymbolArgs, variable *api.Variable) error {
-	v, err := s.debugger.EvalVariableInScope(args.Scope, args.Symbol)
+	v, err := s.debugger.EvalVariableInScope(args.Scope, args.Symbol, api.LoadConfigToProc(args.Cfg))
 	if err != nil {
 		return err
 	}
@@ -20,6 +20,8 @@ func init() {
 	runtime.GOMAXPROCS(2)
 }
 
+var normalLoadConfig = api.LoadConfig{FollowPointers: -1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1, MaxVariableRecurse: 1}
+
 func assertNoError(err error, t *testing.T, s string) {
 	if err != nil {
 		_, file, line, _ := runtime.Caller(1)
@@ -397,7 +399,7 @@ func TestClientServer_infoLocals(t *testing.T) {
 		if state.Err != nil {
 			t.Fatalf("Unexpected error: %v, state: %#v", state.Err, state)
 		}
-		locals, err := c.ListLocalVariables(api.EvalScope{-1, 0})
+		locals, err := c.ListLocalVariables(api.EvalScope{-1, 0}, nil)
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
@@ -425,7 +427,7 @@ func TestClientServer_infoArgs(t *testing.T) {
 		if regs == "" {
 			t.Fatal("Expected string showing registers values, got empty string")
 		}
-		locals, err := c.ListFunctionArgs(api.EvalScope{-1, 0})
+		locals, err := c.ListFunctionArgs(api.EvalScope{-1, 0}, nil)
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
@@ -623,7 +625,7 @@ func TestClientServer_EvalVariable(t *testing.T) {
 			t.Fatalf("Continue(): %v\n", state.Err)
 		}
 
-		var1, err := c.EvalVariable(api.EvalScope{-1, 0}, "a1")
+		var1, err := c.EvalVariable(api.EvalScope{-1, 0}, "a1", nil)
 		assertNoError(err, t, "EvalVariable")
 
 		t.Logf("var1: <%s>", var1.Value)
@@ -648,7 +650,7 @@ func TestClientServer_SetVariable(t *testing.T) {
 
 		assertNoError(c.SetVariable(api.EvalScope{ -1, 0 }, "a2", "8"), t, "SetVariable()")
 
-		a2, err := c.EvalVariable(api.EvalScope{ -1, 0 }, "a2")
+		a2, err := c.EvalVariable(api.EvalScope{ -1, 0 }, "a2", nil)
 
 		t.Logf("a2: <%s>", a2.Value)
 
@@ -671,7 +673,7 @@ func TestClientServer_FullStacktrace(t *testing.T) {
 		assertNoError(err, t, "GoroutinesInfo()")
 		found := make([]bool, 10)
 		for _, g := range gs {
-			frames, err := c.Stacktrace(g.ID, 10, true)
+			frames, err := c.Stacktrace(g.ID, 10, &normalLoadConfig)
 			assertNoError(err, t, fmt.Sprintf("Stacktrace(%d)", g.ID))
 			for i, frame := range frames {
 				if frame.Function == nil {
@@ -703,7 +705,7 @@ func TestClientServer_FullStacktrace(t *testing.T) {
 			t.Fatalf("Continue(): %v\n", state.Err)
 		}
 
-		frames, err := c.Stacktrace(-1, 10, true)
+		frames, err := c.Stacktrace(-1, 10, &normalLoadConfig)
 		assertNoError(err, t, "Stacktrace")
 
 		cur := 3
@@ -14,6 +14,7 @@ import (
 	"strings"
 	"text/tabwriter"
 
+	"github.com/derekparker/delve/proc"
 	"github.com/derekparker/delve/service"
 	"github.com/derekparker/delve/service/api"
 	"github.com/derekparker/delve/service/debugger"
@@ -315,7 +316,7 @@ func scopePrefix(client service.Client, cmdname string, pargs ...string) error {
 			i++
 		case "list", "ls":
 			frame, gid := scope.Frame, scope.GoroutineID
-			locs, err := client.Stacktrace(gid, frame, false)
+			locs, err := client.Stacktrace(gid, frame, nil)
 			if err != nil {
 				return err
 			}
@@ -329,7 +330,7 @@ func scopePrefix(client service.Client, cmdname string, pargs ...string) error {
 			if err != nil {
 				return err
 			}
-			stack, err := client.Stacktrace(scope.GoroutineID, depth, full)
+			stack, err := client.Stacktrace(scope.GoroutineID, depth, stackLoadConfig(full))
 			if err != nil {
 				return err
 			}
@@ -550,7 +551,7 @@ func printVar(client service.Client, scope api.EvalScope, args ...string) error
 	if len(args) == 0 {
 		return fmt.Errorf("not enough arguments")
 	}
-	val, err := client.EvalVariable(scope, args[0])
+	val, err := client.EvalVariable(scope, args[0], nil)
 	if err != nil {
 		return err
 	}
@@ -590,7 +591,7 @@ func funcs(client service.Client, filter string) ([]string, error) {
 }
 
 func args(client service.Client, scope api.EvalScope, filter string) ([]string, error) {
-	vars, err := client.ListFunctionArgs(scope)
+	vars, err := client.ListFunctionArgs(scope, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -598,7 +599,7 @@ func args(client service.Client, scope api.EvalScope, filter string) ([]string,
 }
 
 func locals(client service.Client, scope api.EvalScope, filter string) ([]string, error) {
-	locals, err := client.ListLocalVariables(scope)
+	locals, err := client.ListLocalVariables(scope, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -606,7 +607,7 @@ func locals(client service.Client, scope api.EvalScope, filter string) ([]string
 }
 
 func vars(client service.Client, filter string) ([]string, error) {
-	vars, err := client.ListPackageVariables(filter)
+	vars, err := client.ListPackageVariables(filter, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -652,7 +653,7 @@ func stackCommand(client service.Client, args ...string) error {
 	if err != nil {
 		return err
 	}
-	stack, err := client.Stacktrace(goroutineid, depth, full)
+	stack, err := client.Stacktrace(goroutineid, depth, stackLoadConfig(full))
 	if err != nil {
 		return err
 	}
@@ -660,6 +661,15 @@ func stackCommand(client service.Client, args ...string) error {
 	return nil
 }
 
+// Returns how the variables of the frames are loaded by the stack
+// command, nil if they are not shown.
+func stackLoadConfig(full bool) *api.LoadConfig {
+	if !full {
+		return nil
+	}
+	return api.ConvertLoadConfig(proc.DefaultLoadConfig)
+}
+
 func parseStackArgs(args []string) (int, bool, error) {
 	var (
 		depth = 10
@@ -757,6 +767,10 @@ func printcontext(state *api.DebuggerState) error {
 			fmt.Printf("\tGoroutine %s\n", formatGoroutine(bpi.Goroutine))
 		}
 
+		if bpi.Spawned != nil {
+			fmt.Printf("\tSpawns %s\n", bpi.Spawned.Name)
+		}
+
 		ss := make([]string, len(bpi.Variables))
 		for i, v := range bpi.Variables {
 			ss[i] = fmt.Sprintf("%s: <%v>", v.Name, v.Value)